@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"metadata-remover/src/logger"
+	"metadata-remover/src/processor"
 	"metadata-remover/src/scanner"
 	"metadata-remover/src/utils"
 )
@@ -19,6 +20,20 @@ var (
 	verboseMode  bool
 	outputFormat string
 	version      bool
+	stripICC     bool
+	keepC2PA     bool
+	stripDPI     bool
+	keepTags     bool
+	keepCovers   bool
+	keepCues     bool
+	dropComments bool
+	acceptEdits  bool
+	dropNotes    bool
+	keepThumbs   bool
+	keepPrinters bool
+	keepCustom   bool
+	keepPaths    bool
+	dropMacros   bool
 )
 
 const (
@@ -32,6 +47,20 @@ func init() {
 	flag.BoolVar(&verboseMode, "verbose", false, "Verbose output")
 	flag.StringVar(&outputFormat, "output", "terminal", "Output format (terminal, json)")
 	flag.BoolVar(&version, "version", false, "Show version information")
+	flag.BoolVar(&stripICC, "strip-icc", false, "Remove embedded ICC color profiles")
+	flag.BoolVar(&keepC2PA, "keep-c2pa", false, "Keep C2PA content credentials")
+	flag.BoolVar(&stripDPI, "strip-resolution", false, "Remove pixel density information")
+	flag.BoolVar(&keepTags, "keep-tags", false, "Keep audio tags such as title and artist")
+	flag.BoolVar(&keepCovers, "keep-cover-art", false, "Keep embedded cover art in audio files")
+	flag.BoolVar(&keepCues, "keep-cuesheet", false, "Keep FLAC cue sheets")
+	flag.BoolVar(&dropComments, "remove-comments", false, "Remove comments from Word and PowerPoint documents")
+	flag.BoolVar(&acceptEdits, "accept-changes", false, "Accept tracked changes in Word documents")
+	flag.BoolVar(&dropNotes, "remove-notes", false, "Remove speaker notes from PowerPoint presentations")
+	flag.BoolVar(&keepThumbs, "keep-thumbnail", false, "Keep the first page thumbnail in office documents")
+	flag.BoolVar(&keepPrinters, "keep-printer-settings", false, "Keep printer settings in Office documents")
+	flag.BoolVar(&keepCustom, "keep-custom-xml", false, "Keep custom XML parts in Office documents")
+	flag.BoolVar(&keepPaths, "keep-external-paths", false, "Keep external link, data source and defined name paths and connection credentials in Excel workbooks")
+	flag.BoolVar(&dropMacros, "remove-macros", false, "Remove VBA macros and save macro-enabled Office files as macro-free")
 
 	// Add aliases for flags
 	flag.StringVar(&dirPath, "p", ".", "Path to directory or file to process (shorthand)")
@@ -68,6 +97,24 @@ func main() {
 	// Initialize scanner
 	s := scanner.NewScanner(log, previewMode, verboseMode)
 
+	// Configure which optional metadata is kept
+	policy := processor.DefaultPolicy()
+	policy.KeepICCProfile = !stripICC
+	policy.KeepContentCredentials = keepC2PA
+	policy.KeepResolution = !stripDPI
+	policy.KeepAudioTags = keepTags
+	policy.KeepCoverArt = keepCovers
+	policy.KeepCueSheet = keepCues
+	policy.RemoveComments = dropComments
+	policy.AcceptRevisions = acceptEdits
+	policy.RemoveSpeakerNotes = dropNotes
+	policy.KeepDocumentThumbnail = keepThumbs
+	policy.KeepPrinterSettings = keepPrinters
+	policy.KeepCustomXML = keepCustom
+	policy.KeepExternalPaths = keepPaths
+	policy.RemoveMacros = dropMacros
+	s.SetPolicy(policy)
+
 	// Print initial information
 	utils.PrintInfo(fmt.Sprintf("Starting metadata removal utility"))
 	utils.PrintInfo(fmt.Sprintf("Path: %s", dirPath))
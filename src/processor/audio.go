@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// ProcessAudio removes metadata from audio files
+func (p *Processor) ProcessAudio(filePath, ext string) error {
+	// If preview mode, just log and return
+	if p.previewMode {
+		return nil
+	}
+
+	ext = strings.ToLower(ext)
+	switch ext {
+	case ".mp3":
+		return p.cleanMP3(filePath)
+	case ".flac":
+		return p.cleanFLAC(filePath)
+	case ".ogg", ".opus":
+		return p.cleanOgg(filePath)
+	case ".wav":
+		return p.cleanWAV(filePath)
+	case ".m4a":
+		return p.cleanMP4(filePath, stats.TypeAudio)
+	default:
+		return fmt.Errorf("unsupported audio format: %s", ext)
+	}
+}
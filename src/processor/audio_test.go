@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"metadata-remover/src/logger"
+)
+
+func setupAudioTest(t *testing.T) (string, *Processor, func()) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "audio_processor_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+
+	// Create logger
+	logPath := filepath.Join(tempDir, "audio_test.log")
+	log, err := logger.NewLogger(logPath)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	// Create processor
+	proc := NewProcessor(log, false)
+
+	// Return cleanup function
+	cleanup := func() {
+		log.Close()
+		os.RemoveAll(tempDir)
+	}
+
+	return tempDir, proc, cleanup
+}
+
+func TestProcessAudio(t *testing.T) {
+	tempDir, proc, cleanup := setupAudioTest(t)
+	defer cleanup()
+
+	t.Run("Preview mode", func(t *testing.T) {
+		previewProc := NewProcessor(proc.logger, true)
+		if err := previewProc.ProcessAudio("dummy_path.mp3", ".mp3"); err != nil {
+			t.Errorf("Expected no error in preview mode, got: %v", err)
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		if err := proc.ProcessAudio(filepath.Join(tempDir, "test.xyz"), ".xyz"); err == nil {
+			t.Error("Expected error for unsupported audio format")
+		}
+	})
+
+	t.Run("Invalid MP3", func(t *testing.T) {
+		invalidPath := filepath.Join(tempDir, "invalid.mp3")
+		if err := os.WriteFile(invalidPath, []byte("Not an MP3 file"), 0644); err != nil {
+			t.Fatalf("Failed to create invalid test file: %v", err)
+		}
+		if err := proc.ProcessAudio(invalidPath, ".MP3"); err == nil {
+			t.Error("Expected error for invalid MP3 file")
+		}
+	})
+
+	t.Run("Nonexistent file", func(t *testing.T) {
+		if err := proc.ProcessAudio(filepath.Join(tempDir, "nonexistent.mp3"), ".mp3"); err == nil {
+			t.Error("Expected error for nonexistent file")
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Compound File Binary sizes, and sector numbers with a special meaning
+const (
+	cfbMaxRegSect  = 0xFFFFFFFA
+	cfbEndOfChain  = 0xFFFFFFFE
+	cfbHeaderSize  = 512
+	cfbEntrySize   = 128
+	cfbHeaderDIFAT = 109 // FAT sector numbers held by the header
+)
+
+// Compound File Binary directory entry types
+const (
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// compoundFile is a Compound File Binary (OLE2) file held in memory, the
+// container of legacy Office documents. Streams are read and written through
+// the sector chains of the FAT and the mini FAT. The allocation tables are
+// never changed, so a stream that is written back must keep its size.
+type compoundFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []int // File offsets of the sectors holding the mini stream
+	entries        []cfbEntry
+}
+
+// cfbEntry is a directory entry of a compound file
+type cfbEntry struct {
+	name   string
+	typ    byte
+	offset int // File offset of the 128-byte entry
+	start  uint32
+	size   uint64
+}
+
+// readCompoundFile parses the header, allocation tables and directory of a
+// compound file. The file keeps using data, which is changed by writes.
+func readCompoundFile(data []byte) (*compoundFile, error) {
+	if len(data) < cfbHeaderSize || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, errors.New("not a valid Office binary file")
+	}
+	le := binary.LittleEndian
+	if le.Uint16(data[28:]) != 0xFFFE {
+		return nil, errors.New("invalid compound file byte order")
+	}
+
+	c := &compoundFile{data: data}
+	switch shift := le.Uint16(data[30:]); {
+	case le.Uint16(data[26:]) == 3 && shift == 9, le.Uint16(data[26:]) == 4 && shift == 12:
+		c.sectorSize = 1 << shift
+	default:
+		return nil, fmt.Errorf("unsupported compound file version %d", le.Uint16(data[26:]))
+	}
+	if le.Uint16(data[32:]) != 6 {
+		return nil, errors.New("invalid compound file mini sector size")
+	}
+	c.miniSectorSize = 64
+	c.miniCutoff = uint64(le.Uint32(data[56:]))
+
+	// The FAT sectors are listed by the header and then by the DIFAT chain
+	numFAT := int(le.Uint32(data[44:]))
+	var fatSectors []uint32
+	for i := 0; i < cfbHeaderDIFAT && len(fatSectors) < numFAT; i++ {
+		fatSectors = append(fatSectors, le.Uint32(data[76+4*i:]))
+	}
+	perSector := c.sectorSize / 4
+	for sector, n := le.Uint32(data[68:]), 0; len(fatSectors) < numFAT; n++ {
+		block, err := c.sector(sector)
+		if err != nil || n >= len(data)/c.sectorSize {
+			return nil, errors.New("invalid compound file DIFAT")
+		}
+		for i := 0; i < perSector-1 && len(fatSectors) < numFAT; i++ {
+			fatSectors = append(fatSectors, le.Uint32(block[4*i:]))
+		}
+		sector = le.Uint32(block[c.sectorSize-4:])
+	}
+	for _, sector := range fatSectors {
+		block, err := c.sector(sector)
+		if err != nil {
+			return nil, errors.New("invalid compound file FAT")
+		}
+		for i := 0; i < perSector; i++ {
+			c.fat = append(c.fat, le.Uint32(block[4*i:]))
+		}
+	}
+
+	miniFATSectors, err := c.chain(le.Uint32(data[60:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compound file mini FAT: %v", err)
+	}
+	for _, offset := range miniFATSectors {
+		for i := 0; i < perSector; i++ {
+			c.miniFAT = append(c.miniFAT, le.Uint32(data[offset+4*i:]))
+		}
+	}
+
+	dirSectors, err := c.chain(le.Uint32(data[48:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compound file directory: %v", err)
+	}
+	for _, offset := range dirSectors {
+		for i := 0; i < c.sectorSize/cfbEntrySize; i++ {
+			entry := readCFBEntry(data, offset+i*cfbEntrySize)
+			if c.sectorSize == 512 {
+				// Version 3 files only use the low 32 bits of the size
+				entry.size &= 0xFFFFFFFF
+			}
+			c.entries = append(c.entries, entry)
+		}
+	}
+	if len(c.entries) == 0 || c.entries[0].typ != cfbRoot {
+		return nil, errors.New("compound file has no root entry")
+	}
+
+	// The root entry holds the mini stream, where small streams are stored
+	if c.miniStream, err = c.chain(c.entries[0].start); err != nil {
+		return nil, fmt.Errorf("invalid compound file mini stream: %v", err)
+	}
+	return c, nil
+}
+
+// readCFBEntry decodes the directory entry at offset
+func readCFBEntry(data []byte, offset int) cfbEntry {
+	le := binary.LittleEndian
+	raw := data[offset : offset+cfbEntrySize]
+	nameLen := int(le.Uint16(raw[64:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	name := make([]uint16, 0, 32)
+	for i := 0; i+1 < nameLen; i += 2 {
+		if u := le.Uint16(raw[i:]); u != 0 {
+			name = append(name, u)
+		}
+	}
+	return cfbEntry{
+		name:   string(utf16.Decode(name)),
+		typ:    raw[66],
+		offset: offset,
+		start:  le.Uint32(raw[116:]),
+		size:   le.Uint64(raw[120:]),
+	}
+}
+
+// sector returns the contents of a regular sector
+func (c *compoundFile) sector(n uint32) ([]byte, error) {
+	if n > cfbMaxRegSect {
+		return nil, fmt.Errorf("invalid sector %#x", n)
+	}
+	offset := (int(n) + 1) * c.sectorSize
+	if offset+c.sectorSize > len(c.data) {
+		return nil, fmt.Errorf("sector %d is past the end of the file", n)
+	}
+	return c.data[offset : offset+c.sectorSize], nil
+}
+
+// chain returns the file offsets of the sectors of a FAT chain
+func (c *compoundFile) chain(start uint32) ([]int, error) {
+	var offsets []int
+	for n := start; n != cfbEndOfChain; n = c.fat[n] {
+		if _, err := c.sector(n); err != nil {
+			return nil, err
+		}
+		if int(n) >= len(c.fat) || len(offsets) >= len(c.fat) {
+			return nil, errors.New("broken sector chain")
+		}
+		offsets = append(offsets, (int(n)+1)*c.sectorSize)
+	}
+	return offsets, nil
+}
+
+// miniChain returns the file offsets of the mini sectors of a mini FAT chain
+func (c *compoundFile) miniChain(start uint32) ([]int, error) {
+	var offsets []int
+	perSector := c.sectorSize / c.miniSectorSize
+	for n := start; n != cfbEndOfChain; n = c.miniFAT[n] {
+		if int(n) >= len(c.miniFAT) || int(n)/perSector >= len(c.miniStream) || len(offsets) >= len(c.miniFAT) {
+			return nil, errors.New("broken mini sector chain")
+		}
+		offsets = append(offsets, c.miniStream[int(n)/perSector]+int(n)%perSector*c.miniSectorSize)
+	}
+	return offsets, nil
+}
+
+// streamRuns returns the file offsets of the pieces of a stream and their size
+func (c *compoundFile) streamRuns(e cfbEntry) ([]int, int, error) {
+	if e.size == 0 {
+		return nil, 0, nil
+	}
+	if e.size < c.miniCutoff {
+		runs, err := c.miniChain(e.start)
+		return runs, c.miniSectorSize, err
+	}
+	runs, err := c.chain(e.start)
+	return runs, c.sectorSize, err
+}
+
+// readStream returns a copy of the contents of a stream
+func (c *compoundFile) readStream(e cfbEntry) ([]byte, error) {
+	runs, size, err := c.streamRuns(e)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(runs)*size) < e.size {
+		return nil, fmt.Errorf("stream %q is truncated", e.name)
+	}
+	out := make([]byte, 0, e.size)
+	for _, offset := range runs {
+		out = append(out, c.data[offset:offset+size]...)
+	}
+	return out[:e.size], nil
+}
+
+// writeStream overwrites the contents of a stream in place
+func (c *compoundFile) writeStream(e cfbEntry, contents []byte) error {
+	if uint64(len(contents)) != e.size {
+		return fmt.Errorf("stream %q cannot change size", e.name)
+	}
+	runs, size, err := c.streamRuns(e)
+	if err != nil {
+		return err
+	}
+	for _, offset := range runs {
+		contents = contents[copy(c.data[offset:offset+size], contents):]
+	}
+	return nil
+}
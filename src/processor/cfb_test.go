@@ -0,0 +1,179 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// testCFBStream is a stream stored under the root of a test compound file
+type testCFBStream struct {
+	name string
+	data []byte
+}
+
+// buildTestCFB builds a version 3 compound file. Sector 0 holds the FAT, sector 1
+// the directory and sector 2 the mini FAT; the mini stream and the regular
+// streams follow. The root entry carries a modification time.
+func buildTestCFB(t *testing.T, streams ...testCFBStream) []byte {
+	const sectorSize = 512
+	le := binary.LittleEndian
+	if len(streams) > 3 {
+		t.Fatal("buildTestCFB supports up to 3 streams")
+	}
+
+	fat := []uint32{0xFFFFFFFD, cfbEndOfChain, cfbEndOfChain}
+	var miniFAT []uint32
+	var mini, regular []byte
+	starts := make([]uint32, len(streams))
+	for i, s := range streams {
+		if len(s.data) < 4096 {
+			starts[i] = uint32(len(mini) / 64)
+			for n := 0; n < (len(s.data)+63)/64; n++ {
+				miniFAT = append(miniFAT, uint32(len(mini)/64+n+1))
+			}
+			miniFAT[len(miniFAT)-1] = cfbEndOfChain
+			mini = append(mini, s.data...)
+			mini = append(mini, make([]byte, (64-len(s.data)%64)%64)...)
+		}
+	}
+	miniSectors := (len(mini) + sectorSize - 1) / sectorSize
+	for n := 0; n < miniSectors; n++ {
+		fat = append(fat, uint32(len(fat)+1))
+	}
+	if miniSectors > 0 {
+		fat[len(fat)-1] = cfbEndOfChain
+	}
+	mini = append(mini, make([]byte, miniSectors*sectorSize-len(mini))...)
+	for i, s := range streams {
+		if len(s.data) >= 4096 {
+			starts[i] = uint32(len(fat))
+			for n := 0; n < (len(s.data)+sectorSize-1)/sectorSize; n++ {
+				fat = append(fat, uint32(len(fat)+1))
+			}
+			fat[len(fat)-1] = cfbEndOfChain
+			regular = append(regular, s.data...)
+			regular = append(regular, make([]byte, (sectorSize-len(s.data)%sectorSize)%sectorSize)...)
+		}
+	}
+	if len(fat) > sectorSize/4 || len(miniFAT) > sectorSize/4 {
+		t.Fatal("buildTestCFB streams are too large")
+	}
+
+	sector := func(values []uint32) []byte {
+		out := make([]byte, sectorSize)
+		for i := range out {
+			out[i] = 0xFF
+		}
+		for i, v := range values {
+			le.PutUint32(out[4*i:], v)
+		}
+		return out
+	}
+	entry := func(name string, typ byte, child, right, start uint32, size int) []byte {
+		out := make([]byte, cfbEntrySize)
+		units := utf16.Encode([]rune(name))
+		for i, u := range units {
+			le.PutUint16(out[2*i:], u)
+		}
+		le.PutUint16(out[64:], uint16(2*len(units)+2))
+		out[66] = typ
+		out[67] = 1
+		le.PutUint32(out[68:], 0xFFFFFFFF)
+		le.PutUint32(out[72:], right)
+		le.PutUint32(out[76:], child)
+		le.PutUint32(out[116:], start)
+		le.PutUint32(out[120:], uint32(size))
+		return out
+	}
+
+	rootStart := uint32(cfbEndOfChain)
+	if miniSectors > 0 {
+		rootStart = 3
+	}
+	dir := entry("Root Entry", cfbRoot, 1, 0xFFFFFFFF, rootStart, len(mini))
+	le.PutUint64(dir[108:], 133537248000000000) // 2024-03-01T00:00:00Z
+	for i, s := range streams {
+		right := uint32(0xFFFFFFFF)
+		if i+1 < len(streams) {
+			right = uint32(i + 2)
+		}
+		dir = append(dir, entry(s.name, cfbStream, 0xFFFFFFFF, right, starts[i], len(s.data))...)
+	}
+	dir = append(dir, make([]byte, sectorSize-len(dir))...)
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, cfbSignature)
+	le.PutUint16(header[24:], 0x3E)
+	le.PutUint16(header[26:], 3)
+	le.PutUint16(header[28:], 0xFFFE)
+	le.PutUint16(header[30:], 9)
+	le.PutUint16(header[32:], 6)
+	le.PutUint32(header[44:], 1)
+	le.PutUint32(header[48:], 1)
+	le.PutUint32(header[56:], 4096)
+	le.PutUint32(header[60:], 2)
+	le.PutUint32(header[64:], 1)
+	le.PutUint32(header[68:], cfbEndOfChain)
+	for i := 0; i < cfbHeaderDIFAT; i++ {
+		le.PutUint32(header[76+4*i:], 0xFFFFFFFF)
+	}
+	le.PutUint32(header[76:], 0)
+
+	out := append(header, sector(fat)...)
+	out = append(out, dir...)
+	out = append(out, sector(miniFAT)...)
+	out = append(out, mini...)
+	return append(out, regular...)
+}
+
+func TestCompoundFile(t *testing.T) {
+	small := []byte("a stream in the mini stream, longer than one mini sector of sixty-four bytes")
+	large := bytes.Repeat([]byte("WordDocument"), 400)
+	input := buildTestCFB(t, testCFBStream{"WordDocument", large}, testCFBStream{"\x01CompObj", small})
+
+	c, err := readCompoundFile(input)
+	if err != nil {
+		t.Fatalf("readCompoundFile failed: %v", err)
+	}
+	if len(c.entries) != 4 || c.entries[1].name != "WordDocument" || c.entries[2].name != "\x01CompObj" {
+		t.Fatalf("Unexpected directory %+v", c.entries)
+	}
+	for i, expected := range [][]byte{large, small} {
+		stream, err := c.readStream(c.entries[i+1])
+		if err != nil || !bytes.Equal(stream, expected) {
+			t.Errorf("Stream %q was not read back: %v", c.entries[i+1].name, err)
+		}
+	}
+
+	// Writing keeps every byte outside the stream
+	changed := bytes.ToUpper(small)
+	if err := c.writeStream(c.entries[2], changed); err != nil {
+		t.Fatalf("writeStream failed: %v", err)
+	}
+	if stream, _ := c.readStream(c.entries[2]); !bytes.Equal(stream, changed) {
+		t.Error("Stream was not written")
+	}
+	if len(c.data) != len(input) || !bytes.Equal(c.data[:3*512], input[:3*512]) {
+		t.Error("Header, FAT, directory or mini FAT changed")
+	}
+	if err := c.writeStream(c.entries[2], small[:10]); err == nil {
+		t.Error("Expected error when changing the size of a stream")
+	}
+
+	truncated := buildTestCFB(t, testCFBStream{"WordDocument", large})
+	for name, invalid := range map[string][]byte{
+		"Not a compound file": []byte("PK\x03\x04"),
+		"Truncated":           truncated[:len(truncated)-512],
+		"Bad byte order":      append(append(append([]byte(nil), input[:28]...), 0xFF, 0xFF), input[30:]...),
+	} {
+		c, err := readCompoundFile(invalid)
+		if err == nil {
+			_, err = c.readStream(c.entries[1])
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
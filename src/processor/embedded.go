@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"metadata-remover/src/stats"
+	"metadata-remover/src/utils"
+)
+
+// maxEmbeddedDepth limits how deeply packages inside packages are cleaned
+const maxEmbeddedDepth = 4
+
+// stripEmbedded cleans a file stored inside a document package, choosing the
+// cleaner by the extension of the part name. It reports false when there is no
+// cleaner for the part, which is then kept as it is. What the cleaner finds is
+// recorded as metadata of the document.
+func (p *Processor) stripEmbedded(name string, data []byte) ([]byte, bool, error) {
+	ext := strings.ToLower(path.Ext(name))
+	child := &Processor{logger: p.logger, Stats: stats.NewMetadataStats(), Policy: p.Policy, depth: p.depth + 1}
+	if _, ok := ooxmlMacroFreeExtensions[ext]; ok {
+		// The part cannot be renamed, so its content type must stay macro-enabled
+		child.Policy.RemoveMacros = false
+	}
+	out, ok, err := child.stripEmbeddedFile(ext, data)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	for fieldName, field := range child.Stats.ByMetadataType {
+		for i := 0; i < field.Count; i++ {
+			example := ""
+			if i < len(field.Examples) {
+				example = field.Examples[i]
+			}
+			p.Stats.AddMetadata(stats.TypeDocument, fieldName, example)
+		}
+	}
+	return out, true, nil
+}
+
+// cleanEmbeddedPart returns a part of a document package cleaned by
+// stripEmbedded. A part its cleaner rejects, such as a picture with a bad
+// checksum or a file whose extension does not match its content, is not
+// cleaned and is kept as it is with a warning, so one damaged part does not
+// stop the rest of the document from being cleaned.
+func (p *Processor) cleanEmbeddedPart(name string, data []byte) []byte {
+	cleaned, ok, err := p.stripEmbedded(name, data)
+	if err != nil {
+		if p.logger != nil {
+			p.logger.Warning("Embedded file %s was not cleaned: %v", name, err)
+		}
+		utils.PrintWarning(fmt.Sprintf("Embedded file %s was not cleaned: %v", name, err))
+		return data
+	}
+	if !ok {
+		return data
+	}
+	return cleaned
+}
+
+// stripEmbeddedFile runs the in-memory cleaner for an extension
+func (p *Processor) stripEmbeddedFile(ext string, data []byte) ([]byte, bool, error) {
+	var out bytes.Buffer
+	var err error
+	switch ext {
+	case ".jpg", ".jpeg", ".jpe", ".jfif":
+		w := bufio.NewWriter(&out)
+		if err = p.stripJPEG(bufio.NewReader(bytes.NewReader(data)), w); err == nil {
+			err = w.Flush()
+		}
+	case ".png":
+		err = p.stripPNG(bytes.NewReader(data), &out)
+	case ".gif":
+		return wrapEmbedded(p.stripGIF(data))
+	case ".tif", ".tiff":
+		return wrapEmbedded(p.stripTIFF(data, baselineTIFFRules))
+	case ".webp":
+		return wrapEmbedded(p.stripWEBP(data))
+	case ".heic", ".heif", ".avif":
+		return wrapEmbedded(p.stripHEIF(data))
+	case ".psd":
+		err = p.stripPSD(bytes.NewReader(data), &out)
+	case ".svg":
+		err = p.stripSVG(bytes.NewReader(data), &out)
+	case ".mp3":
+		err = p.stripMP3(bytes.NewReader(data), int64(len(data)), &out)
+	case ".wav":
+		err = p.stripWAV(bytes.NewReader(data), int64(len(data)), &out)
+	case ".m4a":
+		err = p.stripMP4(bytes.NewReader(data), int64(len(data)), &out, stats.TypeAudio)
+	case ".mp4", ".m4v", ".mov":
+		err = p.stripMP4(bytes.NewReader(data), int64(len(data)), &out, stats.TypeVideo)
+	case ".docx", ".xlsx", ".pptx", ".docm", ".dotx", ".dotm", ".xlsm", ".xltx", ".xltm", ".pptm", ".potx", ".potm":
+		if p.depth > maxEmbeddedDepth {
+			return nil, false, nil
+		}
+		r, zerr := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if zerr != nil {
+			return nil, false, zerr
+		}
+		err = p.stripOpenXML(r, &out)
+	case ".doc", ".xls", ".ppt":
+		return wrapEmbedded(p.stripCompoundFile(data))
+	case ".bin":
+		// OLE objects are stored as embeddings/oleObjectN.bin; other binary parts
+		// such as printer settings are not compound files
+		if !bytes.HasPrefix(data, cfbSignature) {
+			return nil, false, nil
+		}
+		return wrapEmbedded(p.stripCompoundFile(data))
+	case ".odt", ".ods", ".odp":
+		if p.depth > maxEmbeddedDepth {
+			return nil, false, nil
+		}
+		r, zerr := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if zerr != nil {
+			return nil, false, zerr
+		}
+		err = p.stripOpenDocument(r, &out)
+	default:
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return out.Bytes(), true, nil
+}
+
+// wrapEmbedded adapts a byte slice cleaner to stripEmbeddedFile
+func wrapEmbedded(data []byte, err error) ([]byte, bool, error) {
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStripEmbedded(t *testing.T) {
+	exif := testJPEGSegment(0xE1, append([]byte("Exif\x00\x00"), "GPS 51.5007N 0.1246W"...))
+	photo := buildTestJPEG(t, exif)
+
+	t.Run("Images", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		output, ok, err := proc.stripEmbedded("word/media/IMAGE1.JPEG", photo)
+		if err != nil || !ok {
+			t.Fatalf("stripEmbedded failed: %v", err)
+		}
+		if bytes.Contains(output, []byte("GPS")) {
+			t.Error("EXIF was not removed from the embedded image")
+		}
+		if proc.Stats.ByMetadataType["EXIF"] == nil {
+			t.Error("EXIF was not reported in statistics")
+		}
+
+		if _, ok, err := proc.stripEmbedded("word/media/image2.emf", []byte("EMF data")); ok || err != nil {
+			t.Error("Part without a cleaner was not skipped")
+		}
+		if _, _, err := proc.stripEmbedded("word/media/image3.png", []byte("not a png")); err == nil {
+			t.Error("Expected error for an invalid embedded image")
+		}
+	})
+
+	t.Run("Office Open XML", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		nested := buildTestDOCX(t)
+		input := buildTestZip(t,
+			testZipEntry{ooxmlContentTypesPath, zip.Deflate, testOOXMLContentTypes},
+			testZipEntry{"_rels/.rels", zip.Deflate, testOOXMLRels},
+			testZipEntry{"word/document.xml", zip.Deflate, testOOXMLDocument},
+			testZipEntry{"word/media/image1.jpeg", zip.Store, string(photo)},
+			testZipEntry{"word/embeddings/Microsoft_Word_Document.docx", zip.Store, string(nested)},
+		)
+
+		_, entries := runStripOpenXML(t, proc, input)
+		if strings.Contains(entries["word/media/image1.jpeg"].data, "GPS") {
+			t.Error("EXIF was not removed from word/media/image1.jpeg")
+		}
+
+		embedded := entries["word/embeddings/Microsoft_Word_Document.docx"].data
+		for _, entry := range readTestZip(t, []byte(embedded)) {
+			if strings.Contains(entry.data, "Jane Doe") || entry.name == "docProps/custom.xml" {
+				t.Errorf("Embedded document part %s was not cleaned", entry.name)
+			}
+		}
+
+		for _, field := range []string{"EXIF", "Author", "Custom property"} {
+			if proc.Stats.ByMetadataType[field] == nil {
+				t.Errorf("%s was not reported in statistics", field)
+			}
+		}
+	})
+
+	t.Run("Damaged part", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		damaged := buildTestPNG(t, [][]byte{testPNGChunk("tEXt", []byte("Author\x00Jane Doe"))}, nil)
+		damaged[len(damaged)-13] ^= 0xFF // Last byte of the IDAT CRC
+		input := buildTestZip(t,
+			testZipEntry{ooxmlContentTypesPath, zip.Deflate, testOOXMLContentTypes},
+			testZipEntry{"_rels/.rels", zip.Deflate, testOOXMLRels},
+			testZipEntry{"word/document.xml", zip.Deflate, testOOXMLDocument},
+			testZipEntry{"word/media/image1.png", zip.Store, string(damaged)},
+			testZipEntry{"word/media/image2.jpeg", zip.Store, string(photo)},
+		)
+
+		_, entries := runStripOpenXML(t, proc, input)
+		if entries["word/media/image1.png"].data != string(damaged) {
+			t.Error("Damaged image was changed")
+		}
+		if strings.Contains(entries["word/media/image2.jpeg"].data, "GPS") {
+			t.Error("Other parts were not cleaned")
+		}
+		if proc.Stats.ByMetadataType["Author"] != nil {
+			t.Error("Metadata of the damaged image was reported as removed")
+		}
+
+		odf := buildTestZip(t,
+			testZipEntry{"mimetype", zip.Store, "application/vnd.oasis.opendocument.text"},
+			testZipEntry{"content.xml", zip.Deflate, "<office:document-content/>"},
+			testZipEntry{"Pictures/1000000000000001.png", zip.Store, string(damaged)},
+		)
+		r, err := zip.NewReader(bytes.NewReader(odf), int64(len(odf)))
+		if err != nil {
+			t.Fatalf("Failed to read test document: %v", err)
+		}
+		var out bytes.Buffer
+		if err := proc.stripOpenDocument(r, &out); err != nil {
+			t.Fatalf("stripOpenDocument failed: %v", err)
+		}
+		if entries := readTestZip(t, out.Bytes()); entries[2].data != string(damaged) {
+			t.Error("Damaged picture was changed")
+		}
+	})
+
+	t.Run("Legacy Office", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		output, ok, err := proc.stripEmbedded("word/embeddings/Microsoft_Word_97_-_2003_Document.doc", buildTestDOC(t))
+		if err != nil || !ok {
+			t.Fatalf("stripEmbedded failed: %v", err)
+		}
+		if bytes.Contains(output, []byte("Jane Doe")) || proc.Stats.ByMetadataType["Author"] == nil {
+			t.Error("Embedded legacy document was not cleaned")
+		}
+
+		output, ok, err = proc.stripEmbedded("word/embeddings/oleObject1.bin", buildTestDOC(t))
+		if err != nil || !ok || bytes.Contains(output, []byte("Jane Doe")) {
+			t.Errorf("OLE object was not cleaned: %v", err)
+		}
+		if _, ok, err := proc.stripEmbedded("word/printerSettings/printerSettings1.bin", []byte("DEVMODE")); ok || err != nil {
+			t.Errorf("Printer settings were treated as a compound file: %v", err)
+		}
+	})
+
+	t.Run("OpenDocument", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestZip(t,
+			testZipEntry{"mimetype", zip.Store, "application/vnd.oasis.opendocument.text"},
+			testZipEntry{"content.xml", zip.Deflate, "<office:document-content/>"},
+			testZipEntry{"Pictures/10000000000001.jpg", zip.Store, string(photo)},
+		)
+		r, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+		if err != nil {
+			t.Fatalf("Failed to read test document: %v", err)
+		}
+		var out bytes.Buffer
+		if err := proc.stripOpenDocument(r, &out); err != nil {
+			t.Fatalf("stripOpenDocument failed: %v", err)
+		}
+		if entries := readTestZip(t, out.Bytes()); strings.Contains(entries[2].data, "GPS") {
+			t.Error("EXIF was not removed from the embedded picture")
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package processor
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+const (
+	spreadsheetNamespace         = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	spreadsheetThreadedNamespace = "http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments"
+	spreadsheetAbsPathNamespace  = "http://schemas.microsoft.com/office/spreadsheetml/2010/11/ac"
+	spreadsheetRevisionNamespace = "http://schemas.microsoft.com/office/spreadsheetml/2014/revision"
+)
+
+// connectionCredentialKeys are the connection string keys that name or
+// authenticate the user. The value tells whether the key holds the user name.
+var connectionCredentialKeys = map[string]bool{
+	"user id":        true,
+	"uid":            true,
+	"user":           true,
+	"user name":      true,
+	"username":       true,
+	"workstation id": true,
+	"password":       false,
+	"pwd":            false,
+}
+
+// connectionPathKeys are the connection string keys that may hold the path of
+// a data source file or folder
+var connectionPathKeys = map[string]bool{
+	"data source": true,
+	"dbq":         true,
+	"defaultdir":  true,
+}
+
+// referenceFolder matches the folder of a workbook named in a formula
+// reference, such as the C:\Users\jane\ of 'C:\Users\jane\[rates.xlsx]Sheet1'!$A$1
+var referenceFolder = regexp.MustCompile(`(?:[A-Za-z]:[\\/]|\\\\|[A-Za-z]+://)[^'"\[\]!]*[\\/]`)
+
+// cleanSpreadsheet removes the metadata SpreadsheetML keeps outside the
+// document properties. The workbook loses its file version, its absolute path
+// and its revision pointer; people and comment authors are anonymized; pivot
+// caches lose who refreshed them. External link targets, the workbooks of
+// pivot cache sources, data source files and the workbooks named in defined
+// names are cut down to their file names and connection strings lose their
+// credentials, unless the policy keeps external paths. Each part is recognized
+// by its root element, as Excel does not fix the part names.
+func (p *Processor) cleanSpreadsheet(pkg *ooxmlPackage, main string) error {
+	dir := path.Dir(main) + "/"
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] || !strings.HasPrefix(part.name, dir) || !strings.HasSuffix(strings.ToLower(part.name), ".xml") {
+			continue
+		}
+
+		var err error
+		switch root := xmlRootName(part.data); {
+		case part.name == main:
+			part.data, err = p.cleanSpreadsheetWorkbook(part.data)
+		case root.Space == spreadsheetNamespace && root.Local == "comments":
+			part.data, err = p.cleanSpreadsheetComments(part.data)
+		case root.Space == spreadsheetThreadedNamespace && root.Local == "ThreadedComments":
+			part.data, err = p.removeOOXMLAttrs(part.data, map[string]string{"dT": ""})
+		case root.Space == spreadsheetThreadedNamespace && root.Local == "personList":
+			part.data, err = p.cleanSpreadsheetPersons(part.data)
+		case root.Space == spreadsheetNamespace && root.Local == "pivotCacheDefinition":
+			part.data, err = p.removeOOXMLAttrs(part.data, map[string]string{
+				"refreshedBy":      "Pivot cache refreshed by",
+				"refreshedDate":    "",
+				"refreshedDateIso": "",
+			})
+			if err == nil && !p.Policy.KeepExternalPaths {
+				err = p.cleanExternalLinkTargets(pkg, part.name)
+			}
+		case root.Space == spreadsheetNamespace && root.Local == "externalLink" && !p.Policy.KeepExternalPaths:
+			err = p.cleanExternalLinkTargets(pkg, part.name)
+		case root.Space == spreadsheetNamespace && root.Local == "connections" && !p.Policy.KeepExternalPaths:
+			part.data, err = p.cleanSpreadsheetConnections(part.data)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+	}
+	return nil
+}
+
+// cleanSpreadsheetWorkbook removes the workbook elements that describe the
+// author's copy of the file, and the folders of workbooks named in defined names
+func (p *Processor) cleanSpreadsheetWorkbook(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			switch {
+			case e.is(spreadsheetNamespace, "fileVersion"):
+				app, _ := e.attr("", "appName")
+				build, _ := e.attr("", "rupBuild")
+				p.Stats.AddMetadata(stats.TypeDocument, "File version", metadataExample(strings.TrimSpace(app+" "+build)))
+				return xmlDrop
+			case e.is(spreadsheetAbsPathNamespace, "absPath"):
+				folder, _ := e.attr("", "url")
+				p.Stats.AddMetadata(stats.TypeDocument, "File path", metadataExample(folder))
+				return xmlDrop
+			case e.is(spreadsheetRevisionNamespace, "revisionPtr"):
+				id, _ := e.attr("", "documentId")
+				p.Stats.AddMetadata(stats.TypeDocument, "Document ID", metadataExample(id))
+				return xmlDrop
+			case e.is(spreadsheetNamespace, "fileSharing"):
+				kept := e.attrs[:0:0]
+				for _, attr := range e.attrs {
+					if attr.Name.Space == "" && attr.Name.Local == "userName" {
+						p.Stats.AddMetadata(stats.TypeDocument, "File sharing user", metadataExample(attr.Value))
+						continue
+					}
+					kept = append(kept, attr)
+				}
+				e.attrs = kept
+			}
+			return xmlKeep
+		},
+		text: func(e *xmlElement, data string) (string, bool) {
+			if !e.is(spreadsheetNamespace, "definedName") || p.Policy.KeepExternalPaths {
+				return "", false
+			}
+			cleaned := referenceFolder.ReplaceAllString(data, "")
+			if cleaned == data {
+				return "", false
+			}
+			name, _ := e.attr("", "name")
+			p.Stats.AddMetadata(stats.TypeDocument, "Defined name path", metadataExample(name+"="+data))
+			return cleaned, true
+		},
+	})
+}
+
+// cleanSpreadsheetComments renames the authors of legacy comments, including
+// the author line Excel writes at the start of each comment
+func (p *Processor) cleanSpreadsheetComments(data []byte) ([]byte, error) {
+	authors := make(map[string]bool)
+	return rewriteXML(data, xmlRules{
+		text: func(e *xmlElement, data string) (string, bool) {
+			switch {
+			case e.is(spreadsheetNamespace, "author") && data != wordAnonymousAuthor:
+				p.Stats.AddMetadata(stats.TypeDocument, "Comment author", metadataExample(data))
+				authors[data] = true
+				return wordAnonymousAuthor, true
+			case e.is(spreadsheetNamespace, "t") && strings.HasSuffix(data, ":") && authors[strings.TrimSuffix(data, ":")]:
+				return wordAnonymousAuthor + ":", true
+			}
+			return "", false
+		},
+	})
+}
+
+// cleanSpreadsheetPersons anonymizes the people threaded comments refer to.
+// Their IDs are kept so the comments stay attached to them.
+func (p *Processor) cleanSpreadsheetPersons(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if !e.is(spreadsheetThreadedNamespace, "person") {
+				return xmlKeep
+			}
+			kept := e.attrs[:0:0]
+			for _, attr := range e.attrs {
+				if attr.Name.Space == "" {
+					switch attr.Name.Local {
+					case "displayName":
+						p.Stats.AddMetadata(stats.TypeDocument, "Person", metadataExample(attr.Value))
+						attr.Value = wordAnonymousAuthor
+					case "userId", "providerId":
+						continue
+					}
+				}
+				kept = append(kept, attr)
+			}
+			e.attrs = kept
+			return xmlKeep
+		},
+	})
+}
+
+// cleanExternalLinkTargets cuts the external targets of an external link or a
+// pivot cache down to the file name, so Excel looks for the linked workbook
+// next to this one
+func (p *Processor) cleanExternalLinkTargets(pkg *ooxmlPackage, source string) error {
+	part := pkg.part(ooxmlRelsPath(source))
+	if part == nil {
+		return nil
+	}
+	data, err := rewriteXML(part.data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if !e.is(ooxmlRelsNamespace, "Relationship") {
+				return xmlKeep
+			}
+			if mode, _ := e.attr("", "TargetMode"); mode != "External" {
+				return xmlKeep
+			}
+			for i, attr := range e.attrs {
+				if attr.Name.Space == "" && attr.Name.Local == "Target" {
+					if name := (&url.URL{Path: externalFileName(attr.Value)}).String(); name != attr.Value {
+						p.Stats.AddMetadata(stats.TypeDocument, "External link path", metadataExample(attr.Value))
+						e.attrs[i].Value = name
+					}
+				}
+			}
+			return xmlKeep
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+	}
+	part.data = data
+	return nil
+}
+
+// cleanSpreadsheetConnections removes credentials from connection strings and
+// cuts the paths of data source files down to their names
+func (p *Processor) cleanSpreadsheetConnections(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			for i, attr := range e.attrs {
+				if attr.Name.Space != "" {
+					continue
+				}
+				switch attr.Name.Local {
+				case "connection":
+					cleaned, user := removeConnectionCredentials(attr.Value)
+					if cleaned != attr.Value {
+						p.Stats.AddMetadata(stats.TypeDocument, "Connection credentials", metadataExample(user))
+					}
+					cleaned, paths := cutConnectionPaths(cleaned)
+					for _, source := range paths {
+						p.Stats.AddMetadata(stats.TypeDocument, "Data source path", metadataExample(source))
+					}
+					e.attrs[i].Value = cleaned
+				case "odcFile", "sourceFile":
+					if name := externalFileName(attr.Value); name != attr.Value {
+						p.Stats.AddMetadata(stats.TypeDocument, "Data source path", metadataExample(attr.Value))
+						e.attrs[i].Value = name
+					}
+				}
+			}
+			return xmlKeep
+		},
+	})
+}
+
+// removeConnectionCredentials drops the user and password keys from an OLE DB
+// or ODBC connection string. It returns the user name that was removed.
+func removeConnectionCredentials(connection string) (string, string) {
+	var kept []string
+	user := ""
+	for _, pair := range strings.Split(connection, ";") {
+		fields := strings.SplitN(pair, "=", 2)
+		isUser, ok := connectionCredentialKeys[strings.ToLower(strings.TrimSpace(fields[0]))]
+		if ok {
+			if isUser && len(fields) == 2 {
+				user = strings.TrimSpace(fields[1])
+			}
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	return strings.Join(kept, ";"), user
+}
+
+// cutConnectionPaths cuts the file and folder paths of a connection string down
+// to their last segment. Server names, including named instances such as
+// SQL01\Finance, are not paths and are kept. It returns the paths that were cut.
+func cutConnectionPaths(connection string) (string, []string) {
+	pairs := strings.Split(connection, ";")
+	var paths []string
+	for i, pair := range pairs {
+		fields := strings.SplitN(pair, "=", 2)
+		if len(fields) != 2 || !connectionPathKeys[strings.ToLower(strings.TrimSpace(fields[0]))] {
+			continue
+		}
+		value := strings.TrimSpace(fields[1])
+		quote := ""
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			quote, value = value[:1], value[1:len(value)-1]
+		}
+		if !isAbsolutePath(value) {
+			continue
+		}
+		paths = append(paths, value)
+		name := strings.TrimRight(value, `/\`)
+		pairs[i] = fields[0] + "=" + quote + name[strings.LastIndexAny(name, `/\`)+1:] + quote
+	}
+	return strings.Join(pairs, ";"), paths
+}
+
+// isAbsolutePath reports whether a value is an absolute Windows, UNC or Unix path
+func isAbsolutePath(value string) bool {
+	return strings.HasPrefix(value, `\\`) || strings.HasPrefix(value, "/") ||
+		(len(value) >= 3 && value[1] == ':' && (value[2] == '\\' || value[2] == '/'))
+}
+
+// externalFileName returns the last segment of a path or URL
+func externalFileName(target string) string {
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	if i := strings.LastIndexAny(target, `/\`); i >= 0 {
+		return target[i+1:]
+	}
+	return target
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+)
+
+const testExcelWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" xmlns:x15ac="http://schemas.microsoft.com/office/spreadsheetml/2010/11/ac" xmlns:xr="http://schemas.microsoft.com/office/spreadsheetml/2014/revision" mc:Ignorable="x15ac xr">` +
+	`<fileVersion appName="xl" lastEdited="7" lowestEdited="7" rupBuild="27328"/>` +
+	`<fileSharing readOnlyRecommended="1" userName="Jane Doe"/>` +
+	`<workbookPr defaultThemeVersion="166925"/>` +
+	`<mc:AlternateContent><mc:Choice Requires="x15"><x15ac:absPath url="C:\Users\jane\Documents\Finance\"/></mc:Choice></mc:AlternateContent>` +
+	`<xr:revisionPtr revIDLastSave="0" documentId="8_{0C3D7A10-1B2C-4D5E-8F90-A1B2C3D4E5F6}" xr6:coauthVersionLast="47" xmlns:xr6="http://schemas.microsoft.com/office/spreadsheetml/2016/revision6"/>` +
+	`<sheets><sheet name="Budget" sheetId="1" r:id="rId1"/></sheets>` +
+	`<definedNames><definedName name="Rates">'C:\Users\jane\[rates.xlsx]Sheet1'!$A$1</definedName><definedName name="Total">Budget!$B$10</definedName></definedNames>` +
+	`</workbook>`
+
+const testExcelComments = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<comments xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><authors><author>Jane Doe</author></authors><commentList><comment ref="B2" authorId="0"><text><r><rPr><b/></rPr><t>Jane Doe:</t></r><r><t xml:space="preserve">
+Check this rate</t></r></text></comment></commentList></comments>`
+
+const testExcelPersons = `<personList xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments"><person displayName="Jane Doe" id="{11111111-2222-3333-4444-555555555555}" userId="jane.doe@acme.com" providerId="AD"/></personList>`
+
+const testExcelThreaded = `<ThreadedComments xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments"><threadedComment ref="B2" dT="2024-03-01T10:00:00.00" personId="{11111111-2222-3333-4444-555555555555}" id="{AAAA0000-0000-0000-0000-000000000000}"><text>Check this rate</text></threadedComment></ThreadedComments>`
+
+const testExcelPivotCache = `<pivotCacheDefinition xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" refreshedBy="John Roe" refreshedDate="45352.4" createdVersion="8" refreshedVersion="8" recordCount="2"><cacheSource type="external" connectionId="1"/></pivotCacheDefinition>`
+
+const testExcelConnections = `<connections xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><connection id="1" name="Payroll" type="5" odcFile="C:\Users\jane\Documents\My Data Sources\payroll.odc"><dbPr connection="Provider=SQLOLEDB.1;User ID=jdoe;Password=hunter2;Data Source=SQL01\Finance;Initial Catalog=Payroll" command="Payroll" commandType="3"/></connection>` +
+	`<connection id="2" name="Sales" type="1"><dbPr connection="DSN=MS Access Database;DBQ=C:\Users\jane\Access\sales.accdb;DefaultDir=C:\Users\jane\Access;DriverId=25" command="SELECT * FROM Orders"/></connection>` +
+	`<connection id="3" name="Orders" type="5"><dbPr connection="Provider=Microsoft.ACE.OLEDB.12.0;Data Source='\\fs01\jane\orders.accdb';Mode=Share Deny Write" command="Orders"/></connection></connections>`
+
+const testExcelPivotSource = `<pivotCacheDefinition xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><cacheSource type="worksheet"><worksheetSource ref="A1:C20" sheet="Sales" r:id="rId1"/></cacheSource></pivotCacheDefinition>`
+
+const testExcelExternalLinkRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/externalLinkPath" Target="file:///\\fileserver\finance\jane\Rates%202024.xlsx" TargetMode="External"/></Relationships>`
+
+// buildTestExcelXLSX builds a workbook with Excel-specific metadata
+func buildTestExcelXLSX(t *testing.T) []byte {
+	return buildTestZip(t,
+		testZipEntry{ooxmlContentTypesPath, zip.Deflate, `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="xml" ContentType="application/xml"/></Types>`},
+		testZipEntry{"_rels/.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		testZipEntry{"xl/workbook.xml", zip.Deflate, testExcelWorkbook},
+		testZipEntry{"xl/comments1.xml", zip.Deflate, testExcelComments},
+		testZipEntry{"xl/persons/person.xml", zip.Deflate, testExcelPersons},
+		testZipEntry{"xl/threadedComments/threadedComment1.xml", zip.Deflate, testExcelThreaded},
+		testZipEntry{"xl/pivotCache/pivotCacheDefinition1.xml", zip.Deflate, testExcelPivotCache},
+		testZipEntry{"xl/pivotCache/pivotCacheDefinition2.xml", zip.Deflate, testExcelPivotSource},
+		testZipEntry{"xl/pivotCache/_rels/pivotCacheDefinition2.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/externalLinkPath" Target="file:///C:\Users\jane\Documents\sales.xlsx" TargetMode="External"/></Relationships>`},
+		testZipEntry{"xl/connections.xml", zip.Deflate, testExcelConnections},
+		testZipEntry{"xl/externalLinks/externalLink1.xml", zip.Deflate, `<externalLink xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><externalBook r:id="rId1"/></externalLink>`},
+		testZipEntry{"xl/externalLinks/_rels/externalLink1.xml.rels", zip.Deflate, testExcelExternalLinkRels},
+	)
+}
+
+func TestCleanSpreadsheet(t *testing.T) {
+	t.Run("Default policy", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		_, entries := runStripOpenXML(t, proc, buildTestExcelXLSX(t))
+
+		workbook := entries["xl/workbook.xml"].data
+		for _, leak := range []string{"fileVersion", "rupBuild", "absPath", "revisionPtr", "8_{0C3D", "Jane", "jane"} {
+			if strings.Contains(workbook, leak) {
+				t.Errorf("workbook.xml still contains %q", leak)
+			}
+		}
+		for _, kept := range []string{`<fileSharing readOnlyRecommended="1"/>`, `<mc:Choice Requires="x15"></mc:Choice>`, `<sheet name="Budget" sheetId="1" r:id="rId1"/>`, `&#39;[rates.xlsx]Sheet1&#39;!$A$1`} {
+			if !strings.Contains(workbook, kept) {
+				t.Errorf("workbook.xml lost %q", kept)
+			}
+		}
+
+		comments := entries["xl/comments1.xml"].data
+		if strings.Contains(comments, "Jane") || !strings.Contains(comments, "<author>Author</author>") || !strings.Contains(comments, "<t>Author:</t>") || !strings.Contains(comments, "Check this rate") {
+			t.Errorf("Comment authors were not anonymized:\n%s", comments)
+		}
+
+		persons := entries["xl/persons/person.xml"].data
+		if persons != `<personList xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments"><person displayName="Author" id="{11111111-2222-3333-4444-555555555555}"/></personList>` {
+			t.Errorf("Persons were not anonymized:\n%s", persons)
+		}
+		if threaded := entries["xl/threadedComments/threadedComment1.xml"].data; strings.Contains(threaded, "dT=") || !strings.Contains(threaded, "personId=") {
+			t.Errorf("Unexpected threaded comments:\n%s", threaded)
+		}
+		if pivot := entries["xl/pivotCache/pivotCacheDefinition1.xml"].data; strings.Contains(pivot, "John") || strings.Contains(pivot, "refreshedDate") || !strings.Contains(pivot, `refreshedVersion="8"`) {
+			t.Errorf("Unexpected pivot cache:\n%s", pivot)
+		}
+
+		connections := entries["xl/connections.xml"].data
+		for _, expected := range []string{
+			`odcFile="payroll.odc"`,
+			`connection="Provider=SQLOLEDB.1;Data Source=SQL01\Finance;Initial Catalog=Payroll"`,
+			`connection="DSN=MS Access Database;DBQ=sales.accdb;DefaultDir=Access;DriverId=25"`,
+			`connection="Provider=Microsoft.ACE.OLEDB.12.0;Data Source=&#39;orders.accdb&#39;;Mode=Share Deny Write"`,
+		} {
+			if !strings.Contains(connections, expected) {
+				t.Errorf("Connections do not contain %s:\n%s", expected, connections)
+			}
+		}
+		if rels := entries["xl/pivotCache/_rels/pivotCacheDefinition2.xml.rels"].data; !strings.Contains(rels, `Target="sales.xlsx"`) {
+			t.Errorf("Pivot cache source path was not removed:\n%s", rels)
+		}
+		if rels := entries["xl/externalLinks/_rels/externalLink1.xml.rels"].data; !strings.Contains(rels, `Target="Rates%202024.xlsx"`) {
+			t.Errorf("External link path was not removed:\n%s", rels)
+		}
+
+		for _, field := range []string{"File version", "File path", "Document ID", "File sharing user", "Defined name path", "Comment author", "Person", "Pivot cache refreshed by", "Connection credentials", "Data source path", "External link path"} {
+			if proc.Stats.ByMetadataType[field] == nil {
+				t.Errorf("%s was not reported in statistics", field)
+			}
+		}
+		if field := proc.Stats.ByMetadataType["Connection credentials"]; field != nil && field.Examples[0] != "jdoe" {
+			t.Errorf("Unexpected connection example %q", field.Examples[0])
+		}
+	})
+
+	t.Run("Keep external paths", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepExternalPaths = true
+		_, entries := runStripOpenXML(t, proc, buildTestExcelXLSX(t))
+
+		if entries["xl/connections.xml"].data != testExcelConnections || entries["xl/externalLinks/_rels/externalLink1.xml.rels"].data != testExcelExternalLinkRels {
+			t.Error("External paths were changed")
+		}
+		workbook := entries["xl/workbook.xml"].data
+		if strings.Contains(workbook, "absPath") || !strings.Contains(workbook, `'C:\Users\jane\[rates.xlsx]Sheet1'!$A$1`) {
+			t.Errorf("Unexpected workbook:\n%s", workbook)
+		}
+	})
+}
+
+func TestExternalFileName(t *testing.T) {
+	for target, expected := range map[string]string{
+		`file:///C:\Users\jane\Budget.xlsx`:                              "Budget.xlsx",
+		`/Users/jane/Desktop/Budget%20Q3.xlsx`:                           "Budget Q3.xlsx",
+		`https://acme.sharepoint.com/sites/hr/Shared%20Documents/a.xlsx`: "a.xlsx",
+		`Budget.xlsx`: "Budget.xlsx",
+	} {
+		if got := externalFileName(target); got != expected {
+			t.Errorf("externalFileName(%q) = %q, want %q", target, got, expected)
+		}
+	}
+
+	cleaned, user := removeConnectionCredentials("DSN=Sales;UID=jdoe;PWD=secret;APP=Microsoft Office")
+	if cleaned != "DSN=Sales;APP=Microsoft Office" || user != "jdoe" {
+		t.Errorf("Unexpected connection string %q (user %q)", cleaned, user)
+	}
+	cleaned, paths := cutConnectionPaths(`Driver={Microsoft Access Driver (*.mdb)};DBQ=/home/jane/sales.mdb;Data Source=db01`)
+	if cleaned != `Driver={Microsoft Access Driver (*.mdb)};DBQ=sales.mdb;Data Source=db01` || len(paths) != 1 || paths[0] != "/home/jane/sales.mdb" {
+		t.Errorf("Unexpected connection string %q (paths %q)", cleaned, paths)
+	}
+}
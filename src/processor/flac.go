@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"metadata-remover/src/stats"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacApplication   = 2
+	flacSeekTable     = 3
+	flacVorbisComment = 4
+	flacCueSheet      = 5
+	flacPicture       = 6
+	flacInvalid       = 127
+)
+
+// flacBlockNames names the metadata blocks reported in statistics
+var flacBlockNames = map[byte]string{
+	flacApplication: "Application data",
+	flacCueSheet:    "Cue sheet",
+	flacPicture:     "Cover art",
+}
+
+// cleanFLAC removes metadata from FLAC files
+func (p *Processor) cleanFLAC(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripFLAC(bufio.NewReader(file), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripFLAC rewrites the metadata block chain and copies the audio frames unchanged.
+// Blocks are buffered so the last-block flag can be set on whichever block ends up last.
+func (p *Processor) stripFLAC(r io.Reader, w io.Writer) error {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return errors.New("not a valid FLAC file")
+	}
+
+	// Some taggers put an ID3v2 tag in front of the stream
+	if string(marker[:3]) == "ID3" {
+		header := make([]byte, id3v2HeaderSize)
+		copy(header, marker)
+		if _, err := io.ReadFull(r, header[4:]); err != nil {
+			return errors.New("truncated ID3v2 tag")
+		}
+		size, err := id3v2TagSize(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, r, size-id3v2HeaderSize); err != nil {
+			return errors.New("truncated ID3v2 tag")
+		}
+		p.Stats.AddMetadata(stats.TypeAudio, "ID3v2", "")
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return errors.New("not a valid FLAC file")
+		}
+	}
+	if string(marker) != "fLaC" {
+		return errors.New("not a valid FLAC file")
+	}
+
+	var blocks [][]byte
+	header := make([]byte, 4)
+	for last, first := false, true; !last; first = false {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return errors.New("truncated FLAC metadata block")
+		}
+		last = header[0]&0x80 != 0
+		typ := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		if typ == flacInvalid {
+			return errors.New("invalid FLAC metadata block type")
+		}
+		if first != (typ == flacStreamInfo) {
+			return errors.New("FLAC STREAMINFO must be the first metadata block")
+		}
+
+		keep := p.keepFLACBlock(typ)
+		if !keep {
+			if _, err := io.CopyN(io.Discard, r, length); err != nil {
+				return fmt.Errorf("truncated FLAC metadata block %d", typ)
+			}
+			p.reportFLACBlock(typ)
+			continue
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("truncated FLAC metadata block %d", typ)
+		}
+
+		if typ == flacVorbisComment {
+			vc, err := parseVorbisComment(data)
+			if err != nil {
+				return err
+			}
+			p.cleanVorbisComment(vc)
+			if len(vc.comments) == 0 {
+				continue
+			}
+			data = vc.bytes()
+		}
+
+		block := []byte{typ, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}
+		blocks = append(blocks, append(block, data...))
+	}
+
+	// Write the chain with the last-block flag on the final block
+	if _, err := w.Write(marker); err != nil {
+		return err
+	}
+	for i, block := range blocks {
+		if i == len(blocks)-1 {
+			block[0] |= 0x80
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+
+	// Audio frames follow unchanged
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// keepFLACBlock decides whether a metadata block is copied
+func (p *Processor) keepFLACBlock(typ byte) bool {
+	switch typ {
+	case flacStreamInfo, flacSeekTable:
+		return true
+	case flacVorbisComment:
+		// Comments are filtered entry by entry and the block is dropped if none are left
+		return true
+	case flacPicture:
+		return p.Policy.KeepCoverArt
+	case flacCueSheet:
+		return p.Policy.KeepCueSheet
+	default:
+		// Padding, application data and unknown blocks are dropped
+		return false
+	}
+}
+
+// reportFLACBlock records a removed metadata block in statistics
+func (p *Processor) reportFLACBlock(typ byte) {
+	if typ == flacPadding {
+		return
+	}
+	name, ok := flacBlockNames[typ]
+	if !ok {
+		name = fmt.Sprintf("FLAC block %d", typ)
+	}
+	p.Stats.AddMetadata(stats.TypeAudio, name, "")
+}
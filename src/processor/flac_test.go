@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFLACFrames stands in for the audio frames of the test files
+var testFLACFrames = []byte{0xFF, 0xF8, 0x69, 0x18, 0x00, 0x00, 0xBF, 0x03, 0x58, 0xFD, 0x03, 0x12, 0x8B}
+
+// testFLACBlock builds a metadata block without the last-block flag
+func testFLACBlock(typ byte, data []byte) []byte {
+	block := []byte{typ, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}
+	return append(block, data...)
+}
+
+// buildTestFLAC joins the blocks, setting the last-block flag on the final one
+func buildTestFLAC(blocks ...[]byte) []byte {
+	out := []byte("fLaC")
+	for i, block := range blocks {
+		block = append([]byte{}, block...)
+		if i == len(blocks)-1 {
+			block[0] |= 0x80
+		}
+		out = append(out, block...)
+	}
+	return append(out, testFLACFrames...)
+}
+
+func TestStripFLAC(t *testing.T) {
+	streamInfo := testFLACBlock(flacStreamInfo, bytes.Repeat([]byte{0x12}, 34))
+	seekTable := testFLACBlock(flacSeekTable, make([]byte, 18))
+	comments := testFLACBlock(flacVorbisComment, (&vorbisComment{
+		vendor:   "reference libFLAC 1.3.2 20170101",
+		comments: []string{"TITLE=Master 4", "ENGINEER=Jane Doe"},
+	}).bytes())
+	picture := testFLACBlock(flacPicture, []byte("\x00\x00\x00\x03image/png"))
+	application := testFLACBlock(flacApplication, []byte("riffWAVE bext data"))
+	cueSheet := testFLACBlock(flacCueSheet, []byte("CATALOG 1234567890123"))
+	padding := testFLACBlock(flacPadding, make([]byte, 64))
+
+	t.Run("Metadata blocks removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestFLAC(streamInfo, comments, seekTable, picture, application, cueSheet, padding)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripFLAC(bytes.NewReader(input), w)
+		})
+		if expected := buildTestFLAC(streamInfo, seekTable); !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+
+		for _, name := range []string{"TITLE", "ENGINEER", "Encoder", "Cover art", "Application data", "Cue sheet"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("Kept blocks follow policy", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepAudioTags = true
+		proc.Policy.KeepCoverArt = true
+		proc.Policy.KeepCueSheet = true
+		input := buildTestFLAC(streamInfo, comments, picture, cueSheet, application)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripFLAC(bytes.NewReader(input), w)
+		})
+
+		cleanComments := testFLACBlock(flacVorbisComment, (&vorbisComment{
+			comments: []string{"TITLE=Master 4", "ENGINEER=Jane Doe"},
+		}).bytes())
+		if expected := buildTestFLAC(streamInfo, cleanComments, picture, cueSheet); !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+	})
+
+	t.Run("Leading ID3v2 removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		clean := buildTestFLAC(streamInfo)
+		tag := testID3v2(3, 0, testID3Frame(3, "TIT2", []byte("\x00Master")))
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripFLAC(bytes.NewReader(append(tag, clean...)), w)
+		})
+		if !bytes.Equal(output, clean) {
+			t.Error("ID3v2 tag was not removed")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := [][]byte{
+			[]byte("not a flac file"),
+			buildTestFLAC(seekTable, streamInfo),
+			buildTestFLAC(streamInfo, testFLACBlock(flacInvalid, nil)),
+			buildTestFLAC(streamInfo, comments)[:60],
+			buildTestFLAC(streamInfo, testFLACBlock(flacVorbisComment, []byte{0xFF, 0xFF, 0, 0})),
+		}
+		for i, data := range invalid {
+			if err := proc.stripFLAC(bytes.NewReader(data), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanFLAC(t *testing.T) {
+	tempDir, proc, cleanup := setupAudioTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "master.flac")
+	input := buildTestFLAC(
+		testFLACBlock(flacStreamInfo, make([]byte, 34)),
+		testFLACBlock(flacVorbisComment, (&vorbisComment{vendor: "libFLAC", comments: []string{"PROJECT=Codename"}}).bytes()),
+	)
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessAudio(filePath, ".flac"); err != nil {
+		t.Fatalf("Failed to clean FLAC: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("Codename")) || !bytes.HasSuffix(data, testFLACFrames) {
+		t.Error("FLAC was not cleaned correctly")
+	}
+}
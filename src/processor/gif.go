@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// GIF block introducers and extension labels
+const (
+	gifExtension       = 0x21
+	gifImageDescriptor = 0x2C
+	gifTrailer         = 0x3B
+
+	gifLabelPlainText      = 0x01
+	gifLabelGraphicControl = 0xF9
+	gifLabelComment        = 0xFE
+	gifLabelApplication    = 0xFF
+)
+
+// gifAnimationApplications are the application extensions that control animation looping
+var gifAnimationApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+// cleanGIF removes metadata from GIF files
+func (p *Processor) cleanGIF(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	cleaned, err := p.stripGIF(data)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(filePath, cleaned)
+}
+
+// stripGIF rewrites a GIF block by block, dropping comment, XMP and unknown application
+// extensions while keeping images, graphic control blocks and animation looping
+func (p *Processor) stripGIF(data []byte) ([]byte, error) {
+	// Verify GIF header and logical screen descriptor
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, errors.New("not a valid GIF file")
+	}
+
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += gifColorTableSize(flags)
+	}
+	if pos > len(data) {
+		return nil, errors.New("truncated GIF color table")
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:pos]...)
+
+	for {
+		if pos >= len(data) {
+			return nil, errors.New("GIF file is missing its trailer")
+		}
+
+		start := pos
+		switch data[pos] {
+		case gifImageDescriptor:
+			if pos+11 > len(data) {
+				return nil, errors.New("truncated GIF image descriptor")
+			}
+			pos += 10
+			if flags := data[start+9]; flags&0x80 != 0 {
+				pos += gifColorTableSize(flags)
+			}
+			// LZW minimum code size followed by the image data sub-blocks
+			end, err := gifSkipSubBlocks(data, pos+1)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			out = append(out, data[start:pos]...)
+
+		case gifExtension:
+			if pos+2 > len(data) {
+				return nil, errors.New("truncated GIF extension")
+			}
+			end, err := gifSkipSubBlocks(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+
+			if p.keepGIFExtension(data[start+1], data[start+2:end]) {
+				out = append(out, data[start:end]...)
+			}
+
+		case gifTrailer:
+			out = append(out, gifTrailer)
+			if pos+1 < len(data) {
+				p.Stats.AddMetadata(stats.TypeImage, "Trailing data", "")
+			}
+			return out, nil
+
+		default:
+			return nil, fmt.Errorf("invalid GIF block introducer 0x%02X", data[pos])
+		}
+	}
+}
+
+// keepGIFExtension decides whether an extension block is kept, reporting the ones that are removed
+func (p *Processor) keepGIFExtension(label byte, blocks []byte) bool {
+	switch label {
+	case gifLabelGraphicControl, gifLabelPlainText:
+		return true
+	case gifLabelComment:
+		p.Stats.AddMetadata(stats.TypeImage, "Comment", strings.TrimSpace(string(gifSubBlockData(blocks))))
+		return false
+	case gifLabelApplication:
+		identifier := ""
+		if len(blocks) >= 12 && blocks[0] == 11 {
+			identifier = string(blocks[1:12])
+		}
+		switch {
+		case gifAnimationApplications[identifier]:
+			return true
+		case identifier == "ICCRGBG1012" && p.Policy.KeepICCProfile:
+			return true
+		case identifier == "XMP DataXMP":
+			p.Stats.AddMetadata(stats.TypeImage, "XMP", "")
+		case identifier == "ICCRGBG1012":
+			p.Stats.AddMetadata(stats.TypeImage, "ICC Profile", "")
+		default:
+			p.Stats.AddMetadata(stats.TypeImage, "GIF application extension", strings.TrimSpace(identifier))
+		}
+		return false
+	default:
+		p.Stats.AddMetadata(stats.TypeImage, fmt.Sprintf("GIF extension 0x%02X", label), "")
+		return false
+	}
+}
+
+// gifColorTableSize returns the size in bytes of the color table described by a packed field
+func gifColorTableSize(flags byte) int {
+	return 3 << ((flags & 0x07) + 1)
+}
+
+// gifSkipSubBlocks returns the position after the sub-block chain starting at pos
+func gifSkipSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errors.New("truncated GIF data sub-blocks")
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// gifSubBlockData concatenates the payload of a sub-block chain
+func gifSubBlockData(blocks []byte) []byte {
+	var payload []byte
+	for pos := 0; pos < len(blocks) && blocks[pos] != 0; {
+		end := pos + 1 + int(blocks[pos])
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		payload = append(payload, blocks[pos+1:end]...)
+		pos = end
+	}
+	return payload
+}
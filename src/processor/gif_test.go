@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGIFExtension builds an extension block with a single data sub-block per chunk
+func testGIFExtension(label byte, chunks ...[]byte) []byte {
+	block := []byte{gifExtension, label}
+	for _, chunk := range chunks {
+		block = append(block, byte(len(chunk)))
+		block = append(block, chunk...)
+	}
+	return append(block, 0)
+}
+
+// buildTestGIF encodes an animated GIF and inserts the given blocks before the trailer
+func buildTestGIF(t *testing.T, frames int, blocks ...[]byte) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{LoopCount: 0}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+		frame.SetColorIndex(i%4, i%4, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("Failed to encode test GIF: %v", err)
+	}
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:len(data)-1]...)
+	for _, block := range blocks {
+		out = append(out, block...)
+	}
+	return append(out, gifTrailer)
+}
+
+func TestStripGIF(t *testing.T) {
+	comment := testGIFExtension(gifLabelComment, []byte("Created with "), []byte("SecretTool by Jane"))
+	xmp := testGIFExtension(gifLabelApplication, []byte("XMP DataXMP"), []byte("<x:xmpmeta>author</x:xmpmeta>"))
+	unknown := testGIFExtension(gifLabelApplication, []byte("ACMECORP1.0"), []byte("tracking id"))
+
+	t.Run("Animated GIF", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestGIF(t, 3, comment, xmp, unknown)
+
+		output, err := proc.stripGIF(input)
+		if err != nil {
+			t.Fatalf("stripGIF failed: %v", err)
+		}
+
+		for _, leaked := range []string{"SecretTool", "xmpmeta", "ACMECORP", "tracking id"} {
+			if bytes.Contains(output, []byte(leaked)) {
+				t.Errorf("Output still contains %q", leaked)
+			}
+		}
+		if !bytes.Contains(output, []byte("NETSCAPE2.0")) {
+			t.Error("NETSCAPE2.0 looping extension was removed")
+		}
+
+		decoded, err := gif.DecodeAll(bytes.NewReader(output))
+		if err != nil {
+			t.Fatalf("Cleaned GIF does not decode: %v", err)
+		}
+		if len(decoded.Image) != 3 {
+			t.Errorf("Expected 3 frames, got %d", len(decoded.Image))
+		}
+		if decoded.LoopCount != 0 || decoded.Delay[0] != 10 {
+			t.Errorf("Animation settings changed: loop %d, delay %d", decoded.LoopCount, decoded.Delay[0])
+		}
+
+		if field := proc.Stats.ByMetadataType["Comment"]; field == nil || field.Examples[0] != "Created with SecretTool by Jane" {
+			t.Error("Comment was not reported in statistics")
+		}
+		if proc.Stats.ByMetadataType["XMP"] == nil {
+			t.Error("XMP was not reported in statistics")
+		}
+	})
+
+	t.Run("Clean GIF unchanged", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestGIF(t, 1)
+
+		output, err := proc.stripGIF(input)
+		if err != nil {
+			t.Fatalf("stripGIF failed: %v", err)
+		}
+		if !bytes.Equal(input, output) {
+			t.Error("GIF without metadata was modified")
+		}
+	})
+
+	t.Run("Trailing data dropped", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := append(buildTestGIF(t, 1), []byte("appended payload")...)
+
+		output, err := proc.stripGIF(input)
+		if err != nil {
+			t.Fatalf("stripGIF failed: %v", err)
+		}
+		if output[len(output)-1] != gifTrailer || bytes.Contains(output, []byte("appended")) {
+			t.Error("Data after the trailer was not removed")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		valid := buildTestGIF(t, 1)
+		invalid := [][]byte{
+			[]byte("GIF89a"),
+			[]byte("NOTAGIF000000000"),
+			valid[:len(valid)-1],
+			append(append([]byte{}, valid[:len(valid)-1]...), 0x99),
+		}
+		for _, data := range invalid {
+			if _, err := proc.stripGIF(data); err == nil {
+				t.Errorf("Expected error for %q", data)
+			}
+		}
+	})
+}
+
+func TestCleanGIF(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "banner.gif")
+	input := buildTestGIF(t, 2, testGIFExtension(gifLabelComment, []byte("author: someone")))
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".gif"); err != nil {
+		t.Fatalf("Failed to clean GIF: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("someone")) {
+		t.Error("Comment extension still present after cleaning")
+	}
+}
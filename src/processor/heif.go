@@ -0,0 +1,655 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"metadata-remover/src/stats"
+)
+
+// heifItem is an entry from the item information box
+type heifItem struct {
+	id          uint32
+	typ         string
+	contentType string
+	box         bmffBox
+}
+
+// heifExtent is one extent of an item location
+type heifExtent struct {
+	index  uint64
+	offset uint64
+	length uint64
+}
+
+// heifLocation is an entry from the item location box
+type heifLocation struct {
+	id                 uint32
+	constructionMethod uint16
+	dataRefIndex       uint16
+	baseOffset         uint64
+	extents            []heifExtent
+}
+
+// heifItemLocations is a parsed item location box
+type heifItemLocations struct {
+	version        uint8
+	flags          []byte
+	offsetSize     int
+	lengthSize     int
+	baseOffsetSize int
+	indexSize      int
+	items          []heifLocation
+}
+
+// heifRange is a byte range in the original file
+type heifRange struct {
+	start, end int64
+}
+
+// cleanHEIF removes metadata from HEIC, HEIF and AVIF files
+func (p *Processor) cleanHEIF(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	cleaned, err := p.stripHEIF(data)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(filePath, cleaned)
+}
+
+// stripHEIF removes Exif and XMP items from the item tables of the top-level meta box,
+// cuts their data out of mdat or idat and shifts the remaining item locations to match.
+// The moov box of an image sequence is cleaned as in MP4 files.
+func (p *Processor) stripHEIF(data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	boxes, err := readBMFFBoxes(r, 0, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(boxes) == 0 || boxes[0].typ != "ftyp" {
+		return nil, errors.New("not a valid HEIF file")
+	}
+
+	meta, ok := findBMFFBox(boxes, "meta")
+	if !ok {
+		return data, nil
+	}
+	if meta.payloadSize() < 4 {
+		return nil, errors.New("invalid HEIF meta box")
+	}
+	children, err := readBMFFBoxes(r, meta.payloadStart()+4, meta.end)
+	if err != nil {
+		return nil, err
+	}
+
+	iinf, hasIINF := findBMFFBox(children, "iinf")
+	iloc, hasILOC := findBMFFBox(children, "iloc")
+	if !hasIINF || !hasILOC {
+		return data, nil
+	}
+
+	items, err := parseHEIFItems(data, iinf)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := parseHEIFLocations(data[iloc.payloadStart():iloc.end])
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick the metadata items
+	removed := make(map[uint32]bool)
+	for _, item := range items {
+		switch {
+		case item.typ == "Exif":
+			p.Stats.AddMetadata(stats.TypeImage, "EXIF", "")
+			removed[item.id] = true
+		case item.contentType == "application/rdf+xml":
+			p.Stats.AddMetadata(stats.TypeImage, "XMP", "")
+			removed[item.id] = true
+		}
+	}
+	if len(removed) == 0 {
+		return data, nil
+	}
+
+	idat, hasIDAT := findBMFFBox(children, "idat")
+	holes := heifHoles(locations, removed, boxes, idat, hasIDAT)
+
+	// Image sequences find their samples through the chunk offsets of a moov
+	// box, which may point anywhere in mdat. The data of removed items in mdat
+	// is then blanked rather than cut, so that only the meta box changes size
+	// and the chunk offsets move with mdat as a whole.
+	moov, hasMOOV := findBMFFBox(boxes, "moov")
+	var rb *mp4Rebuild
+	if hasMOOV {
+		data = append([]byte(nil), data...)
+		var cut []heifRange
+		for _, hole := range holes {
+			if hasIDAT && hole.start >= idat.payloadStart() && hole.end <= idat.end {
+				cut = append(cut, hole)
+				continue
+			}
+			copy(data[hole.start:hole.end], make([]byte, hole.end-hole.start))
+		}
+		holes = cut
+
+		rb = &mp4Rebuild{fileType: stats.TypeImage}
+		moovBox := bmffBox{typ: "moov", headerSize: moov.headerSize, end: moov.end - moov.start}
+		if err := p.rebuildMP4Box(rb, data[moov.start:moov.end], moovBox); err != nil {
+			return nil, err
+		}
+	}
+
+	// Rebuild the meta children, leaving the item locations for last since
+	// their offsets depend on the final layout
+	var kept []heifLocation
+	for _, loc := range locations.items {
+		if !removed[loc.id] {
+			kept = append(kept, loc)
+		}
+	}
+	locations.items = kept
+
+	rebuilt := make([][]byte, len(children))
+	for i, child := range children {
+		switch child.typ {
+		case "iinf":
+			rebuilt[i], err = rebuildHEIFItemInfo(data, child, items, removed)
+		case "iref":
+			rebuilt[i], err = rebuildHEIFReferences(data, child, removed)
+		case "iprp":
+			rebuilt[i], err = rebuildHEIFProperties(data, child, removed)
+		case "idat":
+			rebuilt[i] = appendBMFFBox(nil, "idat", cutHEIFHoles(data, child.payloadStart(), child.end, holes))
+		case "iloc":
+			// Field sizes are fixed, so encoding the original offsets reserves the
+			// right size; the real offsets are filled in once the boxes are placed
+			var encoded []byte
+			encoded, err = encodeHEIFLocations(locations, func(loc heifLocation, offset uint64) (uint64, error) {
+				return offset, nil
+			})
+			rebuilt[i] = appendBMFFBox(nil, "iloc", encoded)
+		default:
+			rebuilt[i] = data[child.start:child.end]
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metaSize := int64(4)
+	for _, child := range rebuilt {
+		metaSize += int64(len(child))
+	}
+
+	// Place the top-level boxes and work out where each one's payload starts
+	newPayloadStart := make([]int64, len(boxes))
+	pos := int64(0)
+	for i, box := range boxes {
+		switch {
+		case box.start == meta.start:
+			newPayloadStart[i] = pos + int64(len(bmffHeader("meta", metaSize)))
+			pos = newPayloadStart[i] + metaSize
+		case hasMOOV && box.start == moov.start:
+			pos += int64(len(rb.out))
+		default:
+			payloadSize := box.payloadSize() - heifHoleBytes(holes, box.payloadStart(), box.end)
+			newPayloadStart[i] = pos + int64(len(bmffHeader(box.typ, payloadSize)))
+			pos = newPayloadStart[i] + payloadSize
+		}
+	}
+
+	// mapOffset moves a file offset into the new layout
+	mapOffset := func(offset uint64) (uint64, error) {
+		old := int64(offset)
+		for i, box := range boxes {
+			if old < box.payloadStart() || old > box.end || box.start == meta.start || (hasMOOV && box.start == moov.start) {
+				continue
+			}
+			return uint64(newPayloadStart[i] + old - box.payloadStart() - heifHoleBytes(holes, box.payloadStart(), old)), nil
+		}
+		return 0, fmt.Errorf("unsupported HEIF item location at offset %d", offset)
+	}
+
+	encoded, err := encodeHEIFLocations(locations, func(loc heifLocation, offset uint64) (uint64, error) {
+		switch loc.constructionMethod {
+		case 0:
+			return mapOffset(offset)
+		case 1:
+			if !hasIDAT {
+				return 0, errors.New("HEIF item refers to a missing idat box")
+			}
+			start := idat.payloadStart()
+			return offset - uint64(heifHoleBytes(holes, start, start+int64(offset))), nil
+		default:
+			return offset, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, child := range children {
+		if child.typ == "iloc" {
+			rebuilt[i] = appendBMFFBox(nil, "iloc", encoded)
+		}
+	}
+	if hasMOOV {
+		if err := rb.remapChunkOffsets(mapOffset); err != nil {
+			return nil, err
+		}
+	}
+
+	// Assemble the file
+	out := make([]byte, 0, len(data))
+	for _, box := range boxes {
+		if box.start == meta.start {
+			out = append(out, bmffHeader("meta", metaSize)...)
+			out = append(out, data[meta.payloadStart():meta.payloadStart()+4]...)
+			for _, child := range rebuilt {
+				out = append(out, child...)
+			}
+			continue
+		}
+		if hasMOOV && box.start == moov.start {
+			out = append(out, rb.out...)
+			continue
+		}
+		payload := cutHEIFHoles(data, box.payloadStart(), box.end, holes)
+		out = appendBMFFBox(out, box.typ, payload)
+	}
+
+	return out, nil
+}
+
+// parseHEIFItems reads the item information entries
+func parseHEIFItems(data []byte, iinf bmffBox) ([]heifItem, error) {
+	f := &bmffFields{data: data[iinf.payloadStart():iinf.end]}
+	version := f.u8()
+	f.next(3)
+	if version == 0 {
+		f.u16()
+	} else {
+		f.u32()
+	}
+	if f.err != nil {
+		return nil, errors.New("invalid HEIF iinf box")
+	}
+
+	entries, err := readBMFFBoxes(bytes.NewReader(data), iinf.payloadStart()+int64(f.pos), iinf.end)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []heifItem
+	for _, entry := range entries {
+		if entry.typ != "infe" {
+			continue
+		}
+		f := &bmffFields{data: data[entry.payloadStart():entry.end]}
+		version := f.u8()
+		f.next(3)
+
+		item := heifItem{box: entry}
+		switch {
+		case version >= 2:
+			if version == 2 {
+				item.id = uint32(f.u16())
+			} else {
+				item.id = f.u32()
+			}
+			f.u16() // Protection index
+			item.typ = string(f.next(4))
+			f.cstring() // Item name
+			if item.typ == "mime" {
+				item.contentType = f.cstring()
+			}
+		default:
+			item.id = uint32(f.u16())
+			f.u16() // Protection index
+			f.cstring()
+			item.contentType = f.cstring()
+		}
+		if f.err != nil {
+			return nil, errors.New("invalid HEIF infe box")
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseHEIFLocations reads an item location box payload
+func parseHEIFLocations(payload []byte) (*heifItemLocations, error) {
+	f := &bmffFields{data: payload}
+	locs := &heifItemLocations{version: f.u8(), flags: f.next(3)}
+	if locs.version > 2 {
+		return nil, fmt.Errorf("unsupported HEIF iloc version %d", locs.version)
+	}
+
+	sizes := f.u8()
+	locs.offsetSize, locs.lengthSize = int(sizes>>4), int(sizes&0x0F)
+	sizes = f.u8()
+	locs.baseOffsetSize = int(sizes >> 4)
+	if locs.version > 0 {
+		locs.indexSize = int(sizes & 0x0F)
+	}
+
+	count := uint32(0)
+	if locs.version < 2 {
+		count = uint32(f.u16())
+	} else {
+		count = f.u32()
+	}
+
+	for i := uint32(0); i < count && f.err == nil; i++ {
+		var loc heifLocation
+		if locs.version < 2 {
+			loc.id = uint32(f.u16())
+		} else {
+			loc.id = f.u32()
+		}
+		if locs.version > 0 {
+			loc.constructionMethod = f.u16() & 0x0F
+		}
+		loc.dataRefIndex = f.u16()
+		loc.baseOffset = f.uint(locs.baseOffsetSize)
+
+		extents := f.u16()
+		for j := uint16(0); j < extents && f.err == nil; j++ {
+			var extent heifExtent
+			if locs.version > 0 {
+				extent.index = f.uint(locs.indexSize)
+			}
+			extent.offset = f.uint(locs.offsetSize)
+			extent.length = f.uint(locs.lengthSize)
+			loc.extents = append(loc.extents, extent)
+		}
+		locs.items = append(locs.items, loc)
+	}
+
+	if f.err != nil {
+		return nil, errors.New("invalid HEIF iloc box")
+	}
+	return locs, nil
+}
+
+// encodeHEIFLocations writes an item location box payload, passing every absolute
+// extent offset through remap
+func encodeHEIFLocations(locs *heifItemLocations, remap func(heifLocation, uint64) (uint64, error)) ([]byte, error) {
+	out := []byte{locs.version}
+	out = append(out, locs.flags...)
+	out = append(out, byte(locs.offsetSize<<4|locs.lengthSize), byte(locs.baseOffsetSize<<4|locs.indexSize))
+	if locs.version < 2 {
+		out = binary.BigEndian.AppendUint16(out, uint16(len(locs.items)))
+	} else {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(locs.items)))
+	}
+
+	var err error
+	for _, loc := range locs.items {
+		if locs.version < 2 {
+			out = binary.BigEndian.AppendUint16(out, uint16(loc.id))
+		} else {
+			out = binary.BigEndian.AppendUint32(out, loc.id)
+		}
+		if locs.version > 0 {
+			out = binary.BigEndian.AppendUint16(out, loc.constructionMethod)
+		}
+		out = binary.BigEndian.AppendUint16(out, loc.dataRefIndex)
+
+		// Offsets are written relative to a zero base unless the extents carry no offset field
+		base := uint64(0)
+		if locs.offsetSize == 0 {
+			if base, err = remap(loc, loc.baseOffset); err != nil {
+				return nil, err
+			}
+		}
+		if out, err = putBMFFUint(out, locs.baseOffsetSize, base); err != nil {
+			return nil, err
+		}
+
+		out = binary.BigEndian.AppendUint16(out, uint16(len(loc.extents)))
+		for _, extent := range loc.extents {
+			if locs.version > 0 {
+				if out, err = putBMFFUint(out, locs.indexSize, extent.index); err != nil {
+					return nil, err
+				}
+			}
+			offset := uint64(0)
+			if locs.offsetSize > 0 {
+				if offset, err = remap(loc, loc.baseOffset+extent.offset); err != nil {
+					return nil, err
+				}
+			}
+			if out, err = putBMFFUint(out, locs.offsetSize, offset); err != nil {
+				return nil, err
+			}
+			if out, err = putBMFFUint(out, locs.lengthSize, extent.length); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// heifHoles returns the byte ranges of removed items that can be cut out of mdat or idat
+// without touching the data of any item that is kept
+func heifHoles(locs *heifItemLocations, removed map[uint32]bool, boxes []bmffBox, idat bmffBox, hasIDAT bool) []heifRange {
+	var candidates, used []heifRange
+	for _, loc := range locs.items {
+		for _, extent := range loc.extents {
+			if extent.length == 0 {
+				continue
+			}
+			start := int64(loc.baseOffset + extent.offset)
+			switch {
+			case loc.constructionMethod == 1 && hasIDAT:
+				start += idat.payloadStart()
+			case loc.constructionMethod != 0:
+				continue
+			}
+			rng := heifRange{start, start + int64(extent.length)}
+			if removed[loc.id] {
+				candidates = append(candidates, rng)
+			} else {
+				used = append(used, rng)
+			}
+		}
+	}
+
+	var holes []heifRange
+	for _, hole := range candidates {
+		inside := false
+		for _, box := range boxes {
+			if box.typ == "mdat" && hole.start >= box.payloadStart() && hole.end <= box.end {
+				inside = true
+			}
+		}
+		if hasIDAT && hole.start >= idat.payloadStart() && hole.end <= idat.end {
+			inside = true
+		}
+
+		for _, rng := range used {
+			if hole.start < rng.end && rng.start < hole.end {
+				inside = false
+			}
+		}
+		for _, other := range holes {
+			if hole.start < other.end && other.start < hole.end {
+				inside = false
+			}
+		}
+
+		if inside {
+			holes = append(holes, hole)
+		}
+	}
+
+	sort.Slice(holes, func(i, j int) bool { return holes[i].start < holes[j].start })
+	return holes
+}
+
+// heifHoleBytes counts the bytes cut out between start and end
+func heifHoleBytes(holes []heifRange, start, end int64) int64 {
+	total := int64(0)
+	for _, hole := range holes {
+		if hole.start >= start && hole.end <= end {
+			total += hole.end - hole.start
+		}
+	}
+	return total
+}
+
+// cutHEIFHoles copies data[start:end] without the holes inside it
+func cutHEIFHoles(data []byte, start, end int64, holes []heifRange) []byte {
+	out := make([]byte, 0, end-start)
+	pos := start
+	for _, hole := range holes {
+		if hole.start < start || hole.end > end {
+			continue
+		}
+		out = append(out, data[pos:hole.start]...)
+		pos = hole.end
+	}
+	return append(out, data[pos:end]...)
+}
+
+// rebuildHEIFItemInfo writes the item information box without the removed items
+func rebuildHEIFItemInfo(data []byte, iinf bmffBox, items []heifItem, removed map[uint32]bool) ([]byte, error) {
+	version := data[iinf.payloadStart()]
+
+	var entries []byte
+	count := 0
+	for _, item := range items {
+		if removed[item.id] {
+			continue
+		}
+		entries = append(entries, data[item.box.start:item.box.end]...)
+		count++
+	}
+
+	payload := append([]byte{}, data[iinf.payloadStart():iinf.payloadStart()+4]...)
+	if version == 0 {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(count))
+	} else {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(count))
+	}
+	return appendBMFFBox(nil, "iinf", append(payload, entries...)), nil
+}
+
+// rebuildHEIFReferences drops references from and to removed items; the box is
+// dropped entirely once no references remain
+func rebuildHEIFReferences(data []byte, iref bmffBox, removed map[uint32]bool) ([]byte, error) {
+	if iref.payloadSize() < 4 {
+		return nil, errors.New("invalid HEIF iref box")
+	}
+	version := data[iref.payloadStart()]
+	idSize := 2
+	if version > 0 {
+		idSize = 4
+	}
+
+	refs, err := readBMFFBoxes(bytes.NewReader(data), iref.payloadStart()+4, iref.end)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := append([]byte{}, data[iref.payloadStart():iref.payloadStart()+4]...)
+	kept := 0
+	for _, ref := range refs {
+		f := &bmffFields{data: data[ref.payloadStart():ref.end]}
+		from := uint32(f.uint(idSize))
+		count := f.u16()
+		var to []uint32
+		for i := uint16(0); i < count; i++ {
+			if id := uint32(f.uint(idSize)); !removed[id] {
+				to = append(to, id)
+			}
+		}
+		if f.err != nil {
+			return nil, errors.New("invalid HEIF item reference")
+		}
+		if removed[from] || len(to) == 0 {
+			continue
+		}
+
+		var body []byte
+		body, _ = putBMFFUint(body, idSize, uint64(from))
+		body = binary.BigEndian.AppendUint16(body, uint16(len(to)))
+		for _, id := range to {
+			body, _ = putBMFFUint(body, idSize, uint64(id))
+		}
+		payload = appendBMFFBox(payload, ref.typ, body)
+		kept++
+	}
+
+	if kept == 0 {
+		return nil, nil
+	}
+	return appendBMFFBox(nil, "iref", payload), nil
+}
+
+// rebuildHEIFProperties drops the property associations of removed items
+func rebuildHEIFProperties(data []byte, iprp bmffBox, removed map[uint32]bool) ([]byte, error) {
+	children, err := readBMFFBoxes(bytes.NewReader(data), iprp.payloadStart(), iprp.end)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	for _, child := range children {
+		if child.typ != "ipma" {
+			payload = append(payload, data[child.start:child.end]...)
+			continue
+		}
+
+		f := &bmffFields{data: data[child.payloadStart():child.end]}
+		version := f.u8()
+		flags := f.next(3)
+		count := f.u32()
+		if f.err != nil {
+			return nil, errors.New("invalid HEIF ipma box")
+		}
+		entrySize := 1
+		if flags[2]&1 != 0 {
+			entrySize = 2
+		}
+
+		body := []byte{version}
+		body = append(body, flags...)
+		body = append(body, 0, 0, 0, 0)
+		kept := uint32(0)
+		for i := uint32(0); i < count; i++ {
+			start := f.pos
+			var id uint32
+			if version < 1 {
+				id = uint32(f.u16())
+			} else {
+				id = f.u32()
+			}
+			associations := int(f.u8())
+			f.next(associations * entrySize)
+			if f.err != nil {
+				return nil, errors.New("invalid HEIF ipma box")
+			}
+			if !removed[id] {
+				body = append(body, f.data[start:f.pos]...)
+				kept++
+			}
+		}
+		binary.BigEndian.PutUint32(body[4:8], kept)
+		payload = appendBMFFBox(payload, "ipma", body)
+	}
+
+	return appendBMFFBox(nil, "iprp", payload), nil
+}
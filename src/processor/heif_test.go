@@ -0,0 +1,283 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testHEIFItem describes an item for building test HEIF files
+type testHEIFItem struct {
+	id          uint16
+	typ         string
+	contentType string
+	data        []byte
+	inIDAT      bool
+}
+
+// testInfe builds a version 2 item information entry
+func testInfe(item testHEIFItem) []byte {
+	payload := [][]byte{testU16(item.id), testU16(0), []byte(item.typ), {0}}
+	if item.typ == "mime" {
+		payload = append(payload, []byte(item.contentType+"\x00"))
+	}
+	return testFullBox("infe", 2, 0, payload...)
+}
+
+// buildTestHEIF creates a HEIF file with the items stored in mdat or idat.
+// Every item other than the first refers to the first one.
+func buildTestHEIF(items []testHEIFItem) []byte {
+	build := func(mdatPayloadStart uint32) []byte {
+		var infes, locs, refs, idat, mdat [][]byte
+		idatSize, mdatSize := uint32(0), uint32(0)
+		for _, item := range items {
+			infes = append(infes, testInfe(item))
+
+			method, offset := uint16(0), mdatPayloadStart+mdatSize
+			if item.inIDAT {
+				method, offset = 1, idatSize
+				idat = append(idat, item.data)
+				idatSize += uint32(len(item.data))
+			} else {
+				mdat = append(mdat, item.data)
+				mdatSize += uint32(len(item.data))
+			}
+			locs = append(locs, testU16(item.id), testU16(method), testU16(0), testU16(1),
+				testU32(offset), testU32(uint32(len(item.data))))
+
+			if item.id != items[0].id {
+				refType := "cdsc"
+				if item.typ == "hvc1" {
+					refType = "thmb"
+				}
+				refs = append(refs, testBox(refType, testU16(item.id), testU16(1), testU16(items[0].id)))
+			}
+		}
+
+		meta := testFullBox("meta", 0, 0,
+			testFullBox("hdlr", 0, 0, testU32(0), []byte("pict"), make([]byte, 13)),
+			testFullBox("pitm", 0, 0, testU16(items[0].id)),
+			testFullBox("iinf", 0, 0, append([][]byte{testU16(uint16(len(items)))}, infes...)...),
+			testFullBox("iref", 0, 0, refs...),
+			testBox("iprp",
+				testBox("ipco", testFullBox("ispe", 0, 0, testU32(64), testU32(64))),
+				testFullBox("ipma", 0, 0, testU32(2), testU16(items[0].id), []byte{1, 0x81}, testU16(items[1].id), []byte{0}),
+			),
+			testFullBox("iloc", 1, 0, []byte{0x44, 0x00}, testU16(uint16(len(items))), bytes.Join(locs, nil)),
+			testBox("idat", idat...),
+		)
+
+		ftyp := testBox("ftyp", []byte("heic"), testU32(0), []byte("mif1heic"))
+		return bytes.Join([][]byte{ftyp, meta, testBox("mdat", mdat...)}, nil)
+	}
+
+	// The mdat payload sits at the end, so a first pass gives its offset
+	layout := build(0)
+	mdatData := 0
+	for _, item := range items {
+		if !item.inIDAT {
+			mdatData += len(item.data)
+		}
+	}
+	return build(uint32(len(layout) - mdatData))
+}
+
+// readTestHEIFItems returns the data of every item in a HEIF file
+func readTestHEIFItems(t *testing.T, data []byte) map[uint32][]byte {
+	t.Helper()
+
+	r := bytes.NewReader(data)
+	boxes, err := readBMFFBoxes(r, 0, int64(len(data)))
+	if err != nil {
+		t.Fatalf("Output boxes are invalid: %v", err)
+	}
+	meta, _ := findBMFFBox(boxes, "meta")
+	children, err := readBMFFBoxes(r, meta.payloadStart()+4, meta.end)
+	if err != nil {
+		t.Fatalf("Output meta box is invalid: %v", err)
+	}
+	iloc, _ := findBMFFBox(children, "iloc")
+	idat, _ := findBMFFBox(children, "idat")
+	locs, err := parseHEIFLocations(data[iloc.payloadStart():iloc.end])
+	if err != nil {
+		t.Fatalf("Output iloc box is invalid: %v", err)
+	}
+
+	items := make(map[uint32][]byte)
+	for _, loc := range locs.items {
+		var content []byte
+		for _, extent := range loc.extents {
+			start := int64(loc.baseOffset + extent.offset)
+			if loc.constructionMethod == 1 {
+				start += idat.payloadStart()
+			}
+			end := start + int64(extent.length)
+			if end > int64(len(data)) {
+				t.Fatalf("Item %d extent out of range", loc.id)
+			}
+			content = append(content, data[start:end]...)
+		}
+		items[loc.id] = content
+	}
+	return items
+}
+
+func TestStripHEIF(t *testing.T) {
+	image := testHEIFItem{id: 1, typ: "hvc1", data: []byte("PRIMARY-IMAGE-DATA")}
+	exif := testHEIFItem{id: 2, typ: "Exif", data: []byte("\x00\x00\x00\x06Exif\x00\x00MM serial 42")}
+	thumb := testHEIFItem{id: 3, typ: "hvc1", data: []byte("THUMBNAIL")}
+	xmp := testHEIFItem{id: 4, typ: "mime", contentType: "application/rdf+xml", data: []byte("<x:xmpmeta>Jane</x:xmpmeta>")}
+
+	cases := []struct {
+		name  string
+		items []testHEIFItem
+	}{
+		{"Metadata in mdat", []testHEIFItem{image, exif, thumb, xmp}},
+		{"Metadata in idat", []testHEIFItem{image, func() testHEIFItem { e := exif; e.inIDAT = true; return e }(), thumb, xmp}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			proc := NewProcessor(nil, false)
+			input := buildTestHEIF(tc.items)
+
+			before := readTestHEIFItems(t, input)
+			if !bytes.Equal(before[1], image.data) {
+				t.Fatalf("Test file is inconsistent: %q", before[1])
+			}
+
+			output, err := proc.stripHEIF(input)
+			if err != nil {
+				t.Fatalf("stripHEIF failed: %v", err)
+			}
+
+			after := readTestHEIFItems(t, output)
+			if len(after) != 2 {
+				t.Errorf("Expected 2 items, got %d", len(after))
+			}
+			if !bytes.Equal(after[1], image.data) || !bytes.Equal(after[3], thumb.data) {
+				t.Errorf("Image data moved incorrectly: %q, %q", after[1], after[3])
+			}
+
+			for _, leaked := range []string{"serial", "Jane", "rdf+xml", "cdsc"} {
+				if bytes.Contains(output, []byte(leaked)) {
+					t.Errorf("Output still contains %q", leaked)
+				}
+			}
+			if !bytes.Contains(output, []byte("thmb")) {
+				t.Error("Thumbnail reference was removed")
+			}
+			if len(output) >= len(input) {
+				t.Error("Output is not smaller than input")
+			}
+
+			boxes, err := readBMFFBoxes(bytes.NewReader(output), 0, int64(len(output)))
+			if err != nil || len(boxes) != 3 || boxes[2].typ != "mdat" {
+				t.Errorf("Top-level boxes are invalid: %v", err)
+			}
+
+			if proc.Stats.ByMetadataType["EXIF"] == nil || proc.Stats.ByMetadataType["XMP"] == nil {
+				t.Error("Removed items were not reported in statistics")
+			}
+		})
+	}
+
+	t.Run("Clean file unchanged", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestHEIF([]testHEIFItem{image, thumb})
+
+		output, err := proc.stripHEIF(input)
+		if err != nil {
+			t.Fatalf("stripHEIF failed: %v", err)
+		}
+		if !bytes.Equal(input, output) {
+			t.Error("HEIF without metadata was modified")
+		}
+	})
+
+	t.Run("Image sequence", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestHEIF([]testHEIFItem{image, exif})
+
+		// Append the samples to mdat, which ends the file, and a moov box whose
+		// chunk offsets point at them
+		samples := bytes.Join(testMP4Chunks, nil)
+		mdatStart := bytes.LastIndex(input, []byte("mdat")) - 4
+		input = append(input, samples...)
+		binary.BigEndian.PutUint32(input[mdatStart:], uint32(len(input)-mdatStart))
+		offsets := []byte{}
+		for i, pos := 0, len(input)-len(samples); i < len(testMP4Chunks); i++ {
+			offsets = append(offsets, testU32(uint32(pos))...)
+			pos += len(testMP4Chunks[i])
+		}
+		stbl := testBox("stbl", testFullBox("stco", 0, 0, testU32(uint32(len(testMP4Chunks))), offsets))
+		moov := testBox("moov",
+			testFullBox("mvhd", 0, 0, testU32(3700000000), testU32(3700000001), testU32(600), testU32(1200), make([]byte, 80)),
+			testBox("trak", testBox("mdia", testBox("minf", stbl))),
+			testBox("udta", testBox("\xa9mak", testU16(5), testU16(0x15C7), []byte("Apple"))),
+		)
+		input = append(input, moov...)
+
+		output, err := proc.stripHEIF(input)
+		if err != nil {
+			t.Fatalf("stripHEIF failed: %v", err)
+		}
+		if after := readTestHEIFItems(t, output); len(after) != 1 || !bytes.Equal(after[1], image.data) {
+			t.Errorf("Image data moved incorrectly: %q", after[1])
+		}
+		for i, offset := range testMP4ChunkOffsets(t, output) {
+			if end := offset + uint64(len(testMP4Chunks[i])); end > uint64(len(output)) || !bytes.Equal(output[offset:end], testMP4Chunks[i]) {
+				t.Errorf("Chunk %d offset %d does not point at its samples", i, offset)
+			}
+		}
+		for _, leaked := range []string{"serial", "Apple"} {
+			if bytes.Contains(output, []byte(leaked)) {
+				t.Errorf("Output still contains %q", leaked)
+			}
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := [][]byte{
+			[]byte("not a heif file"),
+			testBox("mdat", []byte("data")),
+			append(testBox("ftyp", []byte("avif")), 0, 0, 0, 99, 'm', 'e', 't', 'a'),
+		}
+		for _, data := range invalid {
+			if _, err := proc.stripHEIF(data); err == nil {
+				t.Errorf("Expected error for %q", data)
+			}
+		}
+	})
+}
+
+func TestCleanHEIF(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	for _, ext := range []string{".heic", ".heif", ".avif"} {
+		filePath := filepath.Join(tempDir, "photo"+ext)
+		input := buildTestHEIF([]testHEIFItem{
+			{id: 1, typ: "av01", data: []byte("IMAGE")},
+			{id: 2, typ: "Exif", data: []byte("Exif\x00\x00GPS 51.5N")},
+		})
+		if err := os.WriteFile(filePath, input, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if err := proc.ProcessImage(filePath, ext); err != nil {
+			t.Fatalf("Failed to clean %s: %v", ext, err)
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to read cleaned file: %v", err)
+		}
+		if bytes.Contains(data, []byte("GPS")) {
+			t.Errorf("Exif item still present in %s", ext)
+		}
+	}
+}
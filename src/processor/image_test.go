@@ -1,6 +1,7 @@
 package processor
 
 import (
+	"encoding/binary"
 	"os"
 	"path/filepath"
 	"testing"
@@ -105,17 +106,17 @@ func TestProcessImage(t *testing.T) {
 
 		switch tc.ext {
 		case ".jpg", ".jpeg":
-			fileContent = []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46, 0x00}
+			fileContent = buildTestJPEG(t)
 		case ".png":
-			fileContent = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+			fileContent = buildTestPNG(t, nil, nil)
 		case ".gif":
-			fileContent = []byte("GIF89a")
+			fileContent = buildTestGIF(t, 1)
 		case ".bmp":
 			fileContent = []byte{'B', 'M'}
 		case ".tiff", ".tif":
-			fileContent = []byte{0x49, 0x49, 0x2A, 0x00}
+			fileContent = buildTestTIFF(binary.LittleEndian, []byte{0, 0, 0, 0})
 		case ".webp":
-			fileContent = []byte{'R', 'I', 'F', 'F', 0x00, 0x00, 0x00, 0x00, 'W', 'E', 'B', 'P'}
+			fileContent = buildTestWEBP(testRIFFChunk("VP8L", []byte{0x2F, 0, 0, 0, 0}))
 		}
 
 		err := os.WriteFile(filePath, fileContent, 0644)
@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bmffBox locates an ISO base media file format box without holding its contents
+type bmffBox struct {
+	typ        string
+	start      int64 // Offset of the box header
+	headerSize int64 // 8, or 16 for boxes with a 64-bit size
+	end        int64 // Offset just past the box
+}
+
+// payloadStart returns the offset of the first byte after the box header
+func (b bmffBox) payloadStart() int64 {
+	return b.start + b.headerSize
+}
+
+// payloadSize returns the size of the box contents
+func (b bmffBox) payloadSize() int64 {
+	return b.end - b.payloadStart()
+}
+
+// readBMFFBoxes lists the boxes between start and end
+func readBMFFBoxes(r io.ReaderAt, start, end int64) ([]bmffBox, error) {
+	var boxes []bmffBox
+	header := make([]byte, 16)
+
+	for pos := start; pos < end; {
+		if end-pos < 8 {
+			return nil, errors.New("truncated box header")
+		}
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return nil, errors.New("truncated box header")
+		}
+
+		box := bmffBox{
+			typ:        string(header[4:8]),
+			start:      pos,
+			headerSize: 8,
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch size {
+		case 0:
+			// The box extends to the end of its container
+			size = end - pos
+		case 1:
+			if end-pos < 16 {
+				return nil, fmt.Errorf("truncated %q box header", box.typ)
+			}
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return nil, fmt.Errorf("truncated %q box header", box.typ)
+			}
+			large := binary.BigEndian.Uint64(header[8:16])
+			if large > math.MaxInt64 {
+				return nil, fmt.Errorf("invalid %q box size", box.typ)
+			}
+			size = int64(large)
+			box.headerSize = 16
+		}
+
+		if size < box.headerSize || size > end-pos {
+			return nil, fmt.Errorf("invalid %q box size", box.typ)
+		}
+
+		box.end = pos + size
+		boxes = append(boxes, box)
+		pos = box.end
+	}
+
+	return boxes, nil
+}
+
+// findBMFFBox returns the first box of the given type
+func findBMFFBox(boxes []bmffBox, typ string) (bmffBox, bool) {
+	for _, box := range boxes {
+		if box.typ == typ {
+			return box, true
+		}
+	}
+	return bmffBox{}, false
+}
+
+// bmffHeader builds a box header for a payload of the given size
+func bmffHeader(typ string, payloadSize int64) []byte {
+	if payloadSize+8 > math.MaxUint32 {
+		header := make([]byte, 16)
+		binary.BigEndian.PutUint32(header, 1)
+		copy(header[4:8], typ)
+		binary.BigEndian.PutUint64(header[8:], uint64(payloadSize+16))
+		return header
+	}
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(payloadSize+8))
+	copy(header[4:8], typ)
+	return header
+}
+
+// appendBMFFBox appends a complete box to out
+func appendBMFFBox(out []byte, typ string, payload []byte) []byte {
+	out = append(out, bmffHeader(typ, int64(len(payload)))...)
+	return append(out, payload...)
+}
+
+// bmffFields reads big-endian fields from a box payload; the first error is kept
+// and later reads return zero values
+type bmffFields struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (f *bmffFields) next(n int) []byte {
+	if f.err != nil {
+		return nil
+	}
+	if n < 0 || f.pos+n > len(f.data) {
+		f.err = errors.New("truncated box payload")
+		return nil
+	}
+	field := f.data[f.pos : f.pos+n]
+	f.pos += n
+	return field
+}
+
+func (f *bmffFields) u8() uint8 {
+	if b := f.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (f *bmffFields) u16() uint16 {
+	if b := f.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (f *bmffFields) u32() uint32 {
+	if b := f.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// uint reads an unsigned field of 0, 2, 4 or 8 bytes
+func (f *bmffFields) uint(size int) uint64 {
+	switch size {
+	case 0:
+		return 0
+	case 2:
+		return uint64(f.u16())
+	case 4:
+		return uint64(f.u32())
+	case 8:
+		if b := f.next(8); b != nil {
+			return binary.BigEndian.Uint64(b)
+		}
+		return 0
+	default:
+		if f.err == nil {
+			f.err = fmt.Errorf("unsupported field size %d", size)
+		}
+		return 0
+	}
+}
+
+// cstring reads a null-terminated string
+func (f *bmffFields) cstring() string {
+	if f.err != nil {
+		return ""
+	}
+	for i := f.pos; i < len(f.data); i++ {
+		if f.data[i] == 0 {
+			s := string(f.data[f.pos:i])
+			f.pos = i + 1
+			return s
+		}
+	}
+	// Strings at the end of a box may omit the terminator
+	s := string(f.data[f.pos:])
+	f.pos = len(f.data)
+	return s
+}
+
+// putBMFFUint appends an unsigned field of 0, 2, 4 or 8 bytes, failing if the value doesn't fit
+func putBMFFUint(out []byte, size int, value uint64) ([]byte, error) {
+	switch size {
+	case 0:
+		if value != 0 {
+			return nil, errors.New("value does not fit in an empty field")
+		}
+		return out, nil
+	case 2:
+		if value > math.MaxUint16 {
+			return nil, errors.New("value does not fit in a 16-bit field")
+		}
+		return binary.BigEndian.AppendUint16(out, uint16(value)), nil
+	case 4:
+		if value > math.MaxUint32 {
+			return nil, errors.New("value does not fit in a 32-bit field")
+		}
+		return binary.BigEndian.AppendUint32(out, uint32(value)), nil
+	case 8:
+		return binary.BigEndian.AppendUint64(out, value), nil
+	default:
+		return nil, fmt.Errorf("unsupported field size %d", size)
+	}
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testBox builds a box from its type and payload parts
+func testBox(typ string, payload ...[]byte) []byte {
+	return appendBMFFBox(nil, typ, bytes.Join(payload, nil))
+}
+
+// testFullBox builds a box with a version and flags header
+func testFullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return testBox(typ, append([][]byte{header}, payload...)...)
+}
+
+// testU16 and testU32 encode big-endian fields
+func testU16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func testU32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func TestReadBMFFBoxes(t *testing.T) {
+	t.Run("Box sizes", func(t *testing.T) {
+		large := append([]byte{0, 0, 0, 1, 'f', 'r', 'e', 'e'}, binary.BigEndian.AppendUint64(nil, 20)...)
+		large = append(large, 1, 2, 3, 4)
+		toEnd := []byte{0, 0, 0, 0, 'm', 'd', 'a', 't', 9, 9, 9}
+		data := bytes.Join([][]byte{testBox("ftyp", []byte("heic")), large, toEnd}, nil)
+
+		boxes, err := readBMFFBoxes(bytes.NewReader(data), 0, int64(len(data)))
+		if err != nil {
+			t.Fatalf("readBMFFBoxes failed: %v", err)
+		}
+		if len(boxes) != 3 {
+			t.Fatalf("Expected 3 boxes, got %d", len(boxes))
+		}
+		if boxes[1].headerSize != 16 || boxes[1].payloadSize() != 4 {
+			t.Errorf("64-bit box parsed incorrectly: %+v", boxes[1])
+		}
+		if boxes[2].end != int64(len(data)) || boxes[2].payloadSize() != 3 {
+			t.Errorf("Box extending to end parsed incorrectly: %+v", boxes[2])
+		}
+		if box, ok := findBMFFBox(boxes, "mdat"); !ok || box.start != boxes[2].start {
+			t.Error("findBMFFBox did not find mdat")
+		}
+	})
+
+	t.Run("Invalid sizes", func(t *testing.T) {
+		invalid := [][]byte{
+			{0, 0, 0, 4, 'f', 'r', 'e', 'e'},
+			{0, 0, 0, 99, 'f', 'r', 'e', 'e'},
+			{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0},
+			{0, 0, 0},
+		}
+		for _, data := range invalid {
+			if _, err := readBMFFBoxes(bytes.NewReader(data), 0, int64(len(data))); err == nil {
+				t.Errorf("Expected error for %X", data)
+			}
+		}
+	})
+}
+
+func TestBMFFFields(t *testing.T) {
+	f := &bmffFields{data: []byte{1, 0, 2, 0, 0, 0, 3, 'a', 'b', 0, 'c'}}
+	if f.u8() != 1 || f.u16() != 2 || f.u32() != 3 || f.cstring() != "ab" || f.cstring() != "c" {
+		t.Error("Fields decoded incorrectly")
+	}
+	if f.u8(); f.err == nil {
+		t.Error("Expected error reading past the end")
+	}
+
+	out, err := putBMFFUint(nil, 2, 0x1234)
+	if err != nil || !bytes.Equal(out, []byte{0x12, 0x34}) {
+		t.Errorf("putBMFFUint wrote %X, %v", out, err)
+	}
+	if _, err := putBMFFUint(nil, 2, 0x10000); err == nil {
+		t.Error("Expected overflow error")
+	}
+}
@@ -0,0 +1,280 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// JPEG marker codes
+const (
+	jpegMarkerTEM  = 0x01
+	jpegMarkerRST0 = 0xD0
+	jpegMarkerRST7 = 0xD7
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerAPP0 = 0xE0
+	jpegMarkerAPPF = 0xEF
+	jpegMarkerCOM  = 0xFE
+)
+
+// cleanJPEG removes metadata from JPEG files
+func (p *Processor) cleanJPEG(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripJPEG(bufio.NewReader(file), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripJPEG copies a JPEG stream marker by marker, dropping identifying APPn and COM segments
+// and rebuilding the JFIF APP0 segment without its thumbnail
+func (p *Processor) stripJPEG(r *bufio.Reader, w *bufio.Writer) error {
+	// Read file header to verify it's a JPEG
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil || header[0] != 0xFF || header[1] != jpegMarkerSOI {
+		return errors.New("not a valid JPEG file")
+	}
+	w.Write(header)
+
+	marker, err := readJPEGMarker(r)
+	for {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case marker == jpegMarkerEOI:
+			w.Write([]byte{0xFF, jpegMarkerEOI})
+			if _, err := r.Peek(1); err == nil {
+				p.Stats.AddMetadata(stats.TypeImage, "Trailing data", "")
+			}
+			return nil
+
+		case marker == jpegMarkerTEM || (marker >= jpegMarkerRST0 && marker <= jpegMarkerRST7):
+			// Standalone markers carry no length or payload
+			w.Write([]byte{0xFF, marker})
+			marker, err = readJPEGMarker(r)
+			continue
+
+		case marker == jpegMarkerSOI || marker == 0x00:
+			return fmt.Errorf("unexpected JPEG marker 0x%02X", marker)
+		}
+
+		payload, segmentErr := readJPEGSegment(r)
+		if segmentErr != nil {
+			return segmentErr
+		}
+
+		switch {
+		case marker == jpegMarkerAPP0 && bytes.HasPrefix(payload, []byte("JFIF\x00")):
+			writeJPEGSegment(w, marker, p.rebuildJFIF(payload))
+
+		case marker >= jpegMarkerAPP0 && marker <= jpegMarkerAPPF, marker == jpegMarkerCOM:
+			if p.keepJPEGSegment(jpegSegmentName(marker, payload)) {
+				writeJPEGSegment(w, marker, payload)
+			} else {
+				p.reportJPEGSegment(marker, payload)
+			}
+
+		case marker == jpegMarkerSOS:
+			// The scan header is followed by entropy-coded data up to the next marker
+			writeJPEGSegment(w, marker, payload)
+			marker, err = copyJPEGScan(r, w)
+			continue
+
+		default:
+			writeJPEGSegment(w, marker, payload)
+		}
+
+		marker, err = readJPEGMarker(r)
+	}
+}
+
+// readJPEGMarker reads a marker, skipping any 0xFF fill bytes in front of the code
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err == io.EOF {
+		return 0, errors.New("JPEG file is missing its EOI marker")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, errors.New("invalid JPEG format")
+	}
+
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, errors.New("truncated JPEG marker")
+		}
+	}
+	return b, nil
+}
+
+// readJPEGSegment reads the length-prefixed payload that follows a marker
+func readJPEGSegment(r *bufio.Reader) ([]byte, error) {
+	lengthBuf := make([]byte, 2)
+	if _, err := io.ReadFull(r, lengthBuf); err != nil {
+		return nil, errors.New("truncated JPEG segment")
+	}
+
+	// The length includes the 2 bytes of the length field
+	length := int(binary.BigEndian.Uint16(lengthBuf))
+	if length < 2 {
+		return nil, errors.New("invalid JPEG segment length")
+	}
+
+	payload := make([]byte, length-2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.New("truncated JPEG segment")
+	}
+	return payload, nil
+}
+
+// writeJPEGSegment writes a marker with its length and payload
+func writeJPEGSegment(w *bufio.Writer, marker byte, payload []byte) {
+	w.Write([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)})
+	w.Write(payload)
+}
+
+// copyJPEGScan copies entropy-coded data and returns the marker that ends it.
+// Stuffed 0xFF00 bytes and RSTn markers belong to the scan; a stream that ends
+// without EOI is closed with one.
+func copyJPEGScan(r *bufio.Reader, w *bufio.Writer) (byte, error) {
+	for {
+		chunk, err := r.ReadSlice(0xFF)
+		if err == bufio.ErrBufferFull {
+			w.Write(chunk)
+			continue
+		}
+		if err == io.EOF {
+			w.Write(chunk)
+			return jpegMarkerEOI, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		w.Write(chunk[:len(chunk)-1])
+
+		// Skip fill bytes in front of the marker code
+		code := byte(0xFF)
+		for code == 0xFF {
+			if code, err = r.ReadByte(); err != nil {
+				return jpegMarkerEOI, nil
+			}
+		}
+
+		if code == 0x00 || (code >= jpegMarkerRST0 && code <= jpegMarkerRST7) {
+			w.Write([]byte{0xFF, code})
+			continue
+		}
+		return code, nil
+	}
+}
+
+// rebuildJFIF returns a JFIF APP0 payload that keeps the version and pixel density
+// but drops the embedded thumbnail
+func (p *Processor) rebuildJFIF(payload []byte) []byte {
+	jfif := []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	if len(payload) >= 14 {
+		copy(jfif[5:12], payload[5:12])
+		if payload[12] != 0 || payload[13] != 0 {
+			p.Stats.AddMetadata(stats.TypeImage, "JFIF thumbnail", "")
+		}
+	}
+	return jfif
+}
+
+// keepJPEGSegment applies the retention policy to an APPn or COM segment
+func (p *Processor) keepJPEGSegment(name string) bool {
+	switch name {
+	case "ICC Profile":
+		return p.Policy.KeepICCProfile
+	case "Adobe":
+		// APP14 decides how CMYK and YCCK data is decoded
+		return true
+	case "C2PA":
+		return p.Policy.KeepContentCredentials
+	default:
+		return false
+	}
+}
+
+// reportJPEGSegment records a removed APPn or COM segment in the statistics
+func (p *Processor) reportJPEGSegment(marker byte, payload []byte) {
+	example := ""
+	if marker == jpegMarkerCOM {
+		example = strings.TrimSpace(strings.TrimRight(string(payload), "\x00"))
+	}
+	p.Stats.AddMetadata(stats.TypeImage, jpegSegmentName(marker, payload), example)
+}
+
+// jpegSegmentName identifies an APPn or COM segment from its marker and signature
+func jpegSegmentName(marker byte, payload []byte) string {
+	signatures := []struct {
+		marker byte
+		prefix string
+		name   string
+	}{
+		{0xE0, "JFXX\x00", "JFIF thumbnail"},
+		{0xE1, "Exif\x00", "EXIF"},
+		{0xE1, "http://ns.adobe.com/xap/1.0/\x00", "XMP"},
+		{0xE1, "http://ns.adobe.com/xmp/extension/\x00", "XMP"},
+		{0xE2, "ICC_PROFILE\x00", "ICC Profile"},
+		{0xE2, "MPF\x00", "MPF"},
+		{0xE1, "FLIR\x00", "FLIR"},
+		{0xEB, "JP", "C2PA"},
+		{0xEC, "Ducky", "Ducky"},
+		{0xED, "Photoshop 3.0\x00", "IPTC/Photoshop"},
+		{0xEE, "Adobe", "Adobe"},
+	}
+
+	for _, sig := range signatures {
+		if marker == sig.marker && bytes.HasPrefix(payload, []byte(sig.prefix)) {
+			return sig.name
+		}
+	}
+
+	if marker == jpegMarkerCOM {
+		return "Comment"
+	}
+	return fmt.Sprintf("APP%d", marker-jpegMarkerAPP0)
+}
@@ -0,0 +1,253 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testJPEGSegment builds a marker segment with its length field
+func testJPEGSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	return append(segment, payload...)
+}
+
+// buildTestJPEG encodes a small image and inserts the given segments after SOI
+func buildTestJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		img.Set(x, x, color.RGBA{R: 255, A: 255})
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Failed to encode test JPEG: %v", err)
+	}
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+// stripTestJPEG adapts stripJPEG, which works on buffered streams, for runStrip
+func stripTestJPEG(proc *Processor, input []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		if err := proc.stripJPEG(bufio.NewReader(bytes.NewReader(input)), bw); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+}
+
+// testJPEGMarkers lists the markers of the segments before the first scan
+func testJPEGMarkers(data []byte) []byte {
+	var markers []byte
+	for pos := 2; pos+4 <= len(data); {
+		marker := data[pos+1]
+		markers = append(markers, marker)
+		if marker == jpegMarkerSOS {
+			break
+		}
+		pos += 2 + int(data[pos+2])<<8 + int(data[pos+3])
+	}
+	return markers
+}
+
+func TestStripJPEG(t *testing.T) {
+	jfif := []byte("JFIF\x00\x01\x02\x01\x00\x48\x00\x48\x01\x01\xAA\xBB\xCC")
+	exif := append([]byte("Exif\x00\x00"), []byte("Canon EOS serial 0123456789")...)
+	xmp := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), []byte("<dc:creator>Jane</dc:creator>")...)
+	iptc := append([]byte("Photoshop 3.0\x00"), []byte("8BIM caption")...)
+
+	t.Run("Metadata segments removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestJPEG(t,
+			testJPEGSegment(jpegMarkerAPP0, jfif),
+			testJPEGSegment(0xE1, exif),
+			testJPEGSegment(0xE1, xmp),
+			testJPEGSegment(0xED, iptc),
+			testJPEGSegment(jpegMarkerCOM, []byte("Edited by Jane's laptop")),
+		)
+
+		output := runStrip(t, stripTestJPEG(proc, input))
+
+		for _, leaked := range []string{"Canon", "Jane", "8BIM", "laptop"} {
+			if bytes.Contains(output, []byte(leaked)) {
+				t.Errorf("Output still contains %q", leaked)
+			}
+		}
+
+		markers := testJPEGMarkers(output)
+		if len(markers) == 0 || markers[0] != jpegMarkerAPP0 {
+			t.Fatalf("Expected JFIF APP0 first, got markers %X", markers)
+		}
+		rebuilt := output[6:20]
+		if !bytes.Equal(rebuilt, []byte("JFIF\x00\x01\x02\x01\x00\x48\x00\x48\x00\x00")) {
+			t.Errorf("JFIF segment not rebuilt correctly: %q", rebuilt)
+		}
+
+		if _, err := jpeg.Decode(bytes.NewReader(output)); err != nil {
+			t.Errorf("Cleaned JPEG does not decode: %v", err)
+		}
+
+		for _, name := range []string{"EXIF", "XMP", "IPTC/Photoshop", "Comment", "JFIF thumbnail"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("Retention policy", func(t *testing.T) {
+		icc := testJPEGSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01fake profile"))
+		adobe := testJPEGSegment(0xEE, []byte("Adobe\x00\x64\x00\x00\x00\x00\x02"))
+		c2pa := testJPEGSegment(0xEB, []byte("JP\x00\x01\x00\x00\x00\x01jumbc2pa manifest"))
+		input := buildTestJPEG(t,
+			icc,
+			adobe,
+			c2pa,
+			testJPEGSegment(0xE2, []byte("MPF\x00II*\x00")),
+			testJPEGSegment(0xE1, []byte("FLIR\x00thermal")),
+			testJPEGSegment(0xEC, []byte("Ducky\x00quality")),
+		)
+
+		policies := []struct {
+			name     string
+			keepICC  bool
+			keepC2PA bool
+			kept     [][]byte
+			removed  [][]byte
+		}{
+			{"Default", true, false, [][]byte{icc, adobe}, [][]byte{c2pa}},
+			{"Keep C2PA", true, true, [][]byte{icc, adobe, c2pa}, nil},
+			{"Strip ICC", false, false, [][]byte{adobe}, [][]byte{icc, c2pa}},
+		}
+
+		for _, tc := range policies {
+			t.Run(tc.name, func(t *testing.T) {
+				proc := NewProcessor(nil, false)
+				proc.Policy.KeepICCProfile = tc.keepICC
+				proc.Policy.KeepContentCredentials = tc.keepC2PA
+
+				output := runStrip(t, stripTestJPEG(proc, input))
+
+				for _, segment := range tc.kept {
+					if !bytes.Contains(output, segment) {
+						t.Errorf("Segment %q was removed", segment[4:])
+					}
+				}
+				for _, segment := range tc.removed {
+					if bytes.Contains(output, segment) {
+						t.Errorf("Segment %q was kept", segment[4:])
+					}
+				}
+				for _, leaked := range []string{"MPF", "thermal", "Ducky"} {
+					if bytes.Contains(output, []byte(leaked)) {
+						t.Errorf("Output still contains %q", leaked)
+					}
+				}
+				if _, err := jpeg.Decode(bytes.NewReader(output)); err != nil {
+					t.Errorf("Cleaned JPEG does not decode: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Fill bytes before markers", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		clean := buildTestJPEG(t)
+		padded := append([]byte{0xFF, 0xD8, 0xFF, 0xFF, 0xFF}, clean[3:]...)
+
+		output := runStrip(t, stripTestJPEG(proc, padded))
+		if !bytes.Equal(output, clean) {
+			t.Error("Fill bytes were not normalized")
+		}
+	})
+
+	t.Run("Clean JPEG unchanged", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestJPEG(t)
+
+		output := runStrip(t, stripTestJPEG(proc, input))
+		if !bytes.Equal(input, output) {
+			t.Error("JPEG without metadata was modified")
+		}
+	})
+
+	t.Run("Standalone markers in scan data", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		scan := []byte{0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56, 0xFF, 0xD1, 0x78, 0xFF, 0xFF, 0xD9}
+		input := append([]byte{0xFF, 0xD8, 0xFF, jpegMarkerTEM}, testJPEGSegment(jpegMarkerSOS, []byte{1, 1, 0, 0, 63, 0})...)
+		input = append(input, scan...)
+
+		output := runStrip(t, stripTestJPEG(proc, input))
+		expected := append(append([]byte{}, input[:len(input)-3]...), 0xFF, 0xD9)
+		if !bytes.Equal(output, expected) {
+			t.Errorf("Scan data not copied correctly:\n got %X\nwant %X", output, expected)
+		}
+	})
+
+	t.Run("Missing EOI is added", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestJPEG(t)
+		truncated := input[:len(input)-2]
+
+		output := runStrip(t, stripTestJPEG(proc, truncated))
+		if !bytes.Equal(output, input) {
+			t.Error("Expected EOI to be appended")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := [][]byte{
+			[]byte("Not a JPEG file"),
+			{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46, 0x49, 0x46, 0x00},
+			{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01},
+			{0xFF, 0xD8, 0x12, 0x34},
+			{0xFF, 0xD8, 0xFF, 0xD8},
+		}
+		for _, data := range invalid {
+			if err := stripTestJPEG(proc, data)(io.Discard); err == nil {
+				t.Errorf("Expected error for %X", data)
+			}
+		}
+	})
+}
+
+func TestCleanJPEG(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "photo.jpg")
+	input := buildTestJPEG(t, testJPEGSegment(0xE1, []byte("Exif\x00\x00GPS 51.5N")))
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".jpg"); err != nil {
+		t.Fatalf("Failed to clean JPEG: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("GPS")) {
+		t.Error("EXIF segment still present after cleaning")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Cleaned JPEG does not decode: %v", err)
+	}
+}
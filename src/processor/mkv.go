@@ -0,0 +1,543 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"metadata-remover/src/stats"
+)
+
+// EBML element IDs, including their length marker bits
+const (
+	ebmlHeaderID      = 0x1A45DFA3
+	ebmlVoidID        = 0xEC
+	ebmlCRC32ID       = 0xBF
+	mkvSegmentID      = 0x18538067
+	mkvSeekHeadID     = 0x114D9B74
+	mkvSeekID         = 0x4DBB
+	mkvSeekIDID       = 0x53AB
+	mkvInfoID         = 0x1549A966
+	mkvTracksID       = 0x1654AE6B
+	mkvClusterID      = 0x1F43B675
+	mkvCuesID         = 0x1C53BB6B
+	mkvAttachmentsID  = 0x1941A469
+	mkvChaptersID     = 0x1043A770
+	mkvTagsID         = 0x1254C367
+	mkvTitleID        = 0x7BA9
+	mkvMuxingAppID    = 0x4D80
+	mkvWritingAppID   = 0x5741
+	mkvDateUTCID      = 0x4461
+	mkvFilenameID     = 0x7384
+	mkvPrevFilenameID = 0x3C83AB
+	mkvNextFilenameID = 0x3E83BB
+	mkvTagID          = 0x7373
+	mkvSimpleTagID    = 0x67C8
+	mkvTagNameID      = 0x45A3
+	mkvTagStringID    = 0x4487
+	mkvAttachedFileID = 0x61A7
+	mkvFileNameID     = 0x466E
+)
+
+// mkvReportLimit caps the size of Tags elements that are read to report their contents
+const mkvReportLimit = 1 << 20
+
+// mkvEpoch is the origin of Matroska dates
+var mkvEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mkvTopLevelIDs are the elements that end a Segment or Cluster of unknown size
+var mkvTopLevelIDs = map[uint32]bool{
+	ebmlHeaderID:     true,
+	mkvSegmentID:     true,
+	mkvSeekHeadID:    true,
+	mkvInfoID:        true,
+	mkvTracksID:      true,
+	mkvClusterID:     true,
+	mkvCuesID:        true,
+	mkvAttachmentsID: true,
+	mkvChaptersID:    true,
+	mkvTagsID:        true,
+}
+
+// mkvInfoNames names the SegmentInfo fields reported in statistics
+var mkvInfoNames = map[uint32]string{
+	mkvTitleID:        "Title",
+	mkvMuxingAppID:    "Muxing application",
+	mkvWritingAppID:   "Writing application",
+	mkvDateUTCID:      "Creation date",
+	mkvFilenameID:     "File name",
+	mkvPrevFilenameID: "File name",
+	mkvNextFilenameID: "File name",
+}
+
+// ebmlElement locates an EBML element without holding its contents
+type ebmlElement struct {
+	id        uint32
+	start     int64 // Offset of the element ID
+	dataStart int64
+	end       int64
+	unknown   bool // The size field holds the reserved unknown-size value
+}
+
+// cleanMKV removes metadata from Matroska and WebM files
+func (p *Processor) cleanMKV(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripMKV(file, info.Size(), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripMKV turns Tags and Attachments into Void elements and blanks the identifying
+// SegmentInfo fields. Every element keeps its size, so the SeekHead and Cues positions
+// stay valid; SeekHead entries for the removed elements are voided as well.
+func (p *Processor) stripMKV(r io.ReaderAt, size int64, w io.Writer) error {
+	header, err := readEBMLElement(r, 0, size)
+	if err != nil || header.id != ebmlHeaderID || header.unknown {
+		return errors.New("not a valid Matroska file")
+	}
+	if err := copyEBML(r, w, header.start, header.end); err != nil {
+		return err
+	}
+
+	for pos := header.end; pos < size; {
+		segment, err := readEBMLElement(r, pos, size)
+		if err != nil {
+			return err
+		}
+		if segment.id != mkvSegmentID {
+			// Anything between segments is copied as is
+			if segment.unknown {
+				return errors.New("unsupported EBML element of unknown size")
+			}
+			if err := copyEBML(r, w, segment.start, segment.end); err != nil {
+				return err
+			}
+			pos = segment.end
+			continue
+		}
+
+		if pos, err = p.stripMKVSegment(r, segment, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripMKVSegment rewrites the top-level elements of a segment and returns the offset after it
+func (p *Processor) stripMKVSegment(r io.ReaderAt, segment ebmlElement, w io.Writer) (int64, error) {
+	if err := copyEBML(r, w, segment.start, segment.dataStart); err != nil {
+		return 0, err
+	}
+
+	pos := segment.dataStart
+	for pos < segment.end {
+		elem, err := readEBMLElement(r, pos, segment.end)
+		if err != nil {
+			return 0, err
+		}
+		if segment.unknown && (elem.id == ebmlHeaderID || elem.id == mkvSegmentID) {
+			// A segment of unknown size ends where the next one starts
+			break
+		}
+		if elem.unknown {
+			if elem.id != mkvClusterID {
+				return 0, fmt.Errorf("unsupported EBML element 0x%X of unknown size", elem.id)
+			}
+			if elem.end, err = findEBMLClusterEnd(r, elem); err != nil {
+				return 0, err
+			}
+		}
+		pos = elem.end
+
+		switch elem.id {
+		case mkvInfoID, mkvSeekHeadID:
+			data := make([]byte, elem.end-elem.start)
+			if _, err := r.ReadAt(data, elem.start); err != nil {
+				return 0, errors.New("truncated Matroska element")
+			}
+			rewrite := p.blankMKVInfoField
+			if elem.id == mkvSeekHeadID {
+				rewrite = voidMKVSeek
+			}
+			if err := rewriteEBMLChildren(data, elem, rewrite); err != nil {
+				return 0, err
+			}
+			if _, err := w.Write(data); err != nil {
+				return 0, err
+			}
+		case mkvTagsID, mkvAttachmentsID:
+			if err := p.reportMKVElement(r, elem); err != nil {
+				return 0, err
+			}
+			if err := writeEBMLVoid(w, elem.end-elem.start); err != nil {
+				return 0, err
+			}
+		default:
+			if err := copyEBML(r, w, elem.start, elem.end); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return pos, nil
+}
+
+// readEBMLElement reads the element header at pos
+func readEBMLElement(r io.ReaderAt, pos, end int64) (ebmlElement, error) {
+	header := make([]byte, 12)
+	n := int64(len(header))
+	if end-pos < n {
+		n = end - pos
+	}
+	if n < 2 {
+		return ebmlElement{}, errors.New("truncated EBML element header")
+	}
+	if _, err := r.ReadAt(header[:n], pos); err != nil {
+		return ebmlElement{}, errors.New("truncated EBML element header")
+	}
+	header = header[:n]
+
+	idLen := ebmlVintLength(header[0])
+	if idLen > 4 || idLen >= len(header) {
+		return ebmlElement{}, fmt.Errorf("invalid EBML element ID at offset %d", pos)
+	}
+	elem := ebmlElement{start: pos}
+	for _, b := range header[:idLen] {
+		elem.id = elem.id<<8 | uint32(b)
+	}
+
+	sizeLen := ebmlVintLength(header[idLen])
+	if sizeLen > 8 || idLen+sizeLen > len(header) {
+		return ebmlElement{}, fmt.Errorf("invalid EBML element size at offset %d", pos)
+	}
+	size := uint64(header[idLen]) & (0xFF >> sizeLen)
+	allOnes := size == 0xFF>>sizeLen
+	for _, b := range header[idLen+1 : idLen+sizeLen] {
+		size = size<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+
+	elem.dataStart = pos + int64(idLen+sizeLen)
+	if allOnes {
+		elem.unknown = true
+		elem.end = end
+		return elem, nil
+	}
+	if size > uint64(end-elem.dataStart) {
+		return ebmlElement{}, fmt.Errorf("EBML element 0x%X exceeds its parent", elem.id)
+	}
+	elem.end = elem.dataStart + int64(size)
+	return elem, nil
+}
+
+// ebmlVintLength returns the length of a variable-size integer from its first byte, or 9 if invalid
+func ebmlVintLength(first byte) int {
+	for n := 1; n <= 8; n++ {
+		if first&(0x80>>(n-1)) != 0 {
+			return n
+		}
+	}
+	return 9
+}
+
+// findEBMLClusterEnd finds the end of a cluster of unknown size from the first top-level element after it
+func findEBMLClusterEnd(r io.ReaderAt, cluster ebmlElement) (int64, error) {
+	pos := cluster.dataStart
+	for pos < cluster.end {
+		child, err := readEBMLElement(r, pos, cluster.end)
+		if err != nil {
+			return 0, err
+		}
+		if mkvTopLevelIDs[child.id] {
+			break
+		}
+		if child.unknown {
+			return 0, errors.New("unsupported EBML element of unknown size in cluster")
+		}
+		pos = child.end
+	}
+	return pos, nil
+}
+
+// rewriteEBMLChildren lets rewrite replace the children of a master element held in data.
+// A replacement must be exactly as long as the child it replaces.
+func rewriteEBMLChildren(data []byte, parent ebmlElement, rewrite func(child ebmlElement, raw []byte) []byte) error {
+	r := bytes.NewReader(data)
+	base := parent.start
+	for pos := parent.dataStart - base; pos < int64(len(data)); {
+		child, err := readEBMLElement(r, pos, int64(len(data)))
+		if err != nil {
+			return err
+		}
+		if child.unknown {
+			return errors.New("unsupported EBML element of unknown size")
+		}
+		raw := data[child.start:child.end]
+		if replacement := rewrite(child, raw); replacement != nil {
+			copy(raw, replacement)
+		}
+		pos = child.end
+	}
+	return nil
+}
+
+// blankMKVInfoField removes the title, date and file names from SegmentInfo and empties
+// the mandatory application names. Checksums are voided since the contents change.
+func (p *Processor) blankMKVInfoField(child ebmlElement, raw []byte) []byte {
+	value := raw[child.dataStart-child.start:]
+	switch child.id {
+	case mkvMuxingAppID, mkvWritingAppID:
+		p.Stats.AddMetadata(stats.TypeVideo, mkvInfoNames[child.id], metadataExample(string(value)))
+		return blankEBMLString(raw[:ebmlIDLength(child.id)], len(raw))
+	case mkvTitleID, mkvFilenameID, mkvPrevFilenameID, mkvNextFilenameID:
+		p.Stats.AddMetadata(stats.TypeVideo, mkvInfoNames[child.id], metadataExample(string(value)))
+		return ebmlVoid(len(raw))
+	case mkvDateUTCID:
+		example := ""
+		if len(value) == 8 {
+			example = mkvEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(value)))).Format(time.RFC3339)
+		}
+		p.Stats.AddMetadata(stats.TypeVideo, mkvInfoNames[child.id], example)
+		return ebmlVoid(len(raw))
+	case ebmlCRC32ID:
+		return ebmlVoid(len(raw))
+	default:
+		return nil
+	}
+}
+
+// voidMKVSeek voids the SeekHead entries that point at removed elements
+func voidMKVSeek(child ebmlElement, raw []byte) []byte {
+	if child.id == ebmlCRC32ID {
+		return ebmlVoid(len(raw))
+	}
+	if child.id != mkvSeekID {
+		return nil
+	}
+
+	r := bytes.NewReader(raw)
+	for pos := child.dataStart - child.start; pos < int64(len(raw)); {
+		field, err := readEBMLElement(r, pos, int64(len(raw)))
+		if err != nil || field.unknown {
+			return nil
+		}
+		if field.id == mkvSeekIDID {
+			target := uint32(0)
+			for _, b := range raw[field.dataStart:field.end] {
+				target = target<<8 | uint32(b)
+			}
+			if target == mkvTagsID || target == mkvAttachmentsID {
+				return ebmlVoid(len(raw))
+			}
+		}
+		pos = field.end
+	}
+	return nil
+}
+
+// reportMKVElement records the tags and attached files of a removed element
+func (p *Processor) reportMKVElement(r io.ReaderAt, elem ebmlElement) error {
+	if elem.id == mkvAttachmentsID {
+		files, err := readEBMLChildren(r, elem)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.id != mkvAttachedFileID {
+				continue
+			}
+			name := ""
+			fields, err := readEBMLChildren(r, file)
+			if err != nil {
+				return err
+			}
+			for _, field := range fields {
+				if field.id == mkvFileNameID && field.end-field.dataStart <= maxExampleLength {
+					value := make([]byte, field.end-field.dataStart)
+					if _, err := r.ReadAt(value, field.dataStart); err == nil {
+						name = string(value)
+					}
+				}
+			}
+			p.Stats.AddMetadata(stats.TypeVideo, "Attachment", metadataExample(name))
+		}
+		return nil
+	}
+
+	if elem.end-elem.start > mkvReportLimit {
+		p.Stats.AddMetadata(stats.TypeVideo, "Tags", "")
+		return nil
+	}
+	data := make([]byte, elem.end-elem.start)
+	if _, err := r.ReadAt(data, elem.start); err != nil {
+		return errors.New("truncated Matroska element")
+	}
+	elem.dataStart -= elem.start
+	elem.end -= elem.start
+	elem.start = 0
+	return p.reportMKVTags(bytes.NewReader(data), data, elem)
+}
+
+// reportMKVTags records the simple tags below a Tags, Tag or SimpleTag element
+func (p *Processor) reportMKVTags(r *bytes.Reader, data []byte, parent ebmlElement) error {
+	children, err := readEBMLChildren(r, parent)
+	if err != nil {
+		return err
+	}
+
+	name, value := "", ""
+	for _, child := range children {
+		switch child.id {
+		case mkvTagID, mkvSimpleTagID:
+			if err := p.reportMKVTags(r, data, child); err != nil {
+				return err
+			}
+		case mkvTagNameID:
+			name = string(data[child.dataStart:child.end])
+		case mkvTagStringID:
+			value = string(data[child.dataStart:child.end])
+		}
+	}
+	if parent.id == mkvSimpleTagID && name != "" {
+		p.Stats.AddMetadata(stats.TypeVideo, name, metadataExample(value))
+	}
+	return nil
+}
+
+// readEBMLChildren lists the children of a master element
+func readEBMLChildren(r io.ReaderAt, parent ebmlElement) ([]ebmlElement, error) {
+	var children []ebmlElement
+	for pos := parent.dataStart; pos < parent.end; {
+		child, err := readEBMLElement(r, pos, parent.end)
+		if err != nil {
+			return nil, err
+		}
+		if child.unknown {
+			return nil, errors.New("unsupported EBML element of unknown size")
+		}
+		children = append(children, child)
+		pos = child.end
+	}
+	return children, nil
+}
+
+// ebmlIDLength returns the encoded length of an element ID
+func ebmlIDLength(id uint32) int {
+	switch {
+	case id > 0xFFFFFF:
+		return 4
+	case id > 0xFFFF:
+		return 3
+	case id > 0xFF:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ebmlSize encodes a size with the given length
+func ebmlSize(size uint64, length int) []byte {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = byte(size)
+		size >>= 8
+	}
+	out[0] |= 0x80 >> (length - 1)
+	return out
+}
+
+// ebmlVoidHeader returns the header of a Void element whose total length is n (at least 2)
+func ebmlVoidHeader(n int64) []byte {
+	for length := 1; length <= 8; length++ {
+		size := n - 1 - int64(length)
+		if size >= 0 && uint64(size) < 1<<(7*length)-1 {
+			return append([]byte{ebmlVoidID}, ebmlSize(uint64(size), length)...)
+		}
+	}
+	return nil
+}
+
+// ebmlVoid builds a zero-filled Void element of total length n (at least 2)
+func ebmlVoid(n int) []byte {
+	out := ebmlVoidHeader(int64(n))
+	return append(out, make([]byte, n-len(out))...)
+}
+
+// writeEBMLVoid writes a zero-filled Void element of total length n without holding it in memory
+func writeEBMLVoid(w io.Writer, n int64) error {
+	header := ebmlVoidHeader(n)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, zeroReader{}, n-int64(len(header)))
+	return err
+}
+
+// blankEBMLString builds an empty string element of total length n, followed by a Void
+// element for the rest. A single spare byte goes into a longer size field instead.
+func blankEBMLString(id []byte, n int) []byte {
+	rest := n - len(id) - 1
+	if rest == 1 {
+		return append(append([]byte{}, id...), 0x40, 0x00)
+	}
+	out := append(append([]byte{}, id...), 0x80)
+	if rest > 0 {
+		out = append(out, ebmlVoid(rest)...)
+	}
+	return out
+}
+
+// copyEBML copies a byte range of the original file
+func copyEBML(r io.ReaderAt, w io.Writer, start, end int64) error {
+	_, err := io.Copy(w, io.NewSectionReader(r, start, end-start))
+	return err
+}
+
+// zeroReader reads an endless run of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
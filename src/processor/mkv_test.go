@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEBML builds an element with a known size
+func testEBML(id uint32, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, id)[4-ebmlIDLength(id):]
+	return append(append(out, ebmlSize(uint64(len(data)), 8)...), data...)
+}
+
+// testEBMLUnknown builds an element of unknown size
+func testEBMLUnknown(id uint32, payload ...[]byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, id)[4-ebmlIDLength(id):]
+	out = append(out, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	return append(out, bytes.Join(payload, nil)...)
+}
+
+// testMKVSeek builds a SeekHead entry
+func testMKVSeek(id uint32) []byte {
+	return testEBML(mkvSeekID, testEBML(mkvSeekIDID, binary.BigEndian.AppendUint32(nil, id)), testEBML(0x53AC, []byte{0x10, 0x00}))
+}
+
+// buildTestMKV builds a WebM file with metadata in SegmentInfo, Tags and Attachments
+func buildTestMKV(unknownSegment bool) []byte {
+	header := testEBML(ebmlHeaderID, testEBML(0x4282, []byte("webm")))
+	seekHead := testEBML(mkvSeekHeadID, testMKVSeek(mkvInfoID), testMKVSeek(mkvTagsID), testMKVSeek(mkvAttachmentsID))
+	info := testEBML(mkvInfoID,
+		testEBML(ebmlCRC32ID, []byte{1, 2, 3, 4}),
+		testEBML(0x2AD7B1, []byte{0x0F, 0x42, 0x40}),
+		testEBML(mkvTitleID, []byte("Screen recording of payroll")),
+		testEBML(mkvMuxingAppID, []byte("Lavf60.3.100")),
+		testEBML(mkvWritingAppID, []byte("OBS Studio 30.0")),
+		testEBML(mkvDateUTCID, binary.BigEndian.AppendUint64(nil, 700000000000000000)),
+	)
+	tracks := testEBML(mkvTracksID, []byte("track entries"))
+	cluster := testEBMLUnknown(mkvClusterID, testEBML(0xE7, []byte{0}), testEBML(0xA3, []byte("video frame")))
+	cues := testEBML(mkvCuesID, []byte("cue points"))
+	tags := testEBML(mkvTagsID, testEBML(mkvTagID,
+		testEBML(0x63C0, nil),
+		testEBML(mkvSimpleTagID, testEBML(mkvTagNameID, []byte("ENCODER")), testEBML(mkvTagStringID, []byte("Lavc60.3.100 libvpx"))),
+	))
+	attachments := testEBML(mkvAttachmentsID, testEBML(mkvAttachedFileID,
+		testEBML(mkvFileNameID, []byte("cover.jpg")),
+		testEBML(0x465C, []byte("JPEG image data")),
+	))
+
+	body := [][]byte{seekHead, info, tracks, cluster, cues, tags, attachments}
+	if unknownSegment {
+		return append(header, testEBMLUnknown(mkvSegmentID, body...)...)
+	}
+	return append(header, testEBML(mkvSegmentID, body...)...)
+}
+
+func TestEBMLPadding(t *testing.T) {
+	for n := 2; n < 20000; n++ {
+		void := ebmlVoid(n)
+		elem, err := readEBMLElement(bytes.NewReader(void), 0, int64(len(void)))
+		if len(void) != n || err != nil || elem.id != ebmlVoidID || elem.end != int64(n) {
+			t.Fatalf("Invalid Void element of length %d: %v", n, err)
+		}
+	}
+
+	id := []byte{0x4D, 0x80}
+	for n := 3; n < 300; n++ {
+		blank := blankEBMLString(id, n)
+		r := bytes.NewReader(blank)
+		elem, err := readEBMLElement(r, 0, int64(len(blank)))
+		if len(blank) != n || err != nil || elem.id != mkvMuxingAppID || elem.end != elem.dataStart {
+			t.Fatalf("Invalid empty string of length %d: %v", n, err)
+		}
+		if elem.end < int64(n) {
+			void, err := readEBMLElement(r, elem.end, int64(n))
+			if err != nil || void.id != ebmlVoidID || void.end != int64(n) {
+				t.Fatalf("Invalid padding after empty string of length %d: %v", n, err)
+			}
+		}
+	}
+}
+
+func TestStripMKV(t *testing.T) {
+	for name, unknownSegment := range map[string]bool{"Known segment size": false, "Unknown segment size": true} {
+		t.Run(name, func(t *testing.T) {
+			proc := NewProcessor(nil, false)
+			input := buildTestMKV(unknownSegment)
+
+			output := runStrip(t, func(w io.Writer) error {
+				return proc.stripMKV(bytes.NewReader(input), int64(len(input)), w)
+			})
+
+			// Positions are kept, so SeekHead and Cues stay valid
+			if len(output) != len(input) {
+				t.Fatalf("File size changed from %d to %d", len(input), len(output))
+			}
+			for _, kept := range []string{"track entries", "video frame", "cue points", "webm"} {
+				if bytes.Index(output, []byte(kept)) != bytes.Index(input, []byte(kept)) {
+					t.Errorf("%q moved", kept)
+				}
+			}
+
+			for _, leak := range []string{"payroll", "Lavf", "OBS", "Lavc", "cover.jpg", "JPEG", "\x12\x54\xC3\x67", "\x19\x41\xA4\x69", "\x01\x02\x03\x04"} {
+				if bytes.Contains(output, []byte(leak)) {
+					t.Errorf("Output still contains %q", leak)
+				}
+			}
+			if !bytes.Contains(output, []byte{0x4D, 0x80, 0x80}) || !bytes.Contains(output, []byte{0x57, 0x41, 0x80}) {
+				t.Error("Application names were not left as empty strings")
+			}
+
+			// The result must still parse
+			if err := NewProcessor(nil, false).stripMKV(bytes.NewReader(output), int64(len(output)), io.Discard); err != nil {
+				t.Errorf("Cleaned file does not parse: %v", err)
+			}
+
+			for _, field := range []string{"Title", "Muxing application", "Writing application", "Creation date", "ENCODER", "Attachment"} {
+				if proc.Stats.ByMetadataType[field] == nil {
+					t.Errorf("%s was not reported in statistics", field)
+				}
+			}
+			if field := proc.Stats.ByMetadataType["Attachment"]; field != nil && field.Examples[0] != "cover.jpg" {
+				t.Errorf("Unexpected attachment example %q", field.Examples[0])
+			}
+		})
+	}
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		header := testEBML(ebmlHeaderID, testEBML(0x4282, []byte("webm")))
+		valid := buildTestMKV(false)
+		invalid := [][]byte{
+			[]byte("not a matroska file"),
+			valid[:len(valid)-3],
+			append(append([]byte{}, header...), testEBML(mkvSegmentID, testEBMLUnknown(mkvInfoID, testEBML(mkvTitleID, []byte("x"))))...),
+			append(append([]byte{}, header...), 0x00, 0x00, 0x00),
+		}
+		for i, data := range invalid {
+			if err := proc.stripMKV(bytes.NewReader(data), int64(len(data)), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanMKV(t *testing.T) {
+	tempDir, proc, cleanup := setupVideoTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "recording.webm")
+	if err := os.WriteFile(filePath, buildTestMKV(true), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessVideo(filePath, ".webm"); err != nil {
+		t.Fatalf("Failed to clean WebM: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("payroll")) || !bytes.Contains(data, []byte("video frame")) {
+		t.Error("WebM was not cleaned correctly")
+	}
+}
@@ -0,0 +1,512 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"metadata-remover/src/stats"
+)
+
+// Sizes of the fixed tag structures
+const (
+	id3v2HeaderSize   = 10
+	id3v1Size         = 128
+	id3v1ExtendedSize = 227 // "TAG+" block stored before an ID3v1 tag
+	apeFooterSize     = 32
+	lyrics3v1MaxSize  = 5100 + 20
+)
+
+// id3v2MaxParse caps the size of an ID3v2 tag read to report its frames
+const id3v2MaxParse = 16 << 20
+
+// mp3MaxSyncSearch caps how far past the tags the first MPEG frame is looked for
+const mp3MaxSyncSearch = 64 << 10
+
+// id3FrameNames names the ID3v2 frames reported in statistics; both the
+// four-character and the three-character ID3v2.2 IDs are listed
+var id3FrameNames = map[string]string{
+	"TIT2": "Title", "TT2": "Title",
+	"TPE1": "Artist", "TP1": "Artist",
+	"TPE2": "Album artist", "TP2": "Album artist",
+	"TALB": "Album", "TAL": "Album",
+	"TCOM": "Composer", "TCM": "Composer",
+	"TYER": "Year", "TYE": "Year", "TDRC": "Recording time",
+	"TCON": "Genre", "TCO": "Genre",
+	"TRCK": "Track", "TRK": "Track",
+	"TCOP": "Copyright", "TCR": "Copyright",
+	"TENC": "Encoded by", "TEN": "Encoded by",
+	"TSSE": "Encoder settings", "TSS": "Encoder settings",
+	"TXXX": "User text", "TXX": "User text",
+	"WXXX": "User URL", "WXX": "User URL",
+	"COMM": "Comment", "COM": "Comment",
+	"USLT": "Lyrics", "ULT": "Lyrics",
+	"APIC": "Cover art", "PIC": "Cover art",
+	"GEOB": "Embedded object", "GEO": "Embedded object",
+	"PRIV": "Private frame",
+	"UFID": "Unique file ID", "UFI": "Unique file ID",
+	"TOWN": "File owner",
+	"TDEN": "Encoding time",
+	"TDTG": "Tagging time",
+}
+
+// cleanMP3 removes ID3 and APE tags from MP3 files
+func (p *Processor) cleanMP3(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripMP3(file, info.Size(), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripMP3 copies the MPEG audio frames between the tags at the start and end of the file.
+// Tags are peeled off repeatedly since taggers often stack several of them.
+func (p *Processor) stripMP3(r io.ReaderAt, size int64, w io.Writer) error {
+	start, end := int64(0), size
+
+	for {
+		n, err := p.leadingMP3Tag(r, start, end)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		start += n
+	}
+
+	for {
+		n, err := p.trailingMP3Tag(r, start, end)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		end -= n
+	}
+
+	// The audio starts at the first MPEG frame; padding or junk left before it
+	// by taggers is dropped
+	start, err := findMPEGFrame(r, start, end)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, io.NewSectionReader(r, start, end-start))
+	return err
+}
+
+// findMPEGFrame returns the offset of the first valid MPEG frame header found
+// within mp3MaxSyncSearch bytes of start
+func findMPEGFrame(r io.ReaderAt, start, end int64) (int64, error) {
+	n := end - start
+	if n > mp3MaxSyncSearch+4 {
+		n = mp3MaxSyncSearch + 4
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+	for i := 0; i+4 <= len(buf); i++ {
+		if isMPEGFrameHeader(buf[i : i+4]) {
+			return start + int64(i), nil
+		}
+	}
+	return 0, errors.New("no MPEG audio frames found")
+}
+
+// isMPEGFrameHeader reports whether b starts with a frame sync followed by a
+// version, layer, bitrate and sample rate that are not reserved values
+func isMPEGFrameHeader(b []byte) bool {
+	return b[0] == 0xFF && b[1]&0xE0 == 0xE0 &&
+		b[1]>>3&3 != 1 && b[1]>>1&3 != 0 &&
+		b[2]>>4 != 0xF && b[2]>>2&3 != 3
+}
+
+// leadingMP3Tag returns the size of an ID3v2 or APE tag at start, or zero if there is none
+func (p *Processor) leadingMP3Tag(r io.ReaderAt, start, end int64) (int64, error) {
+	header := make([]byte, apeFooterSize)
+	n, _ := r.ReadAt(header, start)
+	header = header[:n]
+
+	switch {
+	case len(header) >= id3v2HeaderSize && string(header[:3]) == "ID3":
+		size, err := id3v2TagSize(header[:id3v2HeaderSize])
+		if err != nil {
+			return 0, err
+		}
+		if size > end-start {
+			return 0, errors.New("truncated ID3v2 tag")
+		}
+		p.reportID3v2(r, start, size)
+		return size, nil
+
+	case len(header) == apeFooterSize && string(header[:8]) == "APETAGEX":
+		size := int64(binary.LittleEndian.Uint32(header[12:])) + apeFooterSize
+		if size > end-start {
+			return 0, errors.New("truncated APE tag")
+		}
+		p.reportAPE(r, start+apeFooterSize, size-2*apeFooterSize)
+		return size, nil
+	}
+
+	return 0, nil
+}
+
+// trailingMP3Tag returns the size of an ID3v1, ID3v2, APE or Lyrics3 tag ending at end,
+// or zero if there is none
+func (p *Processor) trailingMP3Tag(r io.ReaderAt, start, end int64) (int64, error) {
+	available := end - start
+
+	// ID3v1, possibly preceded by an extended "TAG+" block
+	if available >= id3v1Size {
+		tag := make([]byte, id3v1Size)
+		if _, err := r.ReadAt(tag, end-id3v1Size); err != nil {
+			return 0, err
+		}
+		if string(tag[:3]) == "TAG" {
+			p.reportID3v1(tag)
+			size := int64(id3v1Size)
+			if available >= id3v1Size+id3v1ExtendedSize {
+				marker := make([]byte, 4)
+				if _, err := r.ReadAt(marker, end-id3v1Size-id3v1ExtendedSize); err == nil && string(marker) == "TAG+" {
+					size += id3v1ExtendedSize
+				}
+			}
+			return size, nil
+		}
+	}
+
+	if available < id3v2HeaderSize {
+		return 0, nil
+	}
+	tail := make([]byte, apeFooterSize)
+	if available < apeFooterSize {
+		tail = tail[apeFooterSize-id3v2HeaderSize:]
+	}
+	if _, err := r.ReadAt(tail, end-int64(len(tail))); err != nil {
+		return 0, err
+	}
+
+	// ID3v2 tag with a footer
+	footer := tail[len(tail)-id3v2HeaderSize:]
+	if string(footer[:3]) == "3DI" {
+		size, err := id3v2TagSize(footer)
+		if err != nil {
+			return 0, err
+		}
+		if size > available {
+			return 0, errors.New("truncated ID3v2 tag")
+		}
+		p.reportID3v2(r, end-size, size)
+		return size, nil
+	}
+
+	// APEv2 footer, with the header included in the tag when flagged
+	if len(tail) == apeFooterSize && string(tail[:8]) == "APETAGEX" {
+		tagSize := int64(binary.LittleEndian.Uint32(tail[12:])) // Items and footer
+		size := tagSize
+		if binary.LittleEndian.Uint32(tail[20:])&(1<<31) != 0 {
+			size += apeFooterSize
+		}
+		if size > available || tagSize < apeFooterSize {
+			return 0, errors.New("invalid APE tag size")
+		}
+		p.reportAPE(r, end-tagSize, tagSize-apeFooterSize)
+		return size, nil
+	}
+
+	// Lyrics3 tags end in a marker preceded by their size or a begin marker
+	if marker := string(tail[len(tail)-9:]); marker == "LYRICS200" && available >= 15 {
+		digits := make([]byte, 6)
+		if _, err := r.ReadAt(digits, end-15); err != nil {
+			return 0, err
+		}
+		lyricsSize, err := strconv.ParseInt(string(digits), 10, 64)
+		if err != nil || lyricsSize+15 > available {
+			return 0, errors.New("invalid Lyrics3 tag size")
+		}
+		p.Stats.AddMetadata(stats.TypeAudio, "Lyrics3", "")
+		return lyricsSize + 15, nil
+	} else if marker == "LYRICSEND" {
+		window := int64(lyrics3v1MaxSize)
+		if window > available {
+			window = available
+		}
+		block := make([]byte, window)
+		if _, err := r.ReadAt(block, end-window); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndex(block, []byte("LYRICSBEGIN")); i >= 0 {
+			p.Stats.AddMetadata(stats.TypeAudio, "Lyrics3", "")
+			return window - int64(i), nil
+		}
+	}
+
+	return 0, nil
+}
+
+// id3v2TagSize returns the total size of an ID3v2 tag from its header or footer
+func id3v2TagSize(header []byte) (int64, error) {
+	if header[3] < 2 || header[3] > 4 || header[4] == 0xFF {
+		return 0, fmt.Errorf("unsupported ID3v2 version 2.%d", header[3])
+	}
+	size, ok := syncsafe(header[6:10])
+	if !ok {
+		return 0, errors.New("invalid ID3v2 tag size")
+	}
+	size += id3v2HeaderSize
+	if header[5]&0x10 != 0 {
+		size += id3v2HeaderSize // Footer
+	}
+	return size, nil
+}
+
+// syncsafe decodes an integer stored in 7-bit bytes
+func syncsafe(b []byte) (int64, bool) {
+	var v int64
+	for _, c := range b {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		v = v<<7 | int64(c)
+	}
+	return v, true
+}
+
+// reportID3v2 records the frames of an ID3v2 tag in statistics
+func (p *Processor) reportID3v2(r io.ReaderAt, offset, size int64) {
+	if size > id3v2MaxParse {
+		p.Stats.AddMetadata(stats.TypeAudio, "ID3v2", "")
+		return
+	}
+	tag := make([]byte, size)
+	if _, err := r.ReadAt(tag, offset); err != nil {
+		p.Stats.AddMetadata(stats.TypeAudio, "ID3v2", "")
+		return
+	}
+	version, flags := tag[3], tag[5]
+	frames := tag[id3v2HeaderSize:]
+	if flags&0x10 != 0 && len(frames) >= id3v2HeaderSize {
+		frames = frames[:len(frames)-id3v2HeaderSize]
+	}
+
+	// Whole-tag unsynchronisation hides the frame layout, so only the tag is reported
+	if flags&0x80 != 0 && version < 4 {
+		p.Stats.AddMetadata(stats.TypeAudio, "ID3v2", "")
+		return
+	}
+
+	// Skip the extended header
+	if flags&0x40 != 0 && len(frames) >= 4 {
+		var extended int64
+		if version == 4 {
+			extended, _ = syncsafe(frames[:4])
+		} else {
+			extended = int64(binary.BigEndian.Uint32(frames)) + 4
+		}
+		if extended > int64(len(frames)) {
+			extended = int64(len(frames))
+		}
+		frames = frames[extended:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	reported := false
+	for len(frames) >= headerSize && frames[0] != 0 {
+		id := string(frames[:idSize])
+		var frameSize int64
+		switch version {
+		case 2:
+			frameSize = int64(frames[3])<<16 | int64(frames[4])<<8 | int64(frames[5])
+		case 3:
+			frameSize = int64(binary.BigEndian.Uint32(frames[4:]))
+		default:
+			frameSize, _ = syncsafe(frames[4:8])
+		}
+		if frameSize > int64(len(frames)-headerSize) {
+			break
+		}
+		body := frames[headerSize : int64(headerSize)+frameSize]
+		frames = frames[int64(headerSize)+frameSize:]
+
+		name, ok := id3FrameNames[id]
+		if !ok {
+			name = "ID3 " + id
+		}
+		example := ""
+		if len(body) > 0 && (id[0] == 'T' || id == "COMM" || id == "COM") {
+			if id == "COMM" || id == "COM" {
+				// Skip the language code
+				if len(body) > 4 {
+					body = append([]byte{body[0]}, body[4:]...)
+				} else {
+					body = body[:1]
+				}
+			}
+			example = id3Text(body[0], body[1:])
+		}
+		p.Stats.AddMetadata(stats.TypeAudio, name, metadataExample(example))
+		reported = true
+	}
+
+	if !reported {
+		p.Stats.AddMetadata(stats.TypeAudio, "ID3v2", "")
+	}
+}
+
+// id3Text decodes the strings of a text frame and joins them
+func id3Text(encoding byte, b []byte) string {
+	var parts []string
+	switch encoding {
+	case 1, 2:
+		var bigEndian = encoding == 2
+		for len(b) >= 2 {
+			end := len(b) &^ 1
+			for i := 0; i+1 < len(b); i += 2 {
+				if b[i] == 0 && b[i+1] == 0 {
+					end = i
+					break
+				}
+			}
+			part := b[:end]
+			if end+2 <= len(b) {
+				b = b[end+2:]
+			} else {
+				b = nil
+			}
+
+			be := bigEndian
+			if len(part) >= 2 && part[0] == 0xFE && part[1] == 0xFF {
+				be, part = true, part[2:]
+			} else if len(part) >= 2 && part[0] == 0xFF && part[1] == 0xFE {
+				be, part = false, part[2:]
+			}
+			units := make([]uint16, len(part)/2)
+			for i := range units {
+				if be {
+					units[i] = binary.BigEndian.Uint16(part[2*i:])
+				} else {
+					units[i] = binary.LittleEndian.Uint16(part[2*i:])
+				}
+			}
+			parts = append(parts, string(utf16.Decode(units)))
+		}
+	case 3:
+		parts = strings.Split(string(b), "\x00")
+	default:
+		for _, part := range bytes.Split(b, []byte{0}) {
+			runes := make([]rune, len(part))
+			for i, c := range part {
+				runes[i] = rune(c) // ISO-8859-1 maps directly to Unicode
+			}
+			parts = append(parts, string(runes))
+		}
+	}
+
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, ": ")
+}
+
+// reportID3v1 records the fields of an ID3v1 tag in statistics
+func (p *Processor) reportID3v1(tag []byte) {
+	field := func(b []byte) string {
+		return strings.TrimSpace(string(bytes.TrimRight(b, "\x00 ")))
+	}
+	example := field(tag[33:63])
+	if title := field(tag[3:33]); title != "" {
+		if example != "" {
+			example += " - "
+		}
+		example += title
+	}
+	p.Stats.AddMetadata(stats.TypeAudio, "ID3v1", metadataExample(example))
+}
+
+// reportAPE records the items of an APEv2 tag in statistics
+func (p *Processor) reportAPE(r io.ReaderAt, offset, size int64) {
+	if size <= 0 || size > id3v2MaxParse {
+		p.Stats.AddMetadata(stats.TypeAudio, "APE", "")
+		return
+	}
+	items := make([]byte, size)
+	if _, err := r.ReadAt(items, offset); err != nil {
+		p.Stats.AddMetadata(stats.TypeAudio, "APE", "")
+		return
+	}
+
+	reported := false
+	for len(items) >= 9 {
+		valueSize := int64(binary.LittleEndian.Uint32(items))
+		flags := binary.LittleEndian.Uint32(items[4:])
+		keyEnd := bytes.IndexByte(items[8:], 0)
+		if keyEnd < 0 || valueSize > int64(len(items)-9-keyEnd) {
+			break
+		}
+		key := string(items[8 : 8+keyEnd])
+		value := items[9+keyEnd : int64(9+keyEnd)+valueSize]
+		items = items[int64(9+keyEnd)+valueSize:]
+
+		example := ""
+		if flags&0x06 == 0 {
+			example = strings.ReplaceAll(string(value), "\x00", ", ")
+		}
+		p.Stats.AddMetadata(stats.TypeAudio, "APE "+key, metadataExample(example))
+		reported = true
+	}
+
+	if !reported {
+		p.Stats.AddMetadata(stats.TypeAudio, "APE", "")
+	}
+}
@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMPEGFrames stands in for the audio of the test files
+var testMPEGFrames = bytes.Repeat(append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 12)...), 4)
+
+// testSyncsafe encodes a syncsafe integer
+func testSyncsafe(v int) []byte {
+	return []byte{byte(v >> 21 & 0x7F), byte(v >> 14 & 0x7F), byte(v >> 7 & 0x7F), byte(v & 0x7F)}
+}
+
+// testID3Frame builds an ID3v2.3 or ID3v2.4 frame
+func testID3Frame(version byte, id string, body []byte) []byte {
+	frame := []byte(id)
+	if version == 4 {
+		frame = append(frame, testSyncsafe(len(body))...)
+	} else {
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+	}
+	frame = append(frame, 0, 0)
+	return append(frame, body...)
+}
+
+// testID3v2 builds a tag from its frames, followed by a footer when the flag is set
+func testID3v2(version, flags byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	tag := append([]byte{'I', 'D', '3', version, 0, flags}, testSyncsafe(len(body))...)
+	tag = append(tag, body...)
+	if flags&0x10 != 0 {
+		tag = append(tag, '3', 'D', 'I', version, 0, flags)
+		tag = append(tag, testSyncsafe(len(body))...)
+	}
+	return tag
+}
+
+// testID3v1 builds an ID3v1.1 tag
+func testID3v1(title, artist string) []byte {
+	tag := make([]byte, id3v1Size)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	tag[126] = 7 // Track number
+	return tag
+}
+
+// testAPETag builds an APEv2 tag with a header and footer
+func testAPETag(items ...[2]string) []byte {
+	var body []byte
+	for _, item := range items {
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(item[1])))
+		body = binary.LittleEndian.AppendUint32(body, 0)
+		body = append(body, item[0]...)
+		body = append(body, 0)
+		body = append(body, item[1]...)
+	}
+	block := func(flags uint32) []byte {
+		b := []byte("APETAGEX")
+		b = binary.LittleEndian.AppendUint32(b, 2000)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(body)+apeFooterSize))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(items)))
+		b = binary.LittleEndian.AppendUint32(b, flags)
+		return append(b, make([]byte, 8)...)
+	}
+	tag := block(1<<31 | 1<<29)
+	tag = append(tag, body...)
+	return append(tag, block(1<<31)...)
+}
+
+func TestStripMP3(t *testing.T) {
+	v23 := testID3v2(3, 0,
+		testID3Frame(3, "TIT2", []byte("\x00Episode 12")),
+		testID3Frame(3, "TXXX", []byte("\x01\xFF\xFEP\x00r\x00\x00\x00\xFF\xFEX\x00")),
+		testID3Frame(3, "COMM", []byte("\x03engdesc\x00Recorded at HQ")),
+		testID3Frame(3, "APIC", []byte("\x00image/jpeg\x00\x03\x00JPEGDATA")),
+		make([]byte, 32), // Padding
+	)
+	extended := append(testSyncsafe(6), 1, 0)
+	v24 := testID3v2(4, 0x50, extended, testID3Frame(4, "TSSE", []byte("\x03LAME 3.100 -V2")))
+
+	cases := []struct {
+		name   string
+		input  []byte
+		report []string
+	}{
+		{"ID3v2.3 header", bytes.Join([][]byte{v23, testMPEGFrames}, nil), []string{"Title", "User text", "Comment", "Cover art"}},
+		{"ID3v2.4 with footer at both ends", bytes.Join([][]byte{v24, testMPEGFrames, v24}, nil), []string{"Encoder settings"}},
+		{"ID3v1.1 trailer", bytes.Join([][]byte{testMPEGFrames, testID3v1("Secret Song", "Jane")}, nil), []string{"ID3v1"}},
+		{"Extended ID3v1", bytes.Join([][]byte{testMPEGFrames, append([]byte("TAG+"), make([]byte, 223)...), testID3v1("x", "y")}, nil), []string{"ID3v1"}},
+		{"APEv2 before ID3v1", bytes.Join([][]byte{v23, testMPEGFrames, testAPETag([2]string{"Artist", "Jane"}), testID3v1("x", "y")}, nil), []string{"APE Artist", "ID3v1"}},
+		{"Leading APEv2", bytes.Join([][]byte{testAPETag([2]string{"Title", "x"}), testMPEGFrames}, nil), []string{"APE Title"}},
+		{"Lyrics3v2", bytes.Join([][]byte{testMPEGFrames, []byte("LYRICSBEGININD00002" + "10"), []byte(fmt.Sprintf("%06d", 21)), []byte("LYRICS200"), testID3v1("x", "y")}, nil), []string{"Lyrics3"}},
+		{"Padding after ID3v2", bytes.Join([][]byte{v23, make([]byte, 1000), testMPEGFrames}, nil), []string{"Title"}},
+		{"Junk after ID3v2", bytes.Join([][]byte{v23, []byte("junk\xFF\xE0\xFF\xFB\xF0"), testMPEGFrames}, nil), []string{"Title"}},
+		{"No tags", testMPEGFrames, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			proc := NewProcessor(nil, false)
+			output := runStrip(t, func(w io.Writer) error {
+				return proc.stripMP3(bytes.NewReader(tc.input), int64(len(tc.input)), w)
+			})
+			if !bytes.Equal(output, testMPEGFrames) {
+				t.Errorf("Output is not the bare MPEG frames: %q", output)
+			}
+			for _, name := range tc.report {
+				if proc.Stats.ByMetadataType[name] == nil {
+					t.Errorf("%s was not reported in statistics", name)
+				}
+			}
+		})
+	}
+
+	t.Run("Frame values reported", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := append(append([]byte{}, v23...), testMPEGFrames...)
+		runStrip(t, func(w io.Writer) error {
+			return proc.stripMP3(bytes.NewReader(input), int64(len(input)), w)
+		})
+		expected := map[string]string{
+			"Title":     "Episode 12",
+			"User text": "Pr: X",
+			"Comment":   "desc: Recorded at HQ",
+		}
+		for name, value := range expected {
+			if field := proc.Stats.ByMetadataType[name]; field == nil || field.Examples[0] != value {
+				t.Errorf("%s was not reported with value %q", name, value)
+			}
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := [][]byte{
+			[]byte("not an mp3 file"),
+			testID3v2(3, 0, testID3Frame(3, "TIT2", []byte("\x00x"))),
+			append([]byte{'I', 'D', '3', 3, 0, 0, 0x7F, 0x7F, 0x7F, 0x7F}, testMPEGFrames...),
+			append([]byte{'I', 'D', '3', 9, 0, 0, 0, 0, 0, 0}, testMPEGFrames...),
+			bytes.Join([][]byte{v23, make([]byte, mp3MaxSyncSearch+1), testMPEGFrames}, nil),
+		}
+		for i, data := range invalid {
+			if err := proc.stripMP3(bytes.NewReader(data), int64(len(data)), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanMP3(t *testing.T) {
+	tempDir, proc, cleanup := setupAudioTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "episode.mp3")
+	input := bytes.Join([][]byte{
+		testID3v2(3, 0, testID3Frame(3, "TXXX", []byte("\x00project\x00Internal Codename"))),
+		testMPEGFrames,
+		testID3v1("Internal Codename", ""),
+	}, nil)
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessAudio(filePath, ".mp3"); err != nil {
+		t.Fatalf("Failed to clean MP3: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if !bytes.Equal(data, testMPEGFrames) {
+		t.Error("Tags still present after cleaning")
+	}
+}
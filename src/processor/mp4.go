@@ -0,0 +1,435 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// mp4EpochOffset is the number of seconds between 1904 and 1970
+const mp4EpochOffset = 2082844800
+
+// mp4XMPUUID identifies uuid boxes holding an XMP packet
+var mp4XMPUUID = []byte{0xBE, 0x7A, 0xCF, 0xCB, 0x97, 0xA9, 0x42, 0xE8, 0x9C, 0x71, 0x99, 0x94, 0x91, 0xE3, 0xAF, 0xAC}
+
+// mp4ItemNames names the user data and iTunes items reported in statistics
+var mp4ItemNames = map[string]string{
+	"\xa9xyz": "GPS location",
+	"\xa9mak": "Make",
+	"\xa9mod": "Model",
+	"\xa9swr": "Software",
+	"\xa9too": "Encoder",
+	"\xa9day": "Date",
+	"\xa9nam": "Title",
+	"\xa9ART": "Artist",
+	"\xa9alb": "Album",
+	"\xa9cmt": "Comment",
+	"\xa9des": "Description",
+	"covr":    "Cover art",
+	"loci":    "GPS location",
+}
+
+// mp4Rebuild collects the rewritten moov box
+type mp4Rebuild struct {
+	fileType    string
+	fragmented  bool // Removed boxes become free space so fragment offsets stay valid
+	out         []byte
+	chunkTables []mp4ChunkTable
+}
+
+// mp4ChunkTable locates the entries of a stco or co64 box in the rebuilt moov box
+type mp4ChunkTable struct {
+	pos       int
+	count     int
+	entrySize int // 4 for stco, 8 for co64
+}
+
+// cleanMP4 removes metadata from MP4, MOV and M4A files
+func (p *Processor) cleanMP4(filePath, fileType string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripMP4(file, info.Size(), writer, fileType); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripMP4 removes metadata boxes and zeroes the header timestamps. Only the moov box
+// is held in memory; other boxes are copied straight from r. When boxes in front of
+// the media data shrink, the chunk offsets are moved to match. Fragmented files keep
+// their layout instead, with removed boxes turned into free space.
+func (p *Processor) stripMP4(r io.ReaderAt, size int64, w io.Writer, fileType string) error {
+	boxes, err := readBMFFBoxes(r, 0, size)
+	if err != nil {
+		return err
+	}
+	moov, ok := findBMFFBox(boxes, "moov")
+	if !ok {
+		return errors.New("not a valid MP4 file")
+	}
+	_, fragmented := findBMFFBox(boxes, "moof")
+
+	data := make([]byte, moov.end-moov.start)
+	if _, err := r.ReadAt(data, moov.start); err != nil {
+		return errors.New("truncated moov box")
+	}
+	rb := &mp4Rebuild{fileType: fileType, fragmented: fragmented}
+	moovBox := bmffBox{typ: "moov", headerSize: moov.headerSize, end: int64(len(data))}
+	if err := p.rebuildMP4Box(rb, data, moovBox); err != nil {
+		return err
+	}
+
+	// Lay out the top-level boxes
+	removed := make([]bool, len(boxes))
+	newStart := make([]int64, len(boxes))
+	pos := int64(0)
+	for i, box := range boxes {
+		newStart[i] = pos
+		if box.start == moov.start {
+			pos += int64(len(rb.out))
+			continue
+		}
+		if removed[i], err = p.removeTopLevelMP4Box(r, box, fileType); err != nil {
+			return err
+		}
+		if !removed[i] || fragmented {
+			pos += box.end - box.start
+		}
+	}
+
+	// Move the chunk offsets into the new layout
+	if !fragmented {
+		mapOffset := func(offset uint64) (uint64, error) {
+			for i, box := range boxes {
+				if offset < uint64(box.start) || offset >= uint64(box.end) {
+					continue
+				}
+				if removed[i] || box.start == moov.start {
+					break
+				}
+				return uint64(newStart[i]) + offset - uint64(box.start), nil
+			}
+			return 0, fmt.Errorf("chunk offset %d is outside the media data", offset)
+		}
+		if err := rb.remapChunkOffsets(mapOffset); err != nil {
+			return err
+		}
+	}
+
+	// Write the file
+	for i, box := range boxes {
+		var err error
+		switch {
+		case box.start == moov.start:
+			_, err = w.Write(rb.out)
+		case removed[i] && fragmented:
+			_, err = w.Write(appendMP4Free(nil, box.end-box.start))
+		case removed[i]:
+			continue
+		default:
+			_, err = io.Copy(w, io.NewSectionReader(r, box.start, box.end-box.start))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTopLevelMP4Box reads the payload of a top-level metadata box and decides whether it is dropped
+func (p *Processor) removeTopLevelMP4Box(r io.ReaderAt, box bmffBox, fileType string) (bool, error) {
+	size := box.payloadSize()
+	switch box.typ {
+	case "udta", "meta":
+	case "uuid":
+		if size > int64(len(mp4XMPUUID)) {
+			size = int64(len(mp4XMPUUID))
+		}
+	case "free", "skip":
+		return true, nil
+	default:
+		return false, nil
+	}
+
+	payload := make([]byte, size)
+	if _, err := r.ReadAt(payload, box.payloadStart()); err != nil {
+		return false, fmt.Errorf("truncated %q box", box.typ)
+	}
+	return p.removeMP4Box(fileType, box.typ, payload), nil
+}
+
+// removeMP4Box decides whether a box is dropped and records the metadata it holds
+func (p *Processor) removeMP4Box(fileType, typ string, payload []byte) bool {
+	switch typ {
+	case "udta":
+		p.reportMP4UserData(fileType, payload)
+		return true
+	case "meta":
+		p.reportMP4Meta(fileType, payload)
+		return true
+	case "uuid":
+		if !bytes.HasPrefix(payload, mp4XMPUUID) {
+			return false
+		}
+		p.Stats.AddMetadata(fileType, "XMP", "")
+		return true
+	case "free", "skip":
+		// Free space may hold leftovers of earlier edits
+		return true
+	default:
+		return false
+	}
+}
+
+// rebuildMP4Box appends a box to the rebuilt moov box, recursing into containers
+func (p *Processor) rebuildMP4Box(rb *mp4Rebuild, data []byte, box bmffBox) error {
+	headerPos := len(rb.out)
+	rb.out = append(rb.out, data[box.start:box.payloadStart()]...)
+	payload := data[box.payloadStart():box.end]
+
+	switch box.typ {
+	case "moov", "trak", "mdia", "minf", "stbl":
+		// Containers on the way to the headers and sample tables
+		children, err := readBMFFBoxes(bytes.NewReader(data), box.payloadStart(), box.end)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if p.removeMP4Box(rb.fileType, child.typ, data[child.payloadStart():child.end]) {
+				if rb.fragmented {
+					rb.out = appendMP4Free(rb.out, child.end-child.start)
+				}
+				continue
+			}
+			if err := p.rebuildMP4Box(rb, data, child); err != nil {
+				return err
+			}
+		}
+	case "mvhd", "tkhd", "mdhd":
+		start := len(rb.out)
+		rb.out = append(rb.out, payload...)
+		if err := p.zeroMP4Times(rb.fileType, box.typ, rb.out[start:]); err != nil {
+			return err
+		}
+	case "stco", "co64":
+		table := mp4ChunkTable{pos: len(rb.out) + 8, entrySize: 4}
+		if box.typ == "co64" {
+			table.entrySize = 8
+		}
+		f := &bmffFields{data: payload}
+		f.next(4)
+		count := f.u32()
+		if f.err != nil || uint64(count)*uint64(table.entrySize) > uint64(len(payload)-8) {
+			return fmt.Errorf("invalid %s box", box.typ)
+		}
+		table.count = int(count)
+		rb.chunkTables = append(rb.chunkTables, table)
+		rb.out = append(rb.out, payload...)
+	default:
+		rb.out = append(rb.out, payload...)
+	}
+
+	// Boxes only shrink, so the original header form always fits the new size
+	size := len(rb.out) - headerPos
+	if box.headerSize == 16 {
+		binary.BigEndian.PutUint64(rb.out[headerPos+8:], uint64(size))
+	} else {
+		binary.BigEndian.PutUint32(rb.out[headerPos:], uint32(size))
+	}
+	return nil
+}
+
+// remapChunkOffsets passes every chunk offset in the rebuilt moov box through mapOffset
+func (rb *mp4Rebuild) remapChunkOffsets(mapOffset func(uint64) (uint64, error)) error {
+	for _, table := range rb.chunkTables {
+		for i := 0; i < table.count; i++ {
+			field := rb.out[table.pos+i*table.entrySize:]
+			if table.entrySize == 4 {
+				offset, err := mapOffset(uint64(binary.BigEndian.Uint32(field)))
+				if err != nil {
+					return err
+				}
+				if offset > math.MaxUint32 {
+					return errors.New("chunk offset does not fit in a stco box")
+				}
+				binary.BigEndian.PutUint32(field, uint32(offset))
+				continue
+			}
+			offset, err := mapOffset(binary.BigEndian.Uint64(field))
+			if err != nil {
+				return err
+			}
+			binary.BigEndian.PutUint64(field, offset)
+		}
+	}
+	return nil
+}
+
+// zeroMP4Times clears the creation and modification times of a movie, track or media header
+func (p *Processor) zeroMP4Times(fileType, typ string, payload []byte) error {
+	var created uint64
+	switch {
+	case len(payload) >= 20 && payload[0] == 1:
+		created = binary.BigEndian.Uint64(payload[4:])
+		copy(payload[4:20], make([]byte, 16))
+	case len(payload) >= 12 && payload[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(payload[4:]))
+		copy(payload[4:12], make([]byte, 8))
+	default:
+		return fmt.Errorf("invalid %s box", typ)
+	}
+
+	if created != 0 {
+		example := ""
+		if created > mp4EpochOffset {
+			example = time.Unix(int64(created-mp4EpochOffset), 0).UTC().Format(time.RFC3339)
+		}
+		p.Stats.AddMetadata(fileType, "Creation time", example)
+	}
+	return nil
+}
+
+// reportMP4UserData records the items of a udta box
+func (p *Processor) reportMP4UserData(fileType string, payload []byte) {
+	items, err := readBMFFBoxes(bytes.NewReader(payload), 0, int64(len(payload)))
+	if err != nil {
+		// QuickTime user data may end with a 32-bit terminator
+		items, err = readBMFFBoxes(bytes.NewReader(payload), 0, int64(len(payload))-4)
+	}
+	if err != nil {
+		p.Stats.AddMetadata(fileType, "User data", "")
+		return
+	}
+
+	for _, item := range items {
+		value := payload[item.payloadStart():item.end]
+		if item.typ == "meta" {
+			p.reportMP4Meta(fileType, value)
+			continue
+		}
+
+		// QuickTime text items start with a 16-bit length and a language code
+		example := ""
+		if strings.HasPrefix(item.typ, "\xa9") && len(value) >= 4 {
+			if n := int(binary.BigEndian.Uint16(value)); n <= len(value)-4 {
+				example = string(value[4 : 4+n])
+			}
+		}
+		p.Stats.AddMetadata(fileType, mp4ItemName(item.typ), metadataExample(example))
+	}
+}
+
+// reportMP4Meta records the items of an iTunes or QuickTime metadata box
+func (p *Processor) reportMP4Meta(fileType string, payload []byte) {
+	// QuickTime meta boxes lack the version and flags of the ISO full box
+	start := int64(4)
+	if len(payload) >= 8 && string(payload[4:8]) == "hdlr" {
+		start = 0
+	}
+	if int64(len(payload)) < start {
+		p.Stats.AddMetadata(fileType, "Metadata", "")
+		return
+	}
+
+	r := bytes.NewReader(payload)
+	children, err := readBMFFBoxes(r, start, int64(len(payload)))
+	ilst, hasILST := findBMFFBox(children, "ilst")
+	if err != nil || !hasILST {
+		p.Stats.AddMetadata(fileType, "Metadata", "")
+		return
+	}
+
+	// QuickTime items are numbered after the key table
+	var keys []string
+	if keyBox, ok := findBMFFBox(children, "keys"); ok {
+		f := &bmffFields{data: payload[keyBox.payloadStart():keyBox.end]}
+		f.next(4)
+		count := f.u32()
+		for i := uint32(0); i < count && f.err == nil; i++ {
+			size := int(f.u32())
+			f.next(4) // Namespace
+			keys = append(keys, string(f.next(size-8)))
+		}
+	}
+
+	items, err := readBMFFBoxes(r, ilst.payloadStart(), ilst.end)
+	if err != nil {
+		p.Stats.AddMetadata(fileType, "Metadata", "")
+		return
+	}
+	for _, item := range items {
+		name := mp4ItemName(item.typ)
+		if index := binary.BigEndian.Uint32([]byte(item.typ)); index >= 1 && int(index) <= len(keys) {
+			name = keys[index-1]
+		}
+
+		// Text values sit in a data box tagged as UTF-8
+		example := ""
+		values, _ := readBMFFBoxes(r, item.payloadStart(), item.end)
+		if data, ok := findBMFFBox(values, "data"); ok && data.payloadSize() >= 8 {
+			value := payload[data.payloadStart():data.end]
+			if binary.BigEndian.Uint32(value)&0xFFFFFF == 1 {
+				example = string(value[8:])
+			}
+		}
+		p.Stats.AddMetadata(fileType, name, metadataExample(example))
+	}
+}
+
+// mp4ItemName returns the statistics name of a user data or iTunes item
+func mp4ItemName(typ string) string {
+	if name, ok := mp4ItemNames[typ]; ok {
+		return name
+	}
+	return strings.TrimPrefix(typ, "\xa9")
+}
+
+// appendMP4Free appends a zero-filled free box of the given total size
+func appendMP4Free(out []byte, size int64) []byte {
+	header := bmffHeader("free", size-8)
+	if len(header) == 16 {
+		header = bmffHeader("free", size-16)
+	}
+	out = append(out, header...)
+	return append(out, make([]byte, size-int64(len(header)))...)
+}
@@ -0,0 +1,202 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"metadata-remover/src/stats"
+)
+
+// testMP4Chunks are the chunks stored in the mdat box of the test files
+var testMP4Chunks = [][]byte{[]byte("first chunk"), []byte("second chunk")}
+
+// testMP4Layout describes a test file
+type testMP4Layout struct {
+	moovFirst  bool
+	co64       bool
+	fragmented bool
+}
+
+// buildTestMP4 builds a file whose chunk offsets point at testMP4Chunks
+func buildTestMP4(layout testMP4Layout) []byte {
+	ftyp := testBox("ftyp", []byte("isom"), testU32(0x200), []byte("isomiso2mp41"))
+	xmp := testBox("uuid", mp4XMPUUID, []byte("<x:xmpmeta/>"))
+	mdat := testBox("mdat", testMP4Chunks...)
+
+	build := func(offsets []uint64) []byte {
+		var entries []byte
+		for _, offset := range offsets {
+			if layout.co64 {
+				entries = binary.BigEndian.AppendUint64(entries, offset)
+			} else {
+				entries = append(entries, testU32(uint32(offset))...)
+			}
+		}
+		chunkBox := "stco"
+		if layout.co64 {
+			chunkBox = "co64"
+		}
+
+		userData := testBox("udta",
+			testBox("\xa9xyz", testU16(18), testU16(0x15C7), []byte("+37.7749-122.4194/")),
+			testBox("\xa9mak", testU16(5), testU16(0x15C7), []byte("Apple")),
+			testU32(0), // QuickTime terminator
+		)
+		keys := testFullBox("keys", 0, 0, testU32(1), testU32(33), []byte("mdta"), []byte("com.apple.quicktime.model"))
+		items := testBox("ilst", testBox("\x00\x00\x00\x01", testBox("data", testU32(1), testU32(0), []byte("iPhone 15 Pro"))))
+		meta := testBox("meta", testFullBox("hdlr", 0, 0, testU32(0), []byte("mdta"), make([]byte, 13)), keys, items)
+
+		mdhd := testFullBox("mdhd", 1, 0, binary.BigEndian.AppendUint64(nil, 3700000000), binary.BigEndian.AppendUint64(nil, 3700000001), testU32(600), binary.BigEndian.AppendUint64(nil, 1200), testU32(0))
+		stbl := testBox("stbl", testFullBox("stsd", 0, 0, testU32(0)), testFullBox(chunkBox, 0, 0, testU32(uint32(len(offsets))), entries))
+		trak := testBox("trak",
+			testFullBox("tkhd", 0, 3, testU32(3700000000), testU32(3700000001), testU32(1), make([]byte, 12)),
+			testBox("mdia", mdhd, testBox("minf", stbl)),
+			testBox("udta", testBox("name", []byte("Camera track"))),
+		)
+		moov := testBox("moov",
+			testFullBox("mvhd", 0, 0, testU32(3700000000), testU32(3700000001), testU32(600), testU32(1200), make([]byte, 80)),
+			trak, userData, meta, testBox("free", []byte("leftover")),
+		)
+
+		parts := [][]byte{ftyp, xmp, moov, mdat}
+		if !layout.moovFirst {
+			parts = [][]byte{ftyp, xmp, mdat, moov}
+		}
+		if layout.fragmented {
+			parts = append(parts, testBox("moof", testFullBox("mfhd", 0, 0, testU32(1))))
+		}
+		return bytes.Join(parts, nil)
+	}
+
+	// Offsets have a fixed size, so a first pass finds where the chunks land
+	file := build(make([]uint64, len(testMP4Chunks)))
+	mdatStart := uint64(bytes.Index(file, mdat))
+	offsets := []uint64{mdatStart + 8, mdatStart + 8 + uint64(len(testMP4Chunks[0]))}
+	return build(offsets)
+}
+
+// testMP4ChunkOffsets reads the chunk offsets of the first track
+func testMP4ChunkOffsets(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	for _, typ := range []string{"stco", "co64"} {
+		pos := bytes.Index(data, []byte(typ))
+		if pos < 0 {
+			continue
+		}
+		count := int(binary.BigEndian.Uint32(data[pos+8:]))
+		var offsets []uint64
+		for i := 0; i < count; i++ {
+			if typ == "stco" {
+				offsets = append(offsets, uint64(binary.BigEndian.Uint32(data[pos+12+4*i:])))
+			} else {
+				offsets = append(offsets, binary.BigEndian.Uint64(data[pos+12+8*i:]))
+			}
+		}
+		return offsets
+	}
+	t.Fatal("No chunk offset box found")
+	return nil
+}
+
+func TestStripMP4(t *testing.T) {
+	layouts := map[string]testMP4Layout{
+		"moov before mdat": {moovFirst: true},
+		"moov after mdat":  {},
+		"64-bit offsets":   {moovFirst: true, co64: true},
+		"fragmented":       {moovFirst: true, fragmented: true},
+	}
+
+	for name, layout := range layouts {
+		t.Run(name, func(t *testing.T) {
+			proc := NewProcessor(nil, false)
+			input := buildTestMP4(layout)
+
+			output := runStrip(t, func(w io.Writer) error {
+				return proc.stripMP4(bytes.NewReader(input), int64(len(input)), w, stats.TypeVideo)
+			})
+
+			for _, leak := range []string{"+37.7749", "Apple", "iPhone", "xmpmeta", "leftover", "Camera track"} {
+				if bytes.Contains(output, []byte(leak)) {
+					t.Errorf("Output still contains %q", leak)
+				}
+			}
+			if layout.fragmented && len(output) != len(input) {
+				t.Errorf("Fragmented file changed size from %d to %d", len(input), len(output))
+			}
+			if !layout.fragmented && len(output) >= len(input) {
+				t.Error("Metadata boxes were not removed")
+			}
+
+			// Every chunk offset must still point at its chunk
+			for i, offset := range testMP4ChunkOffsets(t, output) {
+				chunk := testMP4Chunks[i]
+				if offset+uint64(len(chunk)) > uint64(len(output)) || !bytes.Equal(output[offset:offset+uint64(len(chunk))], chunk) {
+					t.Errorf("Chunk offset %d no longer points at chunk %d", offset, i)
+				}
+			}
+
+			// Header timestamps are zeroed
+			mvhd := bytes.Index(output, []byte("mvhd"))
+			if !bytes.Equal(output[mvhd+8:mvhd+16], make([]byte, 8)) {
+				t.Error("mvhd timestamps were not zeroed")
+			}
+			mdhd := bytes.Index(output, []byte("mdhd"))
+			if !bytes.Equal(output[mdhd+8:mdhd+24], make([]byte, 16)) {
+				t.Error("mdhd timestamps were not zeroed")
+			}
+
+			for _, field := range []string{"GPS location", "Make", "com.apple.quicktime.model", "XMP", "Creation time"} {
+				if proc.Stats.ByMetadataType[field] == nil {
+					t.Errorf("%s was not reported in statistics", field)
+				}
+			}
+			if field := proc.Stats.ByMetadataType["GPS location"]; field != nil && field.Examples[0] != "+37.7749-122.4194/" {
+				t.Errorf("Unexpected GPS example %q", field.Examples[0])
+			}
+		})
+	}
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		badChunks := testBox("moov", testBox("trak", testBox("mdia", testBox("minf", testBox("stbl", testFullBox("stco", 0, 0, testU32(100)))))))
+		outside := testBox("moov", testBox("trak", testBox("mdia", testBox("minf", testBox("stbl", testFullBox("stco", 0, 0, testU32(1), testU32(5000)))))))
+		invalid := [][]byte{
+			[]byte("not an mp4 file"),
+			testBox("ftyp", []byte("isom")),
+			append(testBox("ftyp", []byte("isom")), badChunks...),
+			append(testBox("ftyp", []byte("isom")), outside...),
+			append(testBox("ftyp", []byte("isom")), testBox("moov", testFullBox("mvhd", 0, 0))...),
+		}
+		for i, data := range invalid {
+			if err := proc.stripMP4(bytes.NewReader(data), int64(len(data)), io.Discard, stats.TypeVideo); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanMP4(t *testing.T) {
+	tempDir, proc, cleanup := setupVideoTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "clip.mov")
+	if err := os.WriteFile(filePath, buildTestMP4(testMP4Layout{moovFirst: true}), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessVideo(filePath, ".mov"); err != nil {
+		t.Fatalf("Failed to clean MOV: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("+37.7749")) || !bytes.Contains(data, testMP4Chunks[1]) {
+		t.Error("MOV was not cleaned correctly")
+	}
+}
@@ -0,0 +1,271 @@
+package processor
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+const (
+	odfOfficeNamespace   = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odfMetaNamespace     = "urn:oasis:names:tc:opendocument:xmlns:meta:1.0"
+	odfConfigNamespace   = "urn:oasis:names:tc:opendocument:xmlns:config:1.0"
+	odfManifestNamespace = "urn:oasis:names:tc:opendocument:xmlns:manifest:1.0"
+	odfXLinkNamespace    = "http://www.w3.org/1999/xlink"
+	dcNamespace          = "http://purl.org/dc/elements/1.1/"
+
+	odfManifestPath = "META-INF/manifest.xml"
+)
+
+// odfMetaNames are the reported names of meta.xml fields
+var odfMetaNames = map[string]string{
+	odfMetaNamespace + " initial-creator":     "Creator",
+	odfMetaNamespace + " creation-date":       "Creation date",
+	odfMetaNamespace + " editing-cycles":      "Revision",
+	odfMetaNamespace + " editing-duration":    "Editing time",
+	odfMetaNamespace + " generator":           "Application",
+	odfMetaNamespace + " user-defined":        "Custom property",
+	odfMetaNamespace + " printed-by":          "Printed by",
+	odfMetaNamespace + " print-date":          "Print date",
+	odfMetaNamespace + " keyword":             "Keywords",
+	odfMetaNamespace + " template":            "Template",
+	odfMetaNamespace + " auto-reload":         "Auto reload",
+	odfMetaNamespace + " hyperlink-behaviour": "Hyperlink behaviour",
+	dcNamespace + " creator":                  "Last modified by",
+	dcNamespace + " date":                     "Modification date",
+	dcNamespace + " title":                    "Title",
+	dcNamespace + " subject":                  "Subject",
+	dcNamespace + " description":              "Description",
+	dcNamespace + " language":                 "Language",
+}
+
+// cleanOpenDocument removes metadata from OpenDocument files (.odt, .ods, .odp)
+func (p *Processor) cleanOpenDocument(filePath string) error {
+	// Open the document as a ZIP archive
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripOpenDocument(&reader.Reader, writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	reader.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripOpenDocument repackages an OpenDocument archive. The mimetype entry is
+// written first and stored, as the specification requires; every other entry
+// keeps its order and compression method. meta.xml loses everything but the
+// document statistics, printer settings are cleared and, unless the policy keeps it, the thumbnail is
+// removed together with its manifest entry. Pictures and embedded packages are cleaned
+// in memory.
+func (p *Processor) stripOpenDocument(r *zip.Reader, w io.Writer) error {
+	files := make(map[string]*zip.File, len(r.File))
+	for _, file := range r.File {
+		files[file.Name] = file
+	}
+	mimetype := files["mimetype"]
+	if mimetype == nil {
+		return errors.New("not a valid OpenDocument file: missing mimetype")
+	}
+
+	// The thumbnail is a rendering of the first page
+	removed := make(map[string]bool)
+	for _, file := range r.File {
+		if strings.HasPrefix(file.Name, "Thumbnails/") && !p.Policy.KeepDocumentThumbnail {
+			removed[file.Name] = true
+			if !strings.HasSuffix(file.Name, "/") {
+				p.Stats.AddMetadata(stats.TypeDocument, "Thumbnail", "")
+			}
+		}
+	}
+
+	// Encrypted parts are listed in the manifest and can't be parsed
+	encrypted := make(map[string]bool)
+	var manifest []byte
+	if file := files[odfManifestPath]; file != nil {
+		data, err := readZipFile(file)
+		if err != nil {
+			return err
+		}
+		if manifest, err = cleanODFManifest(data, removed, encrypted); err != nil {
+			return fmt.Errorf("invalid OpenDocument manifest: %v", err)
+		}
+	}
+
+	archive := zip.NewWriter(w)
+
+	// mimetype goes first, uncompressed and without a data descriptor or extra field
+	data, err := readZipFile(mimetype)
+	if err != nil {
+		return err
+	}
+	entry, err := archive.CreateRaw(&zip.FileHeader{
+		Name:               mimetype.Name,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeAll(entry, data); err != nil {
+		return err
+	}
+
+	for _, file := range r.File {
+		if file == mimetype || removed[file.Name] {
+			continue
+		}
+
+		var data []byte
+		if !strings.HasSuffix(file.Name, "/") {
+			if data, err = readZipFile(file); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case file.Name == odfManifestPath:
+			data = manifest
+		case encrypted[file.Name]:
+			// Encrypted parts are copied as they are
+		case path.Base(file.Name) == "meta.xml":
+			data, err = p.cleanODFMeta(data)
+		case path.Base(file.Name) == "settings.xml":
+			data, err = p.cleanODFSettings(data)
+		default:
+			// Pictures and embedded packages are cleaned by their own cleaners
+			data = p.cleanEmbeddedPart(file.Name, data)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid OpenDocument part %s: %v", file.Name, err)
+		}
+
+		// Timestamps are not copied
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: file.Name, Method: file.Method})
+		if err != nil {
+			return err
+		}
+		if err := writeAll(entry, data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// cleanODFManifest drops the file entries of removed parts from the manifest
+// and records which parts are encrypted
+func cleanODFManifest(data []byte, removed, encrypted map[string]bool) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			switch {
+			case e.is(odfManifestNamespace, "file-entry"):
+				if name, _ := e.attr(odfManifestNamespace, "full-path"); removed[name] {
+					return xmlDrop
+				}
+			case e.is(odfManifestNamespace, "encryption-data") && e.parent != nil:
+				name, _ := e.parent.attr(odfManifestNamespace, "full-path")
+				encrypted[name] = true
+			}
+			return xmlKeep
+		},
+	})
+}
+
+// cleanODFMeta removes every field of office:meta except the document statistics
+func (p *Processor) cleanODFMeta(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.parent != nil && e.parent.is(odfOfficeNamespace, "meta") && !e.is(odfMetaNamespace, "document-statistic") {
+				return xmlDrop
+			}
+			return xmlKeep
+		},
+		removed: func(e *xmlElement, text string) {
+			name := odfMetaNames[e.space+" "+e.name.Local]
+			if name == "" {
+				name = xmlQualifiedName(e.name)
+			}
+			switch {
+			case e.is(odfMetaNamespace, "user-defined"):
+				key, _ := e.attr(odfMetaNamespace, "name")
+				text = key + "=" + text
+			case e.is(odfMetaNamespace, "template"):
+				text, _ = e.attr(odfXLinkNamespace, "href")
+			}
+			p.Stats.AddMetadata(stats.TypeDocument, name, metadataExample(text))
+		},
+	})
+}
+
+// cleanODFSettings clears the printer name and the driver settings blob,
+// which also names the printer
+func (p *Processor) cleanODFSettings(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if !e.is(odfConfigNamespace, "config-item") {
+				return xmlKeep
+			}
+			switch name, _ := e.attr(odfConfigNamespace, "name"); name {
+			case "PrinterName", "PrinterSetup":
+				return xmlEmpty
+			}
+			return xmlKeep
+		},
+		removed: func(e *xmlElement, text string) {
+			if strings.TrimSpace(text) == "" {
+				return
+			}
+			if name, _ := e.attr(odfConfigNamespace, "name"); name == "PrinterName" {
+				p.Stats.AddMetadata(stats.TypeDocument, "Printer name", metadataExample(text))
+			} else {
+				p.Stats.AddMetadata(stats.TypeDocument, "Printer setup", "")
+			}
+		},
+	})
+}
+
+// readZipFile reads and decompresses an archive entry
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
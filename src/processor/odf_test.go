@@ -0,0 +1,238 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testZipEntry is an archive entry for test packages
+type testZipEntry struct {
+	name   string
+	method uint16
+	data   string
+}
+
+// buildTestZip builds an archive with the entries in order
+func buildTestZip(t *testing.T, entries ...testZipEntry) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: entry.name, Method: entry.method})
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(entry.data)); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// readTestZip returns the entries of an archive in order
+func readTestZip(t *testing.T, data []byte) []testZipEntry {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Output is not a valid zip: %v", err)
+	}
+	var entries []testZipEntry
+	for _, file := range r.File {
+		content, err := readZipFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name, err)
+		}
+		entries = append(entries, testZipEntry{file.Name, file.Method, string(content)})
+	}
+	return entries
+}
+
+const testODFMeta = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-meta xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xlink="http://www.w3.org/1999/xlink" office:version="1.3">
+<office:meta>
+<meta:initial-creator>Jane Doe</meta:initial-creator>
+<meta:creation-date>2024-03-01T09:15:00</meta:creation-date>
+<dc:creator>John Roe</dc:creator>
+<dc:date>2024-03-02T10:00:00</dc:date>
+<meta:editing-cycles>14</meta:editing-cycles>
+<meta:editing-duration>PT3H12M</meta:editing-duration>
+<meta:generator>LibreOffice/7.6.4.1$Linux_X86_64</meta:generator>
+<meta:template xlink:type="simple" xlink:href="/home/jane/Templates/Letter.ott"/>
+<meta:user-defined meta:name="Client" meta:value-type="string">Acme
+Holdings</meta:user-defined>
+<meta:document-statistic meta:page-count="2" meta:word-count="311"/>
+</office:meta>
+</office:document-meta>`
+
+const testODFSettings = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-settings xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:config="urn:oasis:names:tc:opendocument:xmlns:config:1.0">
+<office:settings>
+<config:config-item-set config:name="ooo:configuration-settings">
+<config:config-item config:name="PrinterName" config:type="string">HR-Floor3-LaserJet</config:config-item>
+<config:config-item config:name="PrinterSetup" config:type="base64Binary">SFItRmxvb3Iz</config:config-item>
+<config:config-item config:name="PrintReversed" config:type="boolean">false</config:config-item>
+</config:config-item-set>
+</office:settings>
+</office:document-settings>`
+
+const testODFManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.3">
+ <manifest:file-entry manifest:full-path="/" manifest:media-type="application/vnd.oasis.opendocument.text"/>
+ <manifest:file-entry manifest:full-path="Thumbnails/thumbnail.png" manifest:media-type="image/png"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+ <manifest:file-entry manifest:full-path="meta.xml" manifest:media-type="text/xml"/>
+ <manifest:file-entry manifest:full-path="settings.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>`
+
+// buildTestODF builds a text document the way other tools write it: mimetype
+// compressed and not first
+func buildTestODF(t *testing.T) []byte {
+	return buildTestZip(t,
+		testZipEntry{"content.xml", zip.Deflate, "<office:document-content>Body text</office:document-content>"},
+		testZipEntry{"mimetype", zip.Deflate, "application/vnd.oasis.opendocument.text"},
+		testZipEntry{"meta.xml", zip.Deflate, testODFMeta},
+		testZipEntry{"settings.xml", zip.Store, testODFSettings},
+		testZipEntry{"Thumbnails/", zip.Store, ""},
+		testZipEntry{"Thumbnails/thumbnail.png", zip.Store, "\x89PNG thumbnail"},
+		testZipEntry{"META-INF/manifest.xml", zip.Deflate, testODFManifest},
+	)
+}
+
+func TestStripOpenDocument(t *testing.T) {
+	proc := NewProcessor(nil, false)
+	input := buildTestODF(t)
+	r, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("Failed to read test document: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := proc.stripOpenDocument(r, &out); err != nil {
+		t.Fatalf("stripOpenDocument failed: %v", err)
+	}
+	output := out.Bytes()
+
+	// The mimetype is the first local header, stored, with its content at offset 38
+	if !bytes.HasPrefix(output, []byte("PK\x03\x04")) || binary.LittleEndian.Uint16(output[8:]) != zip.Store ||
+		binary.LittleEndian.Uint16(output[6:])&0x8 != 0 || binary.LittleEndian.Uint16(output[28:]) != 0 ||
+		string(output[30:38]) != "mimetype" || !bytes.HasPrefix(output[38:], []byte("application/vnd.oasis.opendocument.text")) {
+		t.Fatalf("mimetype is not the first stored entry: %q", output[:80])
+	}
+
+	entries := readTestZip(t, output)
+	names := make([]string, len(entries))
+	contents := make(map[string]testZipEntry)
+	for i, entry := range entries {
+		names[i] = entry.name
+		contents[entry.name] = entry
+	}
+	if got := strings.Join(names, ","); got != "mimetype,content.xml,meta.xml,settings.xml,META-INF/manifest.xml" {
+		t.Errorf("Unexpected entry order %s", got)
+	}
+	if contents["settings.xml"].method != zip.Store || contents["meta.xml"].method != zip.Deflate {
+		t.Error("Compression methods were not preserved")
+	}
+	if contents["content.xml"].data != "<office:document-content>Body text</office:document-content>" {
+		t.Error("content.xml was changed")
+	}
+
+	meta := contents["meta.xml"].data
+	for _, leak := range []string{"Jane", "John", "2024", "PT3H", "LibreOffice", "Letter.ott", "Acme", "editing-cycles"} {
+		if strings.Contains(meta, leak) {
+			t.Errorf("meta.xml still contains %q", leak)
+		}
+	}
+	if !strings.Contains(meta, `<meta:document-statistic meta:page-count="2" meta:word-count="311"/>`) {
+		t.Error("Document statistics were removed")
+	}
+
+	settings := contents["settings.xml"].data
+	if strings.Contains(settings, "HR-Floor3") || strings.Contains(settings, "SFIt") {
+		t.Error("Printer settings were not cleared")
+	}
+	if !strings.Contains(settings, `<config:config-item config:name="PrinterName" config:type="string"></config:config-item>`) ||
+		!strings.Contains(settings, "PrintReversed") {
+		t.Error("Other settings were changed")
+	}
+
+	manifest := contents["META-INF/manifest.xml"].data
+	if strings.Contains(manifest, "Thumbnails") || !strings.Contains(manifest, `manifest:full-path="content.xml"`) {
+		t.Errorf("Unexpected manifest:\n%s", manifest)
+	}
+
+	for _, field := range []string{"Creator", "Creation date", "Last modified by", "Revision", "Editing time", "Application", "Template", "Custom property", "Printer name", "Printer setup", "Thumbnail"} {
+		if proc.Stats.ByMetadataType[field] == nil {
+			t.Errorf("%s was not reported in statistics", field)
+		}
+	}
+	if field := proc.Stats.ByMetadataType["Custom property"]; field != nil && field.Examples[0] != "Client=Acme\nHoldings" {
+		t.Errorf("Unexpected custom property example %q", field.Examples[0])
+	}
+
+	t.Run("Invalid files", func(t *testing.T) {
+		invalid := [][]byte{
+			buildTestZip(t, testZipEntry{"content.xml", zip.Deflate, "<x/>"}),
+			buildTestZip(t, testZipEntry{"mimetype", zip.Store, "application/vnd.oasis.opendocument.text"}, testZipEntry{"meta.xml", zip.Deflate, "<office:document-meta>"}),
+		}
+		for i, data := range invalid {
+			r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Failed to read invalid file %d: %v", i, err)
+			}
+			if err := NewProcessor(nil, false).stripOpenDocument(r, &bytes.Buffer{}); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+
+	t.Run("Encrypted parts", func(t *testing.T) {
+		manifest := `<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0">
+ <manifest:file-entry manifest:full-path="settings.xml"><manifest:encryption-data/></manifest:file-entry>
+</manifest:manifest>`
+		data := buildTestZip(t,
+			testZipEntry{"mimetype", zip.Store, "application/vnd.oasis.opendocument.text"},
+			testZipEntry{"settings.xml", zip.Store, "\x00encrypted bytes"},
+			testZipEntry{"META-INF/manifest.xml", zip.Deflate, manifest},
+		)
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Failed to read test document: %v", err)
+		}
+		var out bytes.Buffer
+		if err := NewProcessor(nil, false).stripOpenDocument(r, &out); err != nil {
+			t.Fatalf("stripOpenDocument failed: %v", err)
+		}
+		if entries := readTestZip(t, out.Bytes()); entries[1].data != "\x00encrypted bytes" {
+			t.Error("Encrypted part was changed")
+		}
+	})
+}
+
+func TestCleanOpenDocument(t *testing.T) {
+	tempDir, proc, cleanup := setupDocumentTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "letter.odt")
+	if err := os.WriteFile(filePath, buildTestODF(t), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessDocument(filePath, ".odt"); err != nil {
+		t.Fatalf("Failed to clean ODT: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	entries := readTestZip(t, data)
+	if entries[0].name != "mimetype" || strings.Contains(entries[2].data, "Jane Doe") {
+		t.Error("ODT was not cleaned correctly")
+	}
+}
@@ -0,0 +1,357 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Ogg page header flags
+const (
+	oggContinued = 0x01
+	oggFirstPage = 0x02
+)
+
+const (
+	oggHeaderSize  = 27
+	oggMaxSegments = 255
+)
+
+// oggCRCTable is the table for the Ogg page checksum (polynomial 0x04C11DB7, no reflection)
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// oggPage is a single Ogg page
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	serial   uint32
+	sequence uint32
+	segments []byte // Lacing values
+	data     []byte
+}
+
+// oggStream tracks the header packets of one logical Vorbis or Opus stream
+type oggStream struct {
+	codec    string
+	needed   int      // Number of header packets
+	packets  [][]byte // Completed header packets
+	partial  []byte   // Header packet continued on the next page
+	pages    int      // Header pages read after the first page
+	done     bool
+	seqDelta uint32 // Added to the sequence numbers of later pages
+}
+
+// cleanOgg removes metadata from Ogg Vorbis and Opus files
+func (p *Processor) cleanOgg(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripOgg(bufio.NewReader(file), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripOgg rewrites the comment packet of every Vorbis and Opus stream.
+// The pages holding the header packets after the identification page are
+// buffered and re-paginated; later pages of the stream get new sequence
+// numbers and checksums. Streams of other codecs are copied unchanged.
+func (p *Processor) stripOgg(r io.Reader, w io.Writer) error {
+	streams := make(map[uint32]*oggStream)
+	for pageCount := 0; ; pageCount++ {
+		page, err := readOggPage(r)
+		if err == io.EOF {
+			if pageCount == 0 {
+				return errors.New("not a valid Ogg file")
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		stream := streams[page.serial]
+		if page.flags&oggFirstPage != 0 {
+			stream, err = newOggStream(page)
+			if err != nil {
+				return err
+			}
+			streams[page.serial] = stream
+		} else if stream != nil && !stream.done {
+			if err := p.collectOggHeaders(stream, page, w); err != nil {
+				return err
+			}
+			continue
+		} else if stream != nil {
+			page.sequence += stream.seqDelta
+		}
+
+		if _, err := w.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+
+	for _, stream := range streams {
+		if !stream.done {
+			return errors.New("truncated Ogg header packets")
+		}
+	}
+	return nil
+}
+
+// newOggStream identifies the codec from the first page of a logical stream
+func newOggStream(page *oggPage) (*oggStream, error) {
+	stream := &oggStream{done: true}
+	switch {
+	case bytes.HasPrefix(page.data, []byte("\x01vorbis")):
+		stream.codec, stream.needed = "vorbis", 3
+	case bytes.HasPrefix(page.data, []byte("OpusHead")):
+		stream.codec, stream.needed = "opus", 2
+	default:
+		return stream, nil
+	}
+
+	// The identification header sits alone on the first page
+	packets, partial := page.packets()
+	if len(packets) != 1 || partial != nil {
+		return nil, fmt.Errorf("invalid %s identification page", stream.codec)
+	}
+	stream.packets = packets
+	stream.done = false
+	return stream, nil
+}
+
+// collectOggHeaders buffers a header page and writes the rebuilt header pages
+// once the last header packet is complete
+func (p *Processor) collectOggHeaders(stream *oggStream, page *oggPage, w io.Writer) error {
+	if page.flags&oggContinued != 0 {
+		if stream.partial == nil {
+			return errors.New("unexpected Ogg continuation page")
+		}
+	} else if stream.partial != nil {
+		return errors.New("missing Ogg continuation page")
+	}
+	stream.pages++
+
+	packets, partial := page.packets()
+	if len(packets) > 0 {
+		packets[0] = append(stream.partial[:len(stream.partial):len(stream.partial)], packets[0]...)
+		stream.packets = append(stream.packets, packets...)
+		stream.partial = partial
+	} else {
+		stream.partial = append(stream.partial, partial...)
+	}
+
+	if len(stream.packets) < stream.needed {
+		return nil
+	}
+	if len(stream.packets) > stream.needed || stream.partial != nil {
+		return fmt.Errorf("%s audio data shares a page with the header packets", stream.codec)
+	}
+
+	comment, err := p.cleanOggComment(stream.codec, stream.packets[1])
+	if err != nil {
+		return err
+	}
+	stream.packets[1] = comment
+
+	pages := paginateOgg(page.serial, 1, stream.packets[1:])
+	for _, page := range pages {
+		if _, err := w.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+
+	stream.seqDelta = uint32(len(pages) - stream.pages)
+	stream.packets = nil
+	stream.done = true
+	return nil
+}
+
+// cleanOggComment rebuilds a Vorbis comment or OpusTags packet.
+// The Vorbis framing bit is restored; trailing Opus data is dropped.
+func (p *Processor) cleanOggComment(codec string, packet []byte) ([]byte, error) {
+	prefix := []byte("\x03vorbis")
+	if codec == "opus" {
+		prefix = []byte("OpusTags")
+	}
+	if !bytes.HasPrefix(packet, prefix) {
+		return nil, fmt.Errorf("missing %s comment header", codec)
+	}
+
+	vc, err := parseVorbisComment(packet[len(prefix):])
+	if err != nil {
+		return nil, err
+	}
+	p.cleanVorbisComment(vc)
+
+	out := append(prefix, vc.bytes()...)
+	if codec == "vorbis" {
+		out = append(out, 1)
+	}
+	return out, nil
+}
+
+// readOggPage reads the next page; io.EOF is returned only at a page boundary
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.New("truncated Ogg page")
+	}
+	if string(header[:4]) != "OggS" || header[4] != 0 {
+		return nil, errors.New("invalid Ogg page header")
+	}
+
+	page := &oggPage{
+		flags:    header[5],
+		granule:  binary.LittleEndian.Uint64(header[6:]),
+		serial:   binary.LittleEndian.Uint32(header[14:]),
+		sequence: binary.LittleEndian.Uint32(header[18:]),
+		segments: make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.segments); err != nil {
+		return nil, errors.New("truncated Ogg page")
+	}
+
+	size := 0
+	for _, lacing := range page.segments {
+		size += int(lacing)
+	}
+	page.data = make([]byte, size)
+	if _, err := io.ReadFull(r, page.data); err != nil {
+		return nil, errors.New("truncated Ogg page")
+	}
+	return page, nil
+}
+
+// packets splits the page data into packets; the last one is returned as
+// partial when it continues on the next page
+func (page *oggPage) packets() (packets [][]byte, partial []byte) {
+	start, end := 0, 0
+	for _, lacing := range page.segments {
+		end += int(lacing)
+		if lacing < 255 {
+			packets = append(packets, page.data[start:end])
+			start = end
+		}
+	}
+	if start < end {
+		partial = page.data[start:end]
+	}
+	return packets, partial
+}
+
+// bytes encodes the page with a fresh checksum
+func (page *oggPage) bytes() []byte {
+	out := make([]byte, oggHeaderSize, oggHeaderSize+len(page.segments)+len(page.data))
+	copy(out, "OggS")
+	out[5] = page.flags
+	binary.LittleEndian.PutUint64(out[6:], page.granule)
+	binary.LittleEndian.PutUint32(out[14:], page.serial)
+	binary.LittleEndian.PutUint32(out[18:], page.sequence)
+	out[26] = byte(len(page.segments))
+	out = append(out, page.segments...)
+	out = append(out, page.data...)
+
+	binary.LittleEndian.PutUint32(out[22:], oggChecksum(out))
+	return out
+}
+
+// oggChecksum computes the page checksum over a page whose checksum field is zero
+func oggChecksum(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// paginateOgg lays header packets out over as few pages as possible.
+// Pages on which no packet ends carry the granule position -1.
+func paginateOgg(serial, sequence uint32, packets [][]byte) []*oggPage {
+	var segments []byte
+	var data []byte
+	for _, packet := range packets {
+		for n := len(packet); n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(len(packet)%255))
+		data = append(data, packet...)
+	}
+
+	var pages []*oggPage
+	continued := false
+	for len(segments) > 0 {
+		count := len(segments)
+		if count > oggMaxSegments {
+			count = oggMaxSegments
+		}
+
+		page := &oggPage{serial: serial, sequence: sequence, granule: ^uint64(0)}
+		page.segments = segments[:count]
+		size := 0
+		for _, lacing := range page.segments {
+			size += int(lacing)
+			if lacing < 255 {
+				page.granule = 0
+			}
+		}
+		page.data = data[:size]
+		if continued {
+			page.flags = oggContinued
+		}
+		continued = page.segments[count-1] == 255
+
+		pages = append(pages, page)
+		segments, data = segments[count:], data[size:]
+		sequence++
+	}
+	return pages
+}
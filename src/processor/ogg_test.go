@@ -0,0 +1,208 @@
+package processor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testOggPage builds a page holding complete packets
+func testOggPage(flags byte, serial, sequence uint32, granule uint64, packets ...[]byte) []byte {
+	page := &oggPage{flags: flags, serial: serial, sequence: sequence, granule: granule}
+	for _, packet := range packets {
+		for n := len(packet); n >= 255; n -= 255 {
+			page.segments = append(page.segments, 255)
+		}
+		page.segments = append(page.segments, byte(len(packet)%255))
+		page.data = append(page.data, packet...)
+	}
+	return page.bytes()
+}
+
+// testVorbisPacket builds a Vorbis header packet of the given type
+func testVorbisPacket(typ byte, body []byte) []byte {
+	return append([]byte{typ, 'v', 'o', 'r', 'b', 'i', 's'}, body...)
+}
+
+func TestOggChecksum(t *testing.T) {
+	if crc := oggChecksum([]byte("123456789")); crc != 0x89A1897F {
+		t.Errorf("Unexpected checksum %08X", crc)
+	}
+}
+
+func TestPaginateOgg(t *testing.T) {
+	large := bytes.Repeat([]byte{0xAB}, 255*300)
+	pages := paginateOgg(7, 1, [][]byte{large, []byte("setup")})
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(pages))
+	}
+
+	first, second := pages[0], pages[1]
+	if len(first.segments) != oggMaxSegments || first.flags != 0 || first.granule != ^uint64(0) {
+		t.Errorf("Unexpected first page: %d segments, flags %d, granule %d", len(first.segments), first.flags, first.granule)
+	}
+	if second.flags != oggContinued || second.granule != 0 || second.sequence != 2 {
+		t.Errorf("Unexpected second page: flags %d, granule %d, sequence %d", second.flags, second.granule, second.sequence)
+	}
+
+	_, partial := first.packets()
+	packets, _ := second.packets()
+	if len(packets) != 2 || !bytes.Equal(append(partial, packets[0]...), large) || string(packets[1]) != "setup" {
+		t.Error("Packets were not split across pages correctly")
+	}
+}
+
+func TestStripOgg(t *testing.T) {
+	const serial = 0x1234
+
+	t.Run("Vorbis comment header spanning pages", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		identification := testVorbisPacket(1, make([]byte, 23))
+		comment := append(testVorbisPacket(3, (&vorbisComment{
+			vendor:   "Xiph.Org libVorbis I 20200704 (Reducing Environment)",
+			comments: []string{"ENCODER=Voice Recorder Pro 2.1", "LOCATION=" + string(bytes.Repeat([]byte("x"), 600))},
+		}).bytes()), 1)
+		setup := testVorbisPacket(5, []byte("codebooks"))
+
+		// The comment packet is split after two full segments
+		split := &oggPage{serial: serial, sequence: 1, granule: ^uint64(0), segments: []byte{255, 255}, data: comment[:510]}
+		rest := &oggPage{flags: oggContinued, serial: serial, sequence: 2}
+		for n := len(comment) - 510; n >= 255; n -= 255 {
+			rest.segments = append(rest.segments, 255)
+		}
+		rest.segments = append(rest.segments, byte((len(comment)-510)%255), byte(len(setup)))
+		rest.data = append(append([]byte{}, comment[510:]...), setup...)
+
+		input := bytes.Join([][]byte{
+			testOggPage(oggFirstPage, serial, 0, 0, identification),
+			split.bytes(),
+			rest.bytes(),
+			testOggPage(0, serial, 3, 1024, []byte("audio 1")),
+			testOggPage(0x04, serial, 4, 2048, []byte("audio 2")),
+		}, nil)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripOgg(bytes.NewReader(input), w)
+		})
+
+		cleanComment := append(testVorbisPacket(3, (&vorbisComment{}).bytes()), 1)
+		expected := bytes.Join([][]byte{
+			testOggPage(oggFirstPage, serial, 0, 0, identification),
+			testOggPage(0, serial, 1, 0, cleanComment, setup),
+			testOggPage(0, serial, 2, 1024, []byte("audio 1")),
+			testOggPage(0x04, serial, 3, 2048, []byte("audio 2")),
+		}, nil)
+		if !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+
+		for _, name := range []string{"ENCODER", "LOCATION", "Encoder"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("OpusTags and other streams", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		const video = 0x99
+		theora := []byte("\x80theora header")
+		identification := []byte("OpusHead\x01\x02\x38\x01\x80\xBB\x00\x00\x00\x00\x00")
+		tags := append([]byte("OpusTags"), (&vorbisComment{
+			vendor:   "libopus 1.3.1",
+			comments: []string{"TITLE=Meeting notes", "ANDROID_VERSION=14"},
+		}).bytes()...)
+		tags = append(tags, 0x01, 0xDE, 0xAD) // Binary data after the comments
+
+		input := bytes.Join([][]byte{
+			testOggPage(oggFirstPage, serial, 0, 0, identification),
+			testOggPage(oggFirstPage, video, 0, 0, theora),
+			testOggPage(0, serial, 1, 0, tags),
+			testOggPage(0, video, 1, 0, []byte("\x81theora comments")),
+			testOggPage(0, serial, 2, 960, []byte("opus frame")),
+		}, nil)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripOgg(bytes.NewReader(input), w)
+		})
+
+		expected := bytes.Join([][]byte{
+			testOggPage(oggFirstPage, serial, 0, 0, identification),
+			testOggPage(oggFirstPage, video, 0, 0, theora),
+			testOggPage(0, serial, 1, 0, append([]byte("OpusTags"), (&vorbisComment{}).bytes()...)),
+			testOggPage(0, video, 1, 0, []byte("\x81theora comments")),
+			testOggPage(0, serial, 2, 960, []byte("opus frame")),
+		}, nil)
+		if !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+	})
+
+	t.Run("Kept tags", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepAudioTags = true
+		tags := append([]byte("OpusTags"), (&vorbisComment{vendor: "libopus 1.3.1", comments: []string{"TITLE=Interview"}}).bytes()...)
+		input := bytes.Join([][]byte{
+			testOggPage(oggFirstPage, serial, 0, 0, []byte("OpusHead\x01")),
+			testOggPage(0, serial, 1, 0, tags),
+		}, nil)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripOgg(bytes.NewReader(input), w)
+		})
+		if !bytes.Contains(output, []byte("TITLE=Interview")) || bytes.Contains(output, []byte("libopus")) {
+			t.Error("Tags were not kept with the vendor string replaced")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		identification := testOggPage(oggFirstPage, serial, 0, 0, []byte("OpusHead\x01"))
+		tags := append([]byte("OpusTags"), (&vorbisComment{}).bytes()...)
+		invalid := [][]byte{
+			nil,
+			[]byte("not an ogg file at all, really"),
+			identification,
+			identification[:len(identification)-1],
+			testOggPage(oggFirstPage, serial, 0, 0, []byte("OpusHead\x01"), []byte("extra")),
+			append(append([]byte{}, identification...), testOggPage(0, serial, 1, 0, tags, []byte("audio"))...),
+			append(append([]byte{}, identification...), testOggPage(oggContinued, serial, 1, 0, tags)...),
+			append(append([]byte{}, identification...), testOggPage(0, serial, 1, 0, []byte("OpusTagz"))...),
+		}
+		for i, data := range invalid {
+			if err := proc.stripOgg(bytes.NewReader(data), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanOgg(t *testing.T) {
+	tempDir, proc, cleanup := setupAudioTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "memo.opus")
+	tags := append([]byte("OpusTags"), (&vorbisComment{vendor: "libopus", comments: []string{"DEVICE=Pixel 8"}}).bytes()...)
+	input := bytes.Join([][]byte{
+		testOggPage(oggFirstPage, 1, 0, 0, []byte("OpusHead\x01")),
+		testOggPage(0, 1, 1, 0, tags),
+		testOggPage(0x04, 1, 2, 960, []byte("opus frame")),
+	}, nil)
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessAudio(filePath, ".opus"); err != nil {
+		t.Fatalf("Failed to clean Ogg: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("Pixel")) || !bytes.Contains(data, []byte("opus frame")) {
+		t.Error("Ogg file was not cleaned correctly")
+	}
+}
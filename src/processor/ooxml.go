@@ -0,0 +1,634 @@
+package processor
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"metadata-remover/src/stats"
+)
+
+const (
+	ooxmlContentTypesPath       = "[Content_Types].xml"
+	ooxmlContentTypesNamespace  = "http://schemas.openxmlformats.org/package/2006/content-types"
+	ooxmlRelsNamespace          = "http://schemas.openxmlformats.org/package/2006/relationships"
+	ooxmlRelationshipsNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// ooxmlCoreNames are the reported names of docProps/core.xml fields
+var ooxmlCoreNames = map[string]string{
+	"creator":        "Author",
+	"lastModifiedBy": "Last modified by",
+	"title":          "Title",
+	"subject":        "Subject",
+	"description":    "Description",
+	"keywords":       "Keywords",
+	"category":       "Category",
+	"contentStatus":  "Content status",
+	"created":        "Creation date",
+	"modified":       "Modification date",
+	"lastPrinted":    "Print date",
+	"revision":       "Revision",
+	"identifier":     "Identifier",
+	"language":       "Language",
+	"version":        "Version",
+}
+
+// ooxmlAppNames are the docProps/app.xml fields that are removed. Counts and
+// the titles of parts describe the content and are kept.
+var ooxmlAppNames = map[string]string{
+	"Application":   "Application",
+	"AppVersion":    "Application version",
+	"Company":       "Company",
+	"Manager":       "Manager",
+	"HyperlinkBase": "Hyperlink base",
+	"Template":      "Template",
+	"TotalTime":     "Editing time",
+}
+
+// ooxmlMacroFreeContentTypes maps the content types of macro-enabled main parts
+// to their macro-free equivalents
+var ooxmlMacroFreeContentTypes = map[string]string{
+	"application/vnd.ms-word.document.macroEnabled.main+xml":           "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+	"application/vnd.ms-word.template.macroEnabledTemplate.main+xml":   "application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml",
+	"application/vnd.ms-excel.sheet.macroEnabled.main+xml":             "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml",
+	"application/vnd.ms-excel.template.macroEnabled.main+xml":          "application/vnd.openxmlformats-officedocument.spreadsheetml.template.main+xml",
+	"application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml": "application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml",
+	"application/vnd.ms-powerpoint.template.macroEnabled.main+xml":     "application/vnd.openxmlformats-officedocument.presentationml.template.main+xml",
+}
+
+// ooxmlMacroFreeExtensions maps the extensions of macro-enabled files to the
+// extensions of their macro-free equivalents
+var ooxmlMacroFreeExtensions = map[string]string{
+	".docm": ".docx",
+	".dotm": ".dotx",
+	".xlsm": ".xlsx",
+	".xltm": ".xltx",
+	".pptm": ".pptx",
+	".potm": ".potx",
+}
+
+// ooxmlMacroParts names, by relationship type, the parts of the main part that
+// are only valid in macro-enabled files
+var ooxmlMacroParts = map[string]string{
+	"vbaProject":           "VBA project",
+	"keyMapCustomizations": "Key map customizations",
+	"attachedToolbars":     "Attached toolbars",
+}
+
+// ooxmlPart is an entry of an Office Open XML package
+type ooxmlPart struct {
+	name   string
+	method uint16
+	data   []byte
+}
+
+// ooxmlPackage holds the parts of an Office Open XML package in archive order
+type ooxmlPackage struct {
+	parts   []*ooxmlPart
+	removed map[string]bool
+}
+
+// ooxmlRelationship is a relationship from a part, with its target resolved to a part name
+type ooxmlRelationship struct {
+	id       string
+	typ      string
+	target   string
+	external bool
+}
+
+// cleanOpenXML removes metadata from Office Open XML files (.docx, .xlsx, .pptx
+// and their macro-enabled and template variants). A macro-enabled file whose
+// VBA project the policy removes is renamed to the macro-free extension.
+func (p *Processor) cleanOpenXML(filePath string) error {
+	targetPath := filePath
+	ext := filepath.Ext(filePath)
+	if freeExt, ok := ooxmlMacroFreeExtensions[strings.ToLower(ext)]; ok && p.Policy.RemoveMacros {
+		targetPath = strings.TrimSuffix(filePath, ext) + freeExt
+		if _, err := os.Stat(targetPath); err == nil {
+			return fmt.Errorf("cannot save macro-free document: %s already exists", targetPath)
+		}
+	}
+
+	// Open the document as a ZIP archive
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripOpenXML(&reader.Reader, writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	reader.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	if err := os.Rename(tempPath, targetPath); err != nil {
+		return err
+	}
+	if targetPath != filePath {
+		p.logger.Info("Renamed %s to %s after removing its macros", filePath, targetPath)
+		return os.Remove(filePath)
+	}
+	return nil
+}
+
+// stripOpenXML repackages an Office Open XML archive. The document properties
+// are found through the package relationships: core and extended properties
+// are cleaned and custom properties are removed, together with their content
+// type and relationship. The thumbnail, printer settings and custom XML parts
+// are removed by policy, and so is the VBA project of macro-enabled documents.
+// The main part is then cleaned for its kind of document, and embedded files
+// are cleaned in memory.
+func (p *Processor) stripOpenXML(r *zip.Reader, w io.Writer) error {
+	pkg, err := readOOXMLPackage(r)
+	if err != nil {
+		return err
+	}
+
+	rels, err := pkg.relationships("")
+	if err != nil {
+		return err
+	}
+	var main *ooxmlPart
+	for _, rel := range rels {
+		part := pkg.part(rel.target)
+		if rel.external || part == nil {
+			continue
+		}
+		switch path.Base(rel.typ) {
+		case "officeDocument":
+			main = part
+		case "core-properties":
+			part.data, err = p.cleanOOXMLCoreProperties(part.data)
+		case "extended-properties", "extendedProperties":
+			part.data, err = p.cleanOOXMLAppProperties(part.data)
+		case "custom-properties", "customProperties":
+			err = p.reportOOXMLCustomProperties(part.data)
+			pkg.remove(part.name)
+		case "thumbnail":
+			if !p.Policy.KeepDocumentThumbnail {
+				p.Stats.AddMetadata(stats.TypeDocument, "Thumbnail", "")
+				pkg.remove(part.name)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+	}
+	p.removeOOXMLParts(pkg)
+	if main != nil {
+		if p.Policy.RemoveMacros {
+			if err := p.removeOOXMLMacros(pkg, main.name); err != nil {
+				return err
+			}
+		}
+		if err := p.cleanOOXMLMainPart(pkg, main); err != nil {
+			return err
+		}
+	}
+
+	// Pictures, media and embedded packages are cleaned by their own cleaners
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] {
+			continue
+		}
+		part.data = p.cleanEmbeddedPart(part.name, part.data)
+	}
+
+	if err := pkg.fixReferences(); err != nil {
+		return err
+	}
+	return pkg.write(w)
+}
+
+// removeOOXMLParts removes the printer settings and custom XML parts the policy
+// does not keep
+func (p *Processor) removeOOXMLParts(pkg *ooxmlPackage) {
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] {
+			continue
+		}
+		name := strings.ToLower(part.name)
+		switch {
+		case strings.HasPrefix(name, "customxml/") && !p.Policy.KeepCustomXML:
+			// Item parts hold the data; their properties and relationships go with them
+			if dir, base := path.Split(name); dir == "customxml/" && strings.HasPrefix(base, "item") && !strings.HasPrefix(base, "itemprops") {
+				root := xmlRootName(part.data)
+				p.Stats.AddMetadata(stats.TypeDocument, "Custom XML", metadataExample(strings.TrimSpace(root.Space+" "+root.Local)))
+			}
+			pkg.remove(part.name)
+		case strings.HasPrefix(path.Base(name), "printersettings") && !p.Policy.KeepPrinterSettings:
+			p.Stats.AddMetadata(stats.TypeDocument, "Printer settings", metadataExample(devmodeDeviceName(part.data)))
+			pkg.remove(part.name)
+		}
+	}
+}
+
+// removeOOXMLMacros removes the VBA project of the main part and the other
+// parts only valid in macro-enabled files, with the parts they refer to, and
+// gives the main part its macro-free content type
+func (p *Processor) removeOOXMLMacros(pkg *ooxmlPackage, main string) error {
+	rels, err := pkg.relationships(main)
+	if err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		part := pkg.part(rel.target)
+		name, ok := ooxmlMacroParts[path.Base(rel.typ)]
+		if rel.external || part == nil || !ok {
+			continue
+		}
+		// Word keeps the project's data and the toolbars of its key map
+		// customizations in parts of their own
+		partRels, err := pkg.relationships(part.name)
+		if err != nil {
+			return err
+		}
+		for _, partRel := range partRels {
+			if !partRel.external {
+				pkg.remove(partRel.target)
+			}
+		}
+		p.Stats.AddMetadata(stats.TypeDocument, name, "")
+		pkg.remove(part.name)
+	}
+
+	// The default content type of .bin parts is the VBA project's
+	binLeft := false
+	for _, part := range pkg.parts {
+		if !pkg.removed[part.name] && strings.EqualFold(path.Ext(part.name), ".bin") {
+			binLeft = true
+		}
+	}
+
+	types := pkg.part(ooxmlContentTypesPath)
+	data, err := rewriteXML(types.data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.is(ooxmlContentTypesNamespace, "Default") {
+				ext, _ := e.attr("", "Extension")
+				contentType, _ := e.attr("", "ContentType")
+				if !binLeft && strings.EqualFold(ext, "bin") && contentType == "application/vnd.ms-office.vbaProject" {
+					return xmlDrop
+				}
+			}
+			if name, _ := e.attr("", "PartName"); !e.is(ooxmlContentTypesNamespace, "Override") || !strings.EqualFold(strings.TrimPrefix(name, "/"), main) {
+				return xmlKeep
+			}
+			for i, attr := range e.attrs {
+				if free, ok := ooxmlMacroFreeContentTypes[attr.Value]; ok && attr.Name.Space == "" && attr.Name.Local == "ContentType" {
+					e.attrs[i].Value = free
+				}
+			}
+			return xmlKeep
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid Office Open XML part %s: %v", types.name, err)
+	}
+	types.data = data
+	return nil
+}
+
+// devmodeDeviceName returns the printer name at the start of a Windows DEVMODE structure
+func devmodeDeviceName(data []byte) string {
+	var name []uint16
+	for i := 0; i+1 < len(data) && i < 64; i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	return string(utf16.Decode(name))
+}
+
+// cleanOOXMLMainPart runs the cleaning specific to the kind of document,
+// which is told by the root element of the main part
+func (p *Processor) cleanOOXMLMainPart(pkg *ooxmlPackage, main *ooxmlPart) error {
+	switch root := xmlRootName(main.data); {
+	case root.Space == wordNamespace && root.Local == "document":
+		return p.cleanWordDocument(pkg, main.name)
+	case root.Space == spreadsheetNamespace && root.Local == "workbook":
+		return p.cleanSpreadsheet(pkg, main.name)
+	case root.Space == presentationNamespace && root.Local == "presentation":
+		return p.cleanPresentation(pkg, main.name)
+	}
+	return nil
+}
+
+// cleanOOXMLCoreProperties removes every core property
+func (p *Processor) cleanOOXMLCoreProperties(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.parent != nil && e.parent.parent == nil {
+				return xmlDrop
+			}
+			return xmlKeep
+		},
+		removed: func(e *xmlElement, text string) {
+			if strings.TrimSpace(text) == "" {
+				return
+			}
+			name := ooxmlCoreNames[e.name.Local]
+			if name == "" {
+				name = xmlQualifiedName(e.name)
+			}
+			p.Stats.AddMetadata(stats.TypeDocument, name, metadataExample(text))
+		},
+	})
+}
+
+// cleanOOXMLAppProperties removes the extended properties that identify the
+// author, their organisation and the application
+func (p *Processor) cleanOOXMLAppProperties(data []byte) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.parent != nil && e.parent.parent == nil && ooxmlAppNames[e.name.Local] != "" {
+				return xmlDrop
+			}
+			return xmlKeep
+		},
+		removed: func(e *xmlElement, text string) {
+			if strings.TrimSpace(text) != "" {
+				p.Stats.AddMetadata(stats.TypeDocument, ooxmlAppNames[e.name.Local], metadataExample(text))
+			}
+		},
+	})
+}
+
+// reportOOXMLCustomProperties records the custom properties of a part that is removed
+func (p *Processor) reportOOXMLCustomProperties(data []byte) error {
+	_, err := rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.name.Local == "property" {
+				return xmlDrop
+			}
+			return xmlKeep
+		},
+		removed: func(e *xmlElement, text string) {
+			name, _ := e.attr("", "name")
+			p.Stats.AddMetadata(stats.TypeDocument, "Custom property", metadataExample(name+"="+strings.TrimSpace(text)))
+		},
+	})
+	return err
+}
+
+// removeOOXMLAttrs removes the unprefixed attributes in fields from every
+// element, reporting those that have a name there
+func (p *Processor) removeOOXMLAttrs(data []byte, fields map[string]string) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			kept := e.attrs[:0:0]
+			for _, attr := range e.attrs {
+				if name, ok := fields[attr.Name.Local]; ok && attr.Name.Space == "" {
+					if name != "" {
+						p.Stats.AddMetadata(stats.TypeDocument, name, metadataExample(attr.Value))
+					}
+					continue
+				}
+				kept = append(kept, attr)
+			}
+			e.attrs = kept
+			return xmlKeep
+		},
+	})
+}
+
+// readOOXMLPackage reads every entry of an Office Open XML archive
+func readOOXMLPackage(r *zip.Reader) (*ooxmlPackage, error) {
+	pkg := &ooxmlPackage{removed: make(map[string]bool)}
+	for _, file := range r.File {
+		part := &ooxmlPart{name: file.Name, method: file.Method}
+		if !strings.HasSuffix(file.Name, "/") {
+			data, err := readZipFile(file)
+			if err != nil {
+				return nil, err
+			}
+			part.data = data
+		}
+		pkg.parts = append(pkg.parts, part)
+	}
+	if pkg.part(ooxmlContentTypesPath) == nil {
+		return nil, errors.New("not a valid Office Open XML file: missing content types")
+	}
+	return pkg, nil
+}
+
+// part returns the part with the name, or nil if there is none or it was removed.
+// Part names are compared without case, as in the packaging specification.
+func (pkg *ooxmlPackage) part(name string) *ooxmlPart {
+	for _, part := range pkg.parts {
+		if strings.EqualFold(part.name, name) && !pkg.removed[part.name] {
+			return part
+		}
+	}
+	return nil
+}
+
+// remove drops a part and its relationships. References to it are dropped by fixReferences.
+func (pkg *ooxmlPackage) remove(name string) {
+	for _, part := range pkg.parts {
+		if strings.EqualFold(part.name, name) || strings.EqualFold(part.name, ooxmlRelsPath(name)) {
+			pkg.removed[part.name] = true
+		}
+	}
+}
+
+// relationships returns the relationships of a part; the package's own are those of ""
+func (pkg *ooxmlPackage) relationships(source string) ([]ooxmlRelationship, error) {
+	part := pkg.part(ooxmlRelsPath(source))
+	if part == nil {
+		return nil, nil
+	}
+
+	var rels []ooxmlRelationship
+	_, err := rewriteXML(part.data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.is(ooxmlRelsNamespace, "Relationship") {
+				id, _ := e.attr("", "Id")
+				typ, _ := e.attr("", "Type")
+				target, _ := e.attr("", "Target")
+				mode, _ := e.attr("", "TargetMode")
+				rel := ooxmlRelationship{id: id, typ: typ, target: target, external: mode == "External"}
+				if !rel.external {
+					rel.target = ooxmlResolveTarget(source, target)
+				}
+				rels = append(rels, rel)
+			}
+			return xmlKeep
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+	}
+	return rels, nil
+}
+
+// fixReferences drops the content type overrides and relationships that point
+// at removed parts. Attributes that still refer to a dropped relationship are
+// removed from the source part, together with the element when the reference
+// is all it holds.
+func (pkg *ooxmlPackage) fixReferences() error {
+	isRemoved := func(name string) bool {
+		for removed := range pkg.removed {
+			if strings.EqualFold(removed, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	dropped := make(map[string]map[string]bool) // Dropped relationship IDs by source part
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] {
+			continue
+		}
+
+		var rules xmlRules
+		if part.name == ooxmlContentTypesPath {
+			rules.element = func(e *xmlElement) xmlAction {
+				if e.is(ooxmlContentTypesNamespace, "Override") {
+					if name, _ := e.attr("", "PartName"); isRemoved(strings.TrimPrefix(name, "/")) {
+						return xmlDrop
+					}
+				}
+				return xmlKeep
+			}
+		} else if source, ok := ooxmlRelsSource(part.name); ok {
+			rules.element = func(e *xmlElement) xmlAction {
+				if e.is(ooxmlRelsNamespace, "Relationship") {
+					target, _ := e.attr("", "Target")
+					mode, _ := e.attr("", "TargetMode")
+					if mode != "External" && isRemoved(ooxmlResolveTarget(source, target)) {
+						if dropped[source] == nil {
+							dropped[source] = make(map[string]bool)
+						}
+						id, _ := e.attr("", "Id")
+						dropped[source][id] = true
+						return xmlDrop
+					}
+				}
+				return xmlKeep
+			}
+		} else {
+			continue
+		}
+
+		data, err := rewriteXML(part.data, rules)
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+		part.data = data
+	}
+
+	for source, ids := range dropped {
+		part := pkg.part(source)
+		if part == nil || !strings.HasSuffix(strings.ToLower(part.name), ".xml") {
+			continue
+		}
+		data, err := rewriteXML(part.data, xmlRules{
+			element: func(e *xmlElement) xmlAction {
+				kept := e.attrs[:0:0]
+				declarations := 0
+				for _, attr := range e.attrs {
+					if attr.Name.Space != "" && attr.Name.Space != "xmlns" && e.resolve(attr.Name.Space) == ooxmlRelationshipsNamespace && ids[attr.Value] {
+						continue
+					}
+					if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+						declarations++
+					}
+					kept = append(kept, attr)
+				}
+				if len(kept) == len(e.attrs) {
+					return xmlKeep
+				}
+				// An element left with only namespace declarations was only a reference
+				if len(kept) == declarations {
+					return xmlDrop
+				}
+				e.attrs = kept
+				return xmlKeep
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+		part.data = data
+	}
+	return nil
+}
+
+// write writes the parts that were not removed in their original order and
+// with their original compression. Timestamps are not copied.
+func (pkg *ooxmlPackage) write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] {
+			continue
+		}
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: part.name, Method: part.method})
+		if err != nil {
+			return err
+		}
+		if err := writeAll(entry, part.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// ooxmlRelsPath returns the name of the relationships part of a part
+func ooxmlRelsPath(name string) string {
+	dir, base := path.Split(name)
+	return dir + "_rels/" + base + ".rels"
+}
+
+// ooxmlRelsSource returns the part whose relationships a relationships part holds
+func ooxmlRelsSource(name string) (string, bool) {
+	dir, base := path.Split(name)
+	if !strings.HasSuffix(dir, "_rels/") || !strings.HasSuffix(base, ".rels") {
+		return "", false
+	}
+	return strings.TrimSuffix(dir, "_rels/") + strings.TrimSuffix(base, ".rels"), true
+}
+
+// ooxmlResolveTarget resolves a relationship target against its source part
+func ooxmlResolveTarget(source, target string) string {
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	if strings.HasPrefix(target, "/") {
+		return path.Clean(target)[1:]
+	}
+	return strings.TrimPrefix(path.Join(path.Dir(source), target), "/")
+}
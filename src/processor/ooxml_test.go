@@ -0,0 +1,387 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOOXMLContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/><Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/><Override PartName="/docProps/app.xml" ContentType="application/vnd.openxmlformats-officedocument.extended-properties+xml"/><Override PartName="/docProps/custom.xml" ContentType="application/vnd.openxmlformats-officedocument.custom-properties+xml"/></Types>`
+
+const testOOXMLRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties" Target="docProps/app.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/><Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties" Target="/docProps/custom.xml"/></Relationships>`
+
+const testOOXMLCore = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:d="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<d:title>Q3 layoffs
+draft</d:title>
+<d:creator>Jane Doe</d:creator>
+<cp:keywords/>
+<cp:lastModifiedBy>John Roe</cp:lastModifiedBy>
+<cp:revision>42</cp:revision>
+<cp:category>HR</cp:category>
+<cp:contentStatus>Confidential</cp:contentStatus>
+<dcterms:created xsi:type="dcterms:W3CDTF">2024-01-05T08:00:00Z</dcterms:created>
+<dcterms:modified xsi:type="dcterms:W3CDTF">2024-02-11T17:30:00Z</dcterms:modified>
+</cp:coreProperties>`
+
+const testOOXMLApp = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes"><Template>\\fileserver\templates\Memo.dotm</Template><TotalTime>187</TotalTime><Pages>3</Pages><Words>512</Words><Application>Microsoft Office Word</Application><Company>Acme Corp</Company><Manager>Alice Smith</Manager><HyperlinkBase>https://intranet.acme.local/</HyperlinkBase><AppVersion>16.0000</AppVersion></Properties>`
+
+const testOOXMLCustom = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes"><property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="2" name="MatterNumber"><vt:lpwstr>2024-0173</vt:lpwstr></property></Properties>`
+
+const testOOXMLDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>Body text</w:t></w:r></w:p></w:body></w:document>`
+
+// buildTestDOCX builds a Word document with core, extended and custom properties
+func buildTestDOCX(t *testing.T) []byte {
+	return buildTestZip(t,
+		testZipEntry{ooxmlContentTypesPath, zip.Deflate, testOOXMLContentTypes},
+		testZipEntry{"_rels/.rels", zip.Deflate, testOOXMLRels},
+		testZipEntry{"word/document.xml", zip.Deflate, testOOXMLDocument},
+		testZipEntry{"docProps/core.xml", zip.Store, testOOXMLCore},
+		testZipEntry{"docProps/app.xml", zip.Deflate, testOOXMLApp},
+		testZipEntry{"docProps/custom.xml", zip.Deflate, testOOXMLCustom},
+	)
+}
+
+// runStripOpenXML runs stripOpenXML over an in-memory package and returns its entries by name
+func runStripOpenXML(t *testing.T, proc *Processor, input []byte) ([]string, map[string]testZipEntry) {
+	r, err := zip.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("Failed to read test document: %v", err)
+	}
+	var out bytes.Buffer
+	if err := proc.stripOpenXML(r, &out); err != nil {
+		t.Fatalf("stripOpenXML failed: %v", err)
+	}
+
+	var names []string
+	entries := make(map[string]testZipEntry)
+	for _, entry := range readTestZip(t, out.Bytes()) {
+		names = append(names, entry.name)
+		entries[entry.name] = entry
+	}
+	return names, entries
+}
+
+func TestStripOpenXML(t *testing.T) {
+	proc := NewProcessor(nil, false)
+	names, entries := runStripOpenXML(t, proc, buildTestDOCX(t))
+
+	if got := strings.Join(names, ","); got != "[Content_Types].xml,_rels/.rels,word/document.xml,docProps/core.xml,docProps/app.xml" {
+		t.Errorf("Unexpected entries %s", got)
+	}
+	if entries["docProps/core.xml"].method != zip.Store {
+		t.Error("Compression method was not preserved")
+	}
+	if entries["word/document.xml"].data != testOOXMLDocument {
+		t.Error("word/document.xml was changed")
+	}
+
+	core := entries["docProps/core.xml"].data
+	for _, leak := range []string{"layoffs", "Jane", "John", "42", "HR", "Confidential", "2024", "keywords"} {
+		if strings.Contains(core, leak) {
+			t.Errorf("core.xml still contains %q", leak)
+		}
+	}
+	if !strings.Contains(core, "<cp:coreProperties") || !strings.Contains(core, "</cp:coreProperties>") {
+		t.Error("core.xml root element was removed")
+	}
+
+	app := entries["docProps/app.xml"].data
+	for _, leak := range []string{"fileserver", "TotalTime", "Microsoft", "Acme", "Alice", "intranet", "AppVersion"} {
+		if strings.Contains(app, leak) {
+			t.Errorf("app.xml still contains %q", leak)
+		}
+	}
+	if !strings.Contains(app, "<Pages>3</Pages><Words>512</Words>") {
+		t.Error("Document statistics were removed from app.xml")
+	}
+
+	if strings.Contains(entries[ooxmlContentTypesPath].data, "custom.xml") || !strings.Contains(entries[ooxmlContentTypesPath].data, "/docProps/app.xml") {
+		t.Errorf("Unexpected content types:\n%s", entries[ooxmlContentTypesPath].data)
+	}
+	if strings.Contains(entries["_rels/.rels"].data, "custom") || !strings.Contains(entries["_rels/.rels"].data, `Id="rId1"`) {
+		t.Errorf("Unexpected package relationships:\n%s", entries["_rels/.rels"].data)
+	}
+
+	for _, field := range []string{"Title", "Author", "Last modified by", "Revision", "Category", "Content status", "Creation date", "Modification date", "Template", "Editing time", "Application", "Company", "Manager", "Hyperlink base", "Application version", "Custom property"} {
+		if proc.Stats.ByMetadataType[field] == nil {
+			t.Errorf("%s was not reported in statistics", field)
+		}
+	}
+	if proc.Stats.ByMetadataType["Keywords"] != nil {
+		t.Error("Empty keywords were reported")
+	}
+	if field := proc.Stats.ByMetadataType["Custom property"]; field != nil && field.Examples[0] != "MatterNumber=2024-0173" {
+		t.Errorf("Unexpected custom property example %q", field.Examples[0])
+	}
+
+	t.Run("Invalid files", func(t *testing.T) {
+		invalid := [][]byte{
+			buildTestZip(t, testZipEntry{"word/document.xml", zip.Deflate, testOOXMLDocument}),
+			buildTestZip(t, testZipEntry{ooxmlContentTypesPath, zip.Deflate, testOOXMLContentTypes}, testZipEntry{"_rels/.rels", zip.Deflate, "<Relationships>"}),
+		}
+		for i, data := range invalid {
+			r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Failed to read invalid file %d: %v", i, err)
+			}
+			if err := NewProcessor(nil, false).stripOpenXML(r, &bytes.Buffer{}); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestOOXMLRelationshipPaths(t *testing.T) {
+	for _, tc := range []struct{ source, target, expected string }{
+		{"", "docProps/core.xml", "docProps/core.xml"},
+		{"", "/docProps/core.xml", "docProps/core.xml"},
+		{"word/document.xml", "media/image1.png", "word/media/image1.png"},
+		{"xl/worksheets/sheet1.xml", "../drawings/drawing1.xml", "xl/drawings/drawing1.xml"},
+		{"ppt/slides/slide1.xml", "../media/My%20Photo.jpg", "ppt/media/My Photo.jpg"},
+	} {
+		if got := ooxmlResolveTarget(tc.source, tc.target); got != tc.expected {
+			t.Errorf("ooxmlResolveTarget(%q, %q) = %q, want %q", tc.source, tc.target, got, tc.expected)
+		}
+	}
+
+	for _, name := range []string{"", "word/document.xml", "xl/worksheets/sheet1.xml"} {
+		if source, ok := ooxmlRelsSource(ooxmlRelsPath(name)); !ok || source != name {
+			t.Errorf("Relationships of %q resolve to %q", name, source)
+		}
+	}
+	if _, ok := ooxmlRelsSource("word/document.xml"); ok {
+		t.Error("word/document.xml is not a relationships part")
+	}
+}
+
+func TestCleanOpenXML(t *testing.T) {
+	tempDir, proc, cleanup := setupDocumentTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "memo.docx")
+	if err := os.WriteFile(filePath, buildTestDOCX(t), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessDocument(filePath, ".docx"); err != nil {
+		t.Fatalf("Failed to clean DOCX: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	entries := readTestZip(t, data)
+	if len(entries) != 5 || strings.Contains(entries[3].data, "Jane Doe") {
+		t.Error("DOCX was not cleaned correctly")
+	}
+}
+
+// buildTestXLSX builds a workbook with a thumbnail, printer settings and a custom XML part
+func buildTestXLSX(t *testing.T) []byte {
+	devmode := make([]byte, 220)
+	for i, c := range "HR-Floor3-LaserJet" {
+		devmode[2*i] = byte(c)
+	}
+	return buildTestZip(t,
+		testZipEntry{ooxmlContentTypesPath, zip.Deflate, `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/>` +
+			`<Default Extension="jpeg" ContentType="image/jpeg"/><Default Extension="bin" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.printerSettings"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/customXml/itemProps1.xml" ContentType="application/vnd.openxmlformats-officedocument.customXmlProperties+xml"/></Types>`},
+		testZipEntry{"_rels/.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/thumbnail" Target="docProps/thumbnail.jpeg"/></Relationships>`},
+		testZipEntry{"docProps/thumbnail.jpeg", zip.Store, string(buildTestJPEG(t))},
+		testZipEntry{"xl/workbook.xml", zip.Deflate, `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Salaries" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		testZipEntry{"xl/_rels/workbook.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXml" Target="../customXml/item1.xml"/></Relationships>`},
+		testZipEntry{"xl/worksheets/sheet1.xml", zip.Deflate, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetData/><pageSetup paperSize="9" orientation="portrait" r:id="rId1"/></worksheet>`},
+		testZipEntry{"xl/worksheets/_rels/sheet1.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/printerSettings" Target="../printerSettings/printerSettings1.bin"/></Relationships>`},
+		testZipEntry{"xl/printerSettings/printerSettings1.bin", zip.Deflate, string(devmode)},
+		testZipEntry{"customXml/item1.xml", zip.Deflate, `<p:properties xmlns:p="http://schemas.microsoft.com/office/2006/metadata/properties"><documentManagement><Owner>jane.doe@acme.com</Owner></documentManagement></p:properties>`},
+		testZipEntry{"customXml/itemProps1.xml", zip.Deflate, `<ds:datastoreItem ds:itemID="{6E2B5F4C-0000-0000-0000-000000000000}" xmlns:ds="http://schemas.openxmlformats.org/officeDocument/2006/customXml"/>`},
+		testZipEntry{"customXml/_rels/item1.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXmlProps" Target="itemProps1.xml"/></Relationships>`},
+	)
+}
+
+func TestOOXMLPartRemoval(t *testing.T) {
+	t.Run("Removed by default", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		names, entries := runStripOpenXML(t, proc, buildTestXLSX(t))
+
+		expected := "[Content_Types].xml,_rels/.rels,xl/workbook.xml,xl/_rels/workbook.xml.rels,xl/worksheets/sheet1.xml,xl/worksheets/_rels/sheet1.xml.rels"
+		if got := strings.Join(names, ","); got != expected {
+			t.Errorf("Unexpected entries %s", got)
+		}
+		if types := entries[ooxmlContentTypesPath].data; strings.Contains(types, "itemProps") || !strings.Contains(types, "/xl/worksheets/sheet1.xml") {
+			t.Errorf("Unexpected content types:\n%s", types)
+		}
+		if rels := entries["_rels/.rels"].data; strings.Contains(rels, "thumbnail") || !strings.Contains(rels, "xl/workbook.xml") {
+			t.Errorf("Unexpected package relationships:\n%s", rels)
+		}
+		if rels := entries["xl/_rels/workbook.xml.rels"].data; strings.Contains(rels, "customXml") || !strings.Contains(rels, "worksheets/sheet1.xml") {
+			t.Errorf("Unexpected workbook relationships:\n%s", rels)
+		}
+		if strings.Contains(entries["xl/worksheets/_rels/sheet1.xml.rels"].data, "printerSettings") {
+			t.Error("Printer settings relationship was not removed")
+		}
+		if sheet := entries["xl/worksheets/sheet1.xml"].data; !strings.Contains(sheet, `<pageSetup paperSize="9" orientation="portrait"/>`) {
+			t.Errorf("Dangling printer settings reference:\n%s", sheet)
+		}
+		if !strings.Contains(entries["xl/workbook.xml"].data, `r:id="rId1"`) {
+			t.Error("Unrelated relationship reference was removed")
+		}
+
+		for _, field := range []string{"Thumbnail", "Printer settings", "Custom XML"} {
+			if proc.Stats.ByMetadataType[field] == nil {
+				t.Errorf("%s was not reported in statistics", field)
+			}
+		}
+		if field := proc.Stats.ByMetadataType["Printer settings"]; field != nil && field.Examples[0] != "HR-Floor3-LaserJet" {
+			t.Errorf("Unexpected printer example %q", field.Examples[0])
+		}
+	})
+
+	t.Run("Kept by policy", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepDocumentThumbnail = true
+		proc.Policy.KeepPrinterSettings = true
+		proc.Policy.KeepCustomXML = true
+		names, entries := runStripOpenXML(t, proc, buildTestXLSX(t))
+
+		if len(names) != 11 {
+			t.Errorf("Parts were removed: %s", strings.Join(names, ","))
+		}
+		if !strings.Contains(entries["xl/worksheets/sheet1.xml"].data, `r:id="rId1"`) {
+			t.Error("Printer settings reference was removed")
+		}
+	})
+
+	t.Run("Word section reference", func(t *testing.T) {
+		pkg := &ooxmlPackage{removed: map[string]bool{"word/printerSettings/printerSettings1.bin": true}, parts: []*ooxmlPart{
+			{name: ooxmlContentTypesPath, data: []byte(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`)},
+			{name: "word/document.xml", data: []byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body><w:sectPr><w:printerSettings r:id="rId9"/><w:pgSz w:w="11906"/></w:sectPr></w:body></w:document>`)},
+			{name: "word/_rels/document.xml.rels", data: []byte(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId9" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/printerSettings" Target="printerSettings/printerSettings1.bin"/></Relationships>`)},
+		}}
+		if err := pkg.fixReferences(); err != nil {
+			t.Fatalf("fixReferences failed: %v", err)
+		}
+		if document := string(pkg.parts[1].data); strings.Contains(document, "printerSettings") || !strings.Contains(document, "<w:sectPr><w:pgSz") {
+			t.Errorf("Unexpected document:\n%s", document)
+		}
+	})
+}
+
+// buildTestDOCM builds a macro-enabled Word document with a VBA project and
+// key map customizations with attached toolbars
+func buildTestDOCM(t *testing.T) []byte {
+	return buildTestZip(t,
+		testZipEntry{ooxmlContentTypesPath, zip.Deflate, `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/>` +
+			`<Default Extension="bin" ContentType="application/vnd.ms-office.vbaProject"/>` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.ms-word.document.macroEnabled.main+xml"/>` +
+			`<Override PartName="/word/vbaData.xml" ContentType="application/vnd.ms-word.vbaData+xml"/>` +
+			`<Override PartName="/word/customizations.xml" ContentType="application/vnd.ms-word.keyMapCustomizations+xml"/>` +
+			`<Override PartName="/word/attachedToolbars.bin" ContentType="application/vnd.ms-word.attachedToolbars"/></Types>`},
+		testZipEntry{"_rels/.rels", zip.Deflate, testWordPackageRels},
+		testZipEntry{"word/document.xml", zip.Deflate, `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p/></w:body></w:document>`},
+		testZipEntry{"word/_rels/document.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.microsoft.com/office/2006/relationships/vbaProject" Target="vbaProject.bin"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.microsoft.com/office/2006/relationships/keyMapCustomizations" Target="customizations.xml"/></Relationships>`},
+		testZipEntry{"word/vbaProject.bin", zip.Store, "VBA project of C:\\Users\\jane\\Macros"},
+		testZipEntry{"word/_rels/vbaProject.bin.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.microsoft.com/office/2006/relationships/wordVbaData" Target="vbaData.xml"/></Relationships>`},
+		testZipEntry{"word/vbaData.xml", zip.Deflate, `<wne:vbaSuppData xmlns:wne="http://schemas.microsoft.com/office/word/2006/wordml"/>`},
+		testZipEntry{"word/customizations.xml", zip.Deflate, `<wne:tcg xmlns:wne="http://schemas.microsoft.com/office/word/2006/wordml"><wne:keymaps/></wne:tcg>`},
+		testZipEntry{"word/_rels/customizations.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.microsoft.com/office/2006/relationships/attachedToolbars" Target="attachedToolbars.bin"/></Relationships>`},
+		testZipEntry{"word/attachedToolbars.bin", zip.Store, "Toolbars of C:\\Users\\jane\\Normal.dotm"},
+	)
+}
+
+func TestOOXMLMacroRemoval(t *testing.T) {
+	t.Run("Kept by default", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		names, entries := runStripOpenXML(t, proc, buildTestDOCM(t))
+
+		if len(names) != 10 || !strings.Contains(entries[ooxmlContentTypesPath].data, "macroEnabled") {
+			t.Errorf("VBA project was changed: %s", strings.Join(names, ","))
+		}
+	})
+
+	t.Run("Removed by policy", func(t *testing.T) {
+		tempDir, proc, cleanup := setupDocumentTest(t)
+		defer cleanup()
+		proc.Policy.RemoveMacros = true
+
+		filePath := filepath.Join(tempDir, "report.docm")
+		if err := os.WriteFile(filePath, buildTestDOCM(t), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := proc.ProcessDocument(filePath, ".docm"); err != nil {
+			t.Fatalf("Failed to clean DOCM: %v", err)
+		}
+
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Error("Macro-enabled file was not renamed")
+		}
+		data, err := os.ReadFile(filepath.Join(tempDir, "report.docx"))
+		if err != nil {
+			t.Fatalf("Failed to read cleaned file: %v", err)
+		}
+		var names []string
+		entries := make(map[string]testZipEntry)
+		for _, entry := range readTestZip(t, data) {
+			names = append(names, entry.name)
+			entries[entry.name] = entry
+		}
+		if got := strings.Join(names, ","); got != "[Content_Types].xml,_rels/.rels,word/document.xml,word/_rels/document.xml.rels" {
+			t.Errorf("Unexpected entries %s", got)
+		}
+		types := entries[ooxmlContentTypesPath].data
+		if strings.Contains(types, "macroEnabled") || strings.Contains(types, "vbaData") || strings.Contains(types, `Extension="bin"`) ||
+			strings.Contains(types, "keyMapCustomizations") || strings.Contains(types, "attachedToolbars") || !strings.Contains(types, `ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"`) {
+			t.Errorf("Unexpected content types:\n%s", types)
+		}
+		if rels := entries["word/_rels/document.xml.rels"].data; strings.Contains(rels, "vbaProject") || strings.Contains(rels, "keyMapCustomizations") {
+			t.Error("Relationships to the VBA project or key map customizations were not removed")
+		}
+		for _, field := range []string{"VBA project", "Key map customizations"} {
+			if proc.Stats.ByMetadataType[field] == nil {
+				t.Errorf("%s was not reported in statistics", field)
+			}
+		}
+	})
+
+	t.Run("Existing macro-free file", func(t *testing.T) {
+		tempDir, proc, cleanup := setupDocumentTest(t)
+		defer cleanup()
+		proc.Policy.RemoveMacros = true
+
+		filePath := filepath.Join(tempDir, "report.docm")
+		input := buildTestDOCM(t)
+		if err := os.WriteFile(filePath, input, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, "report.docx"), []byte("other"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := proc.ProcessDocument(filePath, ".docm"); err == nil {
+			t.Error("Expected error when the macro-free file exists")
+		}
+		if data, _ := os.ReadFile(filePath); !bytes.Equal(data, input) {
+			t.Error("Macro-enabled file was changed")
+		}
+	})
+}
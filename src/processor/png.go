@@ -0,0 +1,238 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"metadata-remover/src/stats"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+// pngRenderChunks are the ancillary chunks that affect how the image is displayed,
+// including the APNG animation chunks
+var pngRenderChunks = map[string]bool{
+	"tRNS": true,
+	"gAMA": true,
+	"cHRM": true,
+	"sRGB": true,
+	"cICP": true,
+	"mDCv": true,
+	"cLLi": true,
+	"sBIT": true,
+	"bKGD": true,
+	"hIST": true,
+	"sPLT": true,
+	"acTL": true,
+	"fcTL": true,
+	"fdAT": true,
+}
+
+// pngChunkNames names the metadata chunks reported in statistics
+var pngChunkNames = map[string]string{
+	"tEXt": "Text",
+	"zTXt": "Text",
+	"iTXt": "Text",
+	"tIME": "Modification time",
+	"eXIf": "EXIF",
+	"zxIf": "EXIF",
+	"iCCP": "ICC Profile",
+	"pHYs": "Resolution",
+	"caBX": "C2PA",
+	"iDOT": "Apple iDOT",
+	"vpAg": "ImageMagick vpAg",
+	"prVW": "Preview",
+	"mkBF": "Fireworks",
+	"mkBS": "Fireworks",
+	"mkBT": "Fireworks",
+	"mkTS": "Fireworks",
+}
+
+// pngMaxTextExample caps how much of a text chunk is read for the statistics example
+const pngMaxTextExample = 1024
+
+// cleanPNG removes metadata from PNG files
+func (p *Processor) cleanPNG(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripPNG(bufio.NewReader(file), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripPNG copies the chunks needed to render the image and drops the rest.
+// Every chunk CRC is verified so corrupt files are refused instead of rewritten.
+func (p *Processor) stripPNG(r io.Reader, w io.Writer) error {
+	// Read PNG signature
+	signature := make([]byte, 8)
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return errors.New("not a valid PNG file")
+	}
+
+	// Write PNG signature
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	crcBuf := make([]byte, 4)
+	for first := true; ; first = false {
+		// Read chunk length and type
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return errors.New("PNG file is missing its IEND chunk")
+			}
+			return errors.New("truncated PNG chunk header")
+		}
+
+		length := binary.BigEndian.Uint32(header[:4])
+		if length > 0x7FFFFFFF {
+			return errors.New("invalid PNG chunk length")
+		}
+		chunkType := string(header[4:8])
+		if first && chunkType != "IHDR" {
+			return errors.New("PNG file does not start with IHDR")
+		}
+
+		keep, err := p.keepPNGChunk(chunkType)
+		if err != nil {
+			return err
+		}
+
+		// The CRC covers the chunk type and data
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:8])
+
+		var data bytes.Buffer
+		var dst io.Writer = crc
+		switch {
+		case keep:
+			if _, err := w.Write(header); err != nil {
+				return err
+			}
+			dst = io.MultiWriter(w, crc)
+		case pngChunkNames[chunkType] == "Text":
+			dst = io.MultiWriter(crc, &limitedBuffer{buf: &data, limit: pngMaxTextExample})
+		}
+
+		if _, err := io.CopyN(dst, r, int64(length)); err != nil {
+			return fmt.Errorf("truncated PNG chunk %q", chunkType)
+		}
+		if _, err := io.ReadFull(r, crcBuf); err != nil {
+			return fmt.Errorf("truncated PNG chunk %q", chunkType)
+		}
+		if binary.BigEndian.Uint32(crcBuf) != crc.Sum32() {
+			return fmt.Errorf("CRC mismatch in PNG chunk %q", chunkType)
+		}
+
+		if keep {
+			if _, err := w.Write(crcBuf); err != nil {
+				return err
+			}
+		} else {
+			p.reportPNGChunk(chunkType, data.Bytes())
+		}
+
+		// IEND chunk signals the end of the PNG file
+		if chunkType == "IEND" {
+			if n, _ := io.Copy(io.Discard, r); n > 0 {
+				p.Stats.AddMetadata(stats.TypeImage, "Trailing data", fmt.Sprintf("%d bytes after IEND", n))
+			}
+			return nil
+		}
+	}
+}
+
+// keepPNGChunk decides whether a chunk is copied to the cleaned file
+func (p *Processor) keepPNGChunk(chunkType string) (bool, error) {
+	switch {
+	case chunkType == "IHDR", chunkType == "PLTE", chunkType == "IDAT", chunkType == "IEND":
+		return true, nil
+	case chunkType[0]&0x20 == 0:
+		// Unknown critical chunks can't be dropped without breaking the image
+		return false, fmt.Errorf("unsupported critical PNG chunk %q", chunkType)
+	case chunkType == "iCCP":
+		return p.Policy.KeepICCProfile, nil
+	case chunkType == "pHYs":
+		return p.Policy.KeepResolution, nil
+	case chunkType == "caBX":
+		return p.Policy.KeepContentCredentials, nil
+	default:
+		return pngRenderChunks[chunkType], nil
+	}
+}
+
+// reportPNGChunk records a removed chunk, using the keyword and text of text chunks as the example
+func (p *Processor) reportPNGChunk(chunkType string, data []byte) {
+	name, ok := pngChunkNames[chunkType]
+	if !ok {
+		name = fmt.Sprintf("PNG chunk %q", chunkType)
+	}
+
+	example := ""
+	if name == "Text" {
+		// tEXt is keyword\0text; compressed and international text only expose the keyword
+		parts := bytes.SplitN(data, []byte{0}, 2)
+		name = string(parts[0])
+		if chunkType == "tEXt" && len(parts) == 2 {
+			example = string(parts[1])
+		}
+		if name == "" {
+			name = "Text"
+		}
+	}
+
+	p.Stats.AddMetadata(stats.TypeImage, name, example)
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(data) < room {
+			room = len(data)
+		}
+		b.buf.Write(data[:room])
+	}
+	return len(data), nil
+}
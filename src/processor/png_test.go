@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPNGChunk builds a chunk with a valid CRC
+func testPNGChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+// buildTestPNG encodes a small image, inserts chunks after IHDR and appends trailing bytes after IEND
+func buildTestPNG(t *testing.T, afterIHDR [][]byte, beforeIEND [][]byte) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	img.Set(1, 1, color.NRGBA{G: 255, A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode test PNG: %v", err)
+	}
+
+	data := buf.Bytes()
+	ihdrEnd := 8 + 12 + 13
+	iend := len(data) - 12
+
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, bytes.Join(afterIHDR, nil)...)
+	out = append(out, data[ihdrEnd:iend]...)
+	out = append(out, bytes.Join(beforeIEND, nil)...)
+	return append(out, data[iend:]...)
+}
+
+func TestStripPNG(t *testing.T) {
+	text := testPNGChunk("tEXt", []byte("Author\x00Jane Doe"))
+	itxt := testPNGChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))
+	timeChunk := testPNGChunk("tIME", []byte{0x07, 0xE7, 1, 1, 12, 0, 0})
+	exif := testPNGChunk("eXIf", []byte("MM\x00\x2A serial"))
+	private := testPNGChunk("vpAg", []byte("imagemagick"))
+	c2pa := testPNGChunk("caBX", []byte("jumbc2pa"))
+	icc := testPNGChunk("iCCP", []byte("profile\x00\x00compressed"))
+	phys := testPNGChunk("pHYs", []byte{0, 0, 0x0B, 0x13, 0, 0, 0x0B, 0x13, 1})
+	gamma := testPNGChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})
+
+	t.Run("Metadata chunks removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestPNG(t, [][]byte{icc, phys, gamma, text, itxt, private, c2pa}, [][]byte{timeChunk, exif})
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPNG(bytes.NewReader(input), w)
+		})
+
+		for _, chunk := range [][]byte{text, itxt, timeChunk, exif, private, c2pa} {
+			if bytes.Contains(output, chunk) {
+				t.Errorf("Chunk %q was not removed", chunk[4:8])
+			}
+		}
+		for _, chunk := range [][]byte{icc, phys, gamma} {
+			if !bytes.Contains(output, chunk) {
+				t.Errorf("Chunk %q was removed", chunk[4:8])
+			}
+		}
+
+		if _, err := png.Decode(bytes.NewReader(output)); err != nil {
+			t.Errorf("Cleaned PNG does not decode: %v", err)
+		}
+
+		if field := proc.Stats.ByMetadataType["Author"]; field == nil || field.Examples[0] != "Jane Doe" {
+			t.Error("Text chunk was not reported with its keyword and value")
+		}
+		for _, name := range []string{"XML:com.adobe.xmp", "Modification time", "EXIF", "C2PA"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("Optional chunks follow policy", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepICCProfile = false
+		proc.Policy.KeepResolution = false
+		proc.Policy.KeepContentCredentials = true
+		input := buildTestPNG(t, [][]byte{icc, phys, c2pa}, nil)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPNG(bytes.NewReader(input), w)
+		})
+		if bytes.Contains(output, icc) || bytes.Contains(output, phys) {
+			t.Error("iCCP and pHYs should be removed by policy")
+		}
+		if !bytes.Contains(output, c2pa) {
+			t.Error("caBX should be kept by policy")
+		}
+	})
+
+	t.Run("APNG chunks pass through", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		actl := testPNGChunk("acTL", []byte{0, 0, 0, 2, 0, 0, 0, 0})
+		fctl0 := testPNGChunk("fcTL", append([]byte{0, 0, 0, 0}, make([]byte, 22)...))
+		fctl1 := testPNGChunk("fcTL", append([]byte{0, 0, 0, 1}, make([]byte, 22)...))
+		fdat := testPNGChunk("fdAT", []byte{0, 0, 0, 2, 0x78, 0x9C})
+		input := buildTestPNG(t, [][]byte{actl, fctl0}, [][]byte{text, fctl1, fdat})
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPNG(bytes.NewReader(input), w)
+		})
+		expected := buildTestPNG(t, [][]byte{actl, fctl0}, [][]byte{fctl1, fdat})
+		if !bytes.Equal(output, expected) {
+			t.Error("APNG sequence was not preserved")
+		}
+	})
+
+	t.Run("Data after IEND dropped", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		clean := buildTestPNG(t, nil, nil)
+		input := append(append([]byte{}, clean...), []byte("hidden zip archive")...)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPNG(bytes.NewReader(input), w)
+		})
+		if !bytes.Equal(output, clean) {
+			t.Error("Data after IEND was not removed")
+		}
+		if proc.Stats.ByMetadataType["Trailing data"] == nil {
+			t.Error("Trailing data was not reported")
+		}
+	})
+
+	t.Run("Corrupt files refused", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		clean := buildTestPNG(t, nil, nil)
+
+		badCRC := append([]byte{}, clean...)
+		badCRC[len(badCRC)-20] ^= 0xFF
+
+		invalid := [][]byte{
+			[]byte("Not a PNG file"),
+			pngSignature,
+			clean[:len(clean)-6],
+			badCRC,
+			buildTestPNG(t, [][]byte{testPNGChunk("ZZZZ", nil)}, nil),
+			append(append([]byte{}, pngSignature...), testPNGChunk("IDAT", nil)...),
+		}
+		for i, data := range invalid {
+			if err := proc.stripPNG(bytes.NewReader(data), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanPNG(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "screenshot.png")
+	input := buildTestPNG(t, [][]byte{testPNGChunk("tEXt", []byte("Software\x00SecretEditor"))}, nil)
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".png"); err != nil {
+		t.Fatalf("Failed to clean PNG: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("SecretEditor")) {
+		t.Error("Text chunk still present after cleaning")
+	}
+}
@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+const (
+	presentationNamespace       = "http://schemas.openxmlformats.org/presentationml/2006/main"
+	presentationModernNamespace = "http://schemas.microsoft.com/office/powerpoint/2018/8/main"
+	drawingNamespace            = "http://schemas.openxmlformats.org/drawingml/2006/main"
+)
+
+// cleanPresentation removes reviewer information from a PresentationML
+// document. Comment authors, in both the legacy and the modern comment parts,
+// become "Author" and comment dates are removed, unless the policy removes the
+// comments and their authors altogether. Notes slides are removed when the
+// policy asks for it. Hidden slides are reported, as they are easy to forget
+// and still travel with the deck.
+func (p *Processor) cleanPresentation(pkg *ooxmlPackage, main string) error {
+	if err := p.reportHiddenSlides(pkg, main); err != nil {
+		return err
+	}
+
+	// Authors come first, so removed comments can be reported by author
+	dir := path.Dir(main) + "/"
+	authors := make(map[string]string)
+	var parts []*ooxmlPart
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] || !strings.HasPrefix(part.name, dir) || !strings.HasSuffix(strings.ToLower(part.name), ".xml") {
+			continue
+		}
+		root := xmlRootName(part.data)
+		if !(root.Space == presentationNamespace && root.Local == "cmAuthorLst") && !(root.Space == presentationModernNamespace && root.Local == "authorLst") {
+			parts = append(parts, part)
+			continue
+		}
+		data, err := p.cleanPresentationAuthors(part.data, authors)
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+		part.data = data
+		if p.Policy.RemoveComments {
+			pkg.remove(part.name)
+		}
+	}
+
+	for _, part := range parts {
+		var err error
+		switch root := xmlRootName(part.data); {
+		case (root.Space == presentationNamespace || root.Space == presentationModernNamespace) && root.Local == "cmLst":
+			if p.Policy.RemoveComments {
+				err = p.reportPresentationComments(part.data, authors)
+				pkg.remove(part.name)
+			} else {
+				part.data, err = p.removeOOXMLAttrs(part.data, map[string]string{"dt": "", "created": ""})
+			}
+		case root.Space == presentationNamespace && root.Local == "notes" && p.Policy.RemoveSpeakerNotes:
+			err = p.reportSpeakerNotes(part.data)
+			pkg.remove(part.name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+	}
+	return nil
+}
+
+// cleanPresentationAuthors anonymizes the comment authors of a presentation
+// and collects their names by ID
+func (p *Processor) cleanPresentationAuthors(data []byte, authors map[string]string) ([]byte, error) {
+	return rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if !e.is(presentationNamespace, "cmAuthor") && !e.is(presentationModernNamespace, "author") {
+				return xmlKeep
+			}
+			id, _ := e.attr("", "id")
+			kept := e.attrs[:0:0]
+			for _, attr := range e.attrs {
+				if attr.Name.Space == "" {
+					switch attr.Name.Local {
+					case "name":
+						authors[id] = attr.Value
+						if attr.Value != wordAnonymousAuthor && !p.Policy.RemoveComments {
+							p.Stats.AddMetadata(stats.TypeDocument, "Comment author", metadataExample(attr.Value))
+						}
+						attr.Value = wordAnonymousAuthor
+					case "initials":
+						attr.Value = wordAnonymousInitials
+					case "userId", "providerId":
+						continue
+					}
+				}
+				kept = append(kept, attr)
+			}
+			e.attrs = kept
+			return xmlKeep
+		},
+	})
+}
+
+// reportPresentationComments records the comments and replies of a comment
+// part that is removed
+func (p *Processor) reportPresentationComments(data []byte, authors map[string]string) error {
+	_, err := rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.is(presentationNamespace, "cm") || e.is(presentationModernNamespace, "cm") || e.is(presentationModernNamespace, "reply") {
+				id, _ := e.attr("", "authorId")
+				p.Stats.AddMetadata(stats.TypeDocument, "Comment", metadataExample(authors[id]))
+			}
+			return xmlKeep
+		},
+	})
+	return err
+}
+
+// reportSpeakerNotes records the text of a notes slide that is removed. Fields
+// such as the slide number are left out.
+func (p *Processor) reportSpeakerNotes(data []byte) error {
+	var text []string
+	_, err := rewriteXML(data, xmlRules{
+		text: func(e *xmlElement, data string) (string, bool) {
+			if e.is(drawingNamespace, "t") && (e.parent == nil || !e.parent.is(drawingNamespace, "fld")) {
+				text = append(text, data)
+			}
+			return "", false
+		},
+	})
+	if err == nil {
+		p.Stats.AddMetadata(stats.TypeDocument, "Speaker notes", metadataExample(strings.TrimSpace(strings.Join(text, " "))))
+	}
+	return err
+}
+
+// reportHiddenSlides records the slides of the presentation that are not
+// shown, numbered in presentation order
+func (p *Processor) reportHiddenSlides(pkg *ooxmlPackage, main string) error {
+	rels, err := pkg.relationships(main)
+	if err != nil {
+		return err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels {
+		if !rel.external {
+			targets[rel.id] = rel.target
+		}
+	}
+
+	var slides []string
+	_, err = rewriteXML(pkg.part(main).data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.is(presentationNamespace, "sldId") {
+				id, _ := e.attr(ooxmlRelationshipsNamespace, "id")
+				slides = append(slides, targets[id])
+			}
+			return xmlKeep
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid Office Open XML part %s: %v", main, err)
+	}
+
+	for i, name := range slides {
+		part := pkg.part(name)
+		if part == nil {
+			continue
+		}
+		hidden := false
+		_, err := rewriteXML(part.data, xmlRules{
+			element: func(e *xmlElement) xmlAction {
+				if e.parent == nil && e.is(presentationNamespace, "sld") {
+					show, _ := e.attr("", "show")
+					hidden = show == "0" || show == "false"
+				}
+				return xmlKeep
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+		if hidden {
+			p.Stats.AddMetadata(stats.TypeDocument, "Hidden slide", fmt.Sprintf("Slide %d", i+1))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+)
+
+const testPresentationContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/ppt/presentation.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml"/><Override PartName="/ppt/slides/slide1.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.slide+xml"/><Override PartName="/ppt/slides/slide2.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.slide+xml"/><Override PartName="/ppt/notesSlides/notesSlide1.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.notesSlide+xml"/><Override PartName="/ppt/commentAuthors.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.commentAuthors+xml"/><Override PartName="/ppt/comments/comment1.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.comments+xml"/><Override PartName="/ppt/authors.xml" ContentType="application/vnd.ms-powerpoint.authors+xml"/><Override PartName="/ppt/comments/modernComment_100_1.xml" ContentType="application/vnd.ms-powerpoint.comments+xml"/></Types>`
+
+const testPresentationRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/commentAuthors" Target="commentAuthors.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide1.xml"/><Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide2.xml"/><Relationship Id="rId4" Type="http://schemas.microsoft.com/office/2018/10/relationships/authors" Target="authors.xml"/></Relationships>`
+
+const testPresentation = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><p:sldIdLst><p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId3"/></p:sldIdLst></p:presentation>`
+
+const testPresentationSlideRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/><Relationship Id="rId3" Type="http://schemas.microsoft.com/office/2018/10/relationships/comments" Target="../comments/modernComment_100_1.xml"/><Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments" Target="../comments/comment1.xml"/></Relationships>`
+
+const testPresentationSlide = `<p:sld xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><p:cSld><p:spTree/></p:cSld><p:extLst><p:ext uri="{6950BFC3-D8DA-4A85-94F7-54DA5524770B}"><p188:commentRel xmlns:p188="http://schemas.microsoft.com/office/powerpoint/2018/8/main" r:id="rId3"/></p:ext></p:extLst></p:sld>`
+
+const testPresentationNotes = `<p:notes xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>Do not mention</a:t></a:r><a:r><a:t>the layoffs</a:t></a:r></a:p><a:p><a:fld id="{B1}" type="slidenum"><a:t>1</a:t></a:fld></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:notes>`
+
+const testPresentationCommentAuthors = `<p:cmAuthorLst xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:cmAuthor id="1" name="Jane Doe" initials="JD" lastIdx="1" clrIdx="0"/></p:cmAuthorLst>`
+
+const testPresentationComments = `<p:cmLst xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:cm authorId="1" dt="2024-03-01T10:00:00.000" idx="1"><p:pos x="10" y="10"/><p:text>Move this chart</p:text></p:cm></p:cmLst>`
+
+const testPresentationAuthors = `<p188:authorLst xmlns:p188="http://schemas.microsoft.com/office/powerpoint/2018/8/main"><p188:author id="{5A1F0000-0000-0000-0000-000000000001}" name="John Roe" initials="JR" userId="S::john.roe@acme.com::4d2e" providerId="AD"/></p188:authorLst>`
+
+const testPresentationModernComments = `<p188:cmLst xmlns:p188="http://schemas.microsoft.com/office/powerpoint/2018/8/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><p188:cm id="{C0000000-0000-0000-0000-000000000001}" authorId="{5A1F0000-0000-0000-0000-000000000001}" created="2024-03-02T09:00:00.000"><p188:replyLst><p188:reply id="{C0000000-0000-0000-0000-000000000002}" authorId="{5A1F0000-0000-0000-0000-000000000001}" created="2024-03-02T09:05:00.000"><p188:txBody><a:p><a:r><a:t>Done</a:t></a:r></a:p></p188:txBody></p188:reply></p188:replyLst><p188:txBody><a:p><a:r><a:t>Check the figures</a:t></a:r></a:p></p188:txBody></p188:cm></p188:cmLst>`
+
+// buildTestPPTX builds a presentation with legacy and modern comments, speaker
+// notes and a hidden slide
+func buildTestPPTX(t *testing.T) []byte {
+	return buildTestZip(t,
+		testZipEntry{ooxmlContentTypesPath, zip.Deflate, testPresentationContentTypes},
+		testZipEntry{"_rels/.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="ppt/presentation.xml"/></Relationships>`},
+		testZipEntry{"ppt/presentation.xml", zip.Deflate, testPresentation},
+		testZipEntry{"ppt/_rels/presentation.xml.rels", zip.Deflate, testPresentationRels},
+		testZipEntry{"ppt/slides/slide1.xml", zip.Deflate, testPresentationSlide},
+		testZipEntry{"ppt/slides/_rels/slide1.xml.rels", zip.Deflate, testPresentationSlideRels},
+		testZipEntry{"ppt/slides/slide2.xml", zip.Deflate, `<p:sld xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" show="0"><p:cSld><p:spTree/></p:cSld></p:sld>`},
+		testZipEntry{"ppt/notesSlides/notesSlide1.xml", zip.Deflate, testPresentationNotes},
+		testZipEntry{"ppt/notesSlides/_rels/notesSlide1.xml.rels", zip.Deflate, `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="../slides/slide1.xml"/></Relationships>`},
+		testZipEntry{"ppt/commentAuthors.xml", zip.Deflate, testPresentationCommentAuthors},
+		testZipEntry{"ppt/comments/comment1.xml", zip.Deflate, testPresentationComments},
+		testZipEntry{"ppt/authors.xml", zip.Deflate, testPresentationAuthors},
+		testZipEntry{"ppt/comments/modernComment_100_1.xml", zip.Deflate, testPresentationModernComments},
+	)
+}
+
+func TestCleanPresentation(t *testing.T) {
+	t.Run("Anonymize", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		names, entries := runStripOpenXML(t, proc, buildTestPPTX(t))
+
+		if len(names) != 13 {
+			t.Errorf("Unexpected entries %s", strings.Join(names, ","))
+		}
+		if authors := entries["ppt/commentAuthors.xml"].data; !strings.Contains(authors, `<p:cmAuthor id="1" name="Author" initials="A" lastIdx="1" clrIdx="0"/>`) {
+			t.Errorf("Legacy comment authors were not anonymized:\n%s", authors)
+		}
+		if authors := entries["ppt/authors.xml"].data; !strings.Contains(authors, `<p188:author id="{5A1F0000-0000-0000-0000-000000000001}" name="Author" initials="A"/>`) {
+			t.Errorf("Modern comment authors were not anonymized:\n%s", authors)
+		}
+		for _, name := range []string{"ppt/comments/comment1.xml", "ppt/comments/modernComment_100_1.xml"} {
+			if comments := entries[name].data; strings.Contains(comments, "2024") || !strings.Contains(comments, "authorId=") {
+				t.Errorf("Unexpected comments in %s:\n%s", name, comments)
+			}
+		}
+		if entries["ppt/notesSlides/notesSlide1.xml"].data != testPresentationNotes {
+			t.Error("Speaker notes were changed")
+		}
+
+		if field := proc.Stats.ByMetadataType["Comment author"]; field == nil || field.Count != 2 {
+			t.Error("Comment authors were not reported")
+		}
+		if field := proc.Stats.ByMetadataType["Hidden slide"]; field == nil || field.Count != 1 || field.Examples[0] != "Slide 2" {
+			t.Error("Hidden slide was not reported")
+		}
+	})
+
+	t.Run("Remove comments and notes", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.RemoveComments = true
+		proc.Policy.RemoveSpeakerNotes = true
+		names, entries := runStripOpenXML(t, proc, buildTestPPTX(t))
+
+		if got := strings.Join(names, ","); got != "[Content_Types].xml,_rels/.rels,ppt/presentation.xml,ppt/_rels/presentation.xml.rels,ppt/slides/slide1.xml,ppt/slides/_rels/slide1.xml.rels,ppt/slides/slide2.xml" {
+			t.Errorf("Unexpected entries %s", got)
+		}
+		if types := entries[ooxmlContentTypesPath].data; strings.Contains(types, "comment") || strings.Contains(types, "authors") || strings.Contains(types, "notesSlide") || !strings.Contains(types, "/ppt/slides/slide2.xml") {
+			t.Errorf("Unexpected content types:\n%s", types)
+		}
+		if rels := entries["ppt/_rels/presentation.xml.rels"].data; strings.Contains(rels, "uthors") || !strings.Contains(rels, "slide2.xml") {
+			t.Errorf("Unexpected presentation relationships:\n%s", rels)
+		}
+		if rels := entries["ppt/slides/_rels/slide1.xml.rels"].data; strings.Contains(rels, "Relationship Id") {
+			t.Errorf("Unexpected slide relationships:\n%s", rels)
+		}
+		if slide := entries["ppt/slides/slide1.xml"].data; strings.Contains(slide, "commentRel") || !strings.Contains(slide, "<p:cSld>") {
+			t.Errorf("Comment reference was not removed:\n%s", slide)
+		}
+
+		if field := proc.Stats.ByMetadataType["Comment"]; field == nil || field.Count != 3 || field.Examples[0] != "Jane Doe" {
+			t.Error("Removed comments were not reported")
+		}
+		if field := proc.Stats.ByMetadataType["Speaker notes"]; field == nil || field.Examples[0] != "Do not mention the layoffs" {
+			t.Error("Removed speaker notes were not reported")
+		}
+		if proc.Stats.ByMetadataType["Comment author"] != nil {
+			t.Error("Authors of removed comments were reported twice")
+		}
+	})
+}
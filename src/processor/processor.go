@@ -3,6 +3,7 @@ package processor
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -16,8 +17,39 @@ type Processor struct {
 	logger      *logger.Logger
 	previewMode bool
 	Stats       *stats.MetadataStats
+	Policy      Policy
+	depth       int // Nesting level when cleaning files embedded in documents
 }
 
+// Policy controls which optional metadata is kept when cleaning files
+type Policy struct {
+	KeepICCProfile         bool // Keep embedded color profiles, which affect how colors render
+	KeepContentCredentials bool // Keep C2PA content credentials (JUMBF manifests)
+	KeepResolution         bool // Keep pixel density chunks such as PNG pHYs
+	KeepAudioTags          bool // Keep Vorbis comment tags; the encoder vendor string is still replaced
+	KeepCoverArt           bool // Keep embedded pictures in audio files
+	KeepCueSheet           bool // Keep FLAC cue sheets, which can carry catalog numbers and ISRCs
+	RemoveComments         bool // Remove Word and PowerPoint comments instead of anonymizing their authors
+	AcceptRevisions        bool // Accept Word tracked changes instead of anonymizing their authors
+	RemoveSpeakerNotes     bool // Remove the notes slides of PowerPoint presentations
+	KeepDocumentThumbnail  bool // Keep the rendering of the first page stored in office documents
+	KeepPrinterSettings    bool // Keep OOXML printer settings, which name printers and print servers
+	KeepCustomXML          bool // Keep OOXML custom XML parts, which document management systems fill
+	KeepExternalPaths      bool // Keep the paths of Excel external links, data sources and defined names, and the credentials of data connections
+	RemoveMacros           bool // Remove VBA projects, saving macro-enabled Office files in the macro-free format
+}
+
+// DefaultPolicy returns the policy used by new processors
+func DefaultPolicy() Policy {
+	return Policy{
+		KeepICCProfile: true,
+		KeepResolution: true,
+	}
+}
+
+// maxExampleLength caps the length of metadata values kept as statistics examples
+const maxExampleLength = 256
+
 // Using file type constants from stats package
 
 // NewProcessor creates a new processor
@@ -26,6 +58,7 @@ func NewProcessor(logger *logger.Logger, previewMode bool) *Processor {
 		logger:      logger,
 		previewMode: previewMode,
 		Stats:       stats.NewMetadataStats(),
+		Policy:      DefaultPolicy(),
 	}
 }
 
@@ -52,6 +85,10 @@ func (p *Processor) ProcessFile(filePath, ext string) error {
 		err = p.ProcessPDF(filePath)
 	case stats.TypeDocument:
 		err = p.ProcessDocument(filePath, ext)
+	case stats.TypeAudio:
+		err = p.ProcessAudio(filePath, ext)
+	case stats.TypeVideo:
+		err = p.ProcessVideo(filePath, ext)
 	}
 
 	if err != nil {
@@ -74,7 +111,7 @@ func (p *Processor) getFileType(ext string) string {
 	ext = strings.ToLower(ext)
 
 	// Image file extensions
-	imageExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".tif", ".webp"}
+	imageExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".tif", ".dng", ".nef", ".cr2", ".arw", ".webp", ".heic", ".heif", ".avif", ".psd", ".psb", ".svg"}
 	for _, imgExt := range imageExtensions {
 		if ext == imgExt {
 			return stats.TypeImage
@@ -87,12 +124,53 @@ func (p *Processor) getFileType(ext string) string {
 	}
 
 	// Document file extensions
-	docExtensions := []string{".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt", ".ods", ".odp", ".rtf", ".txt"}
+	docExtensions := []string{".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".docm", ".dotx", ".dotm", ".xlsm", ".xltx", ".xltm", ".pptm", ".potx", ".potm", ".odt", ".ods", ".odp", ".rtf", ".txt"}
 	for _, docExt := range docExtensions {
 		if ext == docExt {
 			return stats.TypeDocument
 		}
 	}
 
+	// Audio file extensions
+	audioExtensions := []string{".mp3", ".flac", ".ogg", ".opus", ".m4a", ".wav"}
+	for _, audioExt := range audioExtensions {
+		if ext == audioExt {
+			return stats.TypeAudio
+		}
+	}
+
+	// Video file extensions
+	videoExtensions := []string{".mp4", ".mov", ".m4v", ".mkv", ".webm"}
+	for _, videoExt := range videoExtensions {
+		if ext == videoExt {
+			return stats.TypeVideo
+		}
+	}
+
 	return stats.TypeUnknown
 }
+
+// metadataExample trims a metadata value for use as a statistics example
+func metadataExample(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > maxExampleLength {
+		value = value[:maxExampleLength]
+	}
+	return value
+}
+
+// replaceFile writes cleaned content to a temp file and moves it over the original
+func replaceFile(filePath string, data []byte) error {
+	tempPath := filePath + ".temp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		os.Remove(tempPath) // Clean up temp file in case of error
+		return err
+	}
+
+	if err := os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath) // Clean up temp file in case of error
+		return err
+	}
+
+	return nil
+}
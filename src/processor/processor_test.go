@@ -1,6 +1,8 @@
 package processor
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -36,6 +38,16 @@ func setupProcessorTest(t *testing.T) (string, *logger.Logger, *Processor, func(
 	return tempDir, log, proc, cleanup
 }
 
+// runStrip runs a stream cleaner into a buffer and returns what it wrote
+func runStrip(t *testing.T, strip func(io.Writer) error) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := strip(&out); err != nil {
+		t.Fatalf("Cleaning failed: %v", err)
+	}
+	return out.Bytes()
+}
+
 func TestNewProcessor(t *testing.T) {
 	_, log, _, cleanup := setupProcessorTest(t)
 	defer cleanup()
@@ -67,6 +79,9 @@ func TestNewProcessor(t *testing.T) {
 			if proc.logger != log {
 				t.Error("Expected logger to be set correctly")
 			}
+			if proc.Policy != DefaultPolicy() {
+				t.Errorf("Expected default policy, got %+v", proc.Policy)
+			}
 		})
 	}
 }
@@ -90,6 +105,11 @@ func TestGetFileType(t *testing.T) {
 			ext:      ".png",
 			expected: stats.TypeImage,
 		},
+		{
+			name:     "SVG Image",
+			ext:      ".svg",
+			expected: stats.TypeImage,
+		},
 		{
 			name:     "PDF Document",
 			ext:      ".pdf",
@@ -105,11 +125,56 @@ func TestGetFileType(t *testing.T) {
 			ext:      ".xlsx",
 			expected: stats.TypeDocument,
 		},
+		{
+			name:     "Macro-Enabled Workbook",
+			ext:      ".xlsm",
+			expected: stats.TypeDocument,
+		},
+		{
+			name:     "PowerPoint Template",
+			ext:      ".potx",
+			expected: stats.TypeDocument,
+		},
 		{
 			name:     "Text Document",
 			ext:      ".txt",
 			expected: stats.TypeDocument,
 		},
+		{
+			name:     "MP3 Audio",
+			ext:      ".mp3",
+			expected: stats.TypeAudio,
+		},
+		{
+			name:     "FLAC Audio",
+			ext:      ".flac",
+			expected: stats.TypeAudio,
+		},
+		{
+			name:     "Opus Audio",
+			ext:      ".opus",
+			expected: stats.TypeAudio,
+		},
+		{
+			name:     "M4A Audio",
+			ext:      ".m4a",
+			expected: stats.TypeAudio,
+		},
+		{
+			name:     "WAV Audio",
+			ext:      ".wav",
+			expected: stats.TypeAudio,
+		},
+		{
+			name:     "MOV Video",
+			ext:      ".mov",
+			expected: stats.TypeVideo,
+		},
+		{
+			name:     "WebM Video",
+			ext:      ".webm",
+			expected: stats.TypeVideo,
+		},
 		{
 			name:     "Unsupported File Type",
 			ext:      ".xyz",
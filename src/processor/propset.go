@@ -0,0 +1,233 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"metadata-remover/src/stats"
+)
+
+// Property types that hold the values blanked in property sets
+const (
+	vtLPSTR    = 0x1E
+	vtLPWSTR   = 0x1F
+	vtFILETIME = 0x40
+)
+
+// Property identifiers with a special meaning
+const (
+	propertyCodePage = 1
+	propertyEditTime = 10 // A duration rather than a date
+)
+
+// codePageUnicode marks property sets whose narrow strings are UTF-16
+const codePageUnicode = 1200
+
+// filetimeUnixOffset is the number of seconds from the FILETIME epoch, 1601,
+// to the Unix epoch
+const filetimeUnixOffset = 11644473600
+
+// propertySetNames are the reported names of the blanked properties, by the
+// format ID of their property set in the byte order it is stored
+var propertySetNames = map[string]map[uint32]string{
+	// SummaryInformation {F29F85E0-4FF9-1068-AB91-08002B27B3D9}
+	"\xe0\x85\x9f\xf2\xf9\x4f\x68\x10\xab\x91\x08\x00\x2b\x27\xb3\xd9": {
+		2:  "Title",
+		4:  "Author",
+		7:  "Template",
+		8:  "Last modified by",
+		10: "Editing time",
+		11: "Print date",
+		12: "Creation date",
+		13: "Modification date",
+	},
+	// DocumentSummaryInformation {D5CDD502-2E9C-101B-9397-08002B2CF9AE}
+	"\x02\xd5\xcd\xd5\x9c\x2e\x1b\x10\x93\x97\x08\x00\x2b\x2c\xf9\xae": {
+		14: "Manager",
+		15: "Company",
+	},
+}
+
+// stripCompoundFile cleans a legacy Office document. The property set streams
+// of the document and of the objects embedded in it are blanked in place, and
+// the timestamps of its storages are cleared. Nothing moves in the file, so the
+// allocation tables and every other stream are kept as they are.
+func (p *Processor) stripCompoundFile(data []byte) ([]byte, error) {
+	out := append([]byte(nil), data...)
+	c, err := readCompoundFile(out)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range c.entries {
+		switch {
+		case e.typ == cfbStream && (e.name == "\x05SummaryInformation" || e.name == "\x05DocumentSummaryInformation"):
+			stream, err := c.readStream(e)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.cleanPropertySetStream(stream); err != nil {
+				return nil, err
+			}
+			if err := c.writeStream(e, stream); err != nil {
+				return nil, err
+			}
+		case e.typ == cfbStorage || e.typ == cfbRoot:
+			p.clearCFBTimes(out[e.offset+100 : e.offset+116])
+		}
+	}
+	return out, nil
+}
+
+// clearCFBTimes zeroes the creation and modification times of a storage
+func (p *Processor) clearCFBTimes(times []byte) {
+	for i := 0; i < len(times); i += 8 {
+		if ft := binary.LittleEndian.Uint64(times[i:]); ft != 0 {
+			p.Stats.AddMetadata(stats.TypeDocument, "Storage timestamp", filetimeExample(ft, false))
+			copy(times[i:i+8], make([]byte, 8))
+		}
+	}
+}
+
+// cleanPropertySetStream blanks the properties of a property set stream that
+// name people and files or tell when the document was worked on. Values are
+// overwritten with zeros, so strings read as empty and every offset stays valid.
+func (p *Processor) cleanPropertySetStream(data []byte) error {
+	le := binary.LittleEndian
+	if len(data) < 28 || le.Uint16(data) != 0xFFFE {
+		return errors.New("invalid property set stream")
+	}
+	count := int(le.Uint32(data[24:]))
+	for i := 0; i < count; i++ {
+		header := 28 + 20*i
+		if header+20 > len(data) {
+			return errors.New("truncated property set stream")
+		}
+		names := propertySetNames[string(data[header:header+16])]
+		if names == nil {
+			continue
+		}
+		if err := p.cleanPropertySet(data, int(le.Uint32(data[header+16:])), names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanPropertySet blanks the named properties of the property set at offset
+func (p *Processor) cleanPropertySet(data []byte, offset int, names map[uint32]string) error {
+	le := binary.LittleEndian
+	if offset < 0 || offset+8 > len(data) {
+		return errors.New("invalid property set offset")
+	}
+	size := int(le.Uint32(data[offset:]))
+	if size < 8 || size > len(data)-offset {
+		return errors.New("invalid property set size")
+	}
+	set := data[offset : offset+size]
+	count := int(le.Uint32(set[4:]))
+	if count > (size-8)/8 {
+		return errors.New("truncated property set")
+	}
+
+	value := func(i int) []byte {
+		if start := int(le.Uint32(set[12+8*i:])); start >= 8 && start+4 <= size {
+			return set[start:]
+		}
+		return nil
+	}
+	codePage := 0
+	for i := 0; i < count; i++ {
+		if v := value(i); le.Uint32(set[8+8*i:]) == propertyCodePage && len(v) >= 6 {
+			codePage = int(le.Uint16(v[4:]))
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		id := le.Uint32(set[8+8*i:])
+		name, ok := names[id]
+		v := value(i)
+		if !ok || v == nil {
+			continue
+		}
+
+		var field []byte
+		example := ""
+		switch le.Uint16(v) {
+		case vtLPSTR, vtLPWSTR:
+			if len(v) < 8 {
+				continue
+			}
+			// Narrow strings are counted in bytes and wide strings in characters
+			n := int(le.Uint32(v[4:]))
+			wide := le.Uint16(v) == vtLPWSTR
+			if wide {
+				n *= 2
+			}
+			if n > len(v)-8 {
+				return errors.New("truncated property value")
+			}
+			field = v[8 : 8+n]
+			example = propertyString(field, wide || codePage == codePageUnicode)
+		case vtFILETIME:
+			if len(v) < 12 {
+				continue
+			}
+			field = v[4:12]
+			if ft := le.Uint64(field); ft != 0 {
+				example = filetimeExample(ft, id == propertyEditTime)
+			}
+		default:
+			continue
+		}
+
+		if strings.Trim(string(field), "\x00") != "" {
+			p.Stats.AddMetadata(stats.TypeDocument, name, metadataExample(example))
+			copy(field, make([]byte, len(field)))
+		}
+	}
+	return nil
+}
+
+// propertyString decodes a string property up to its terminator. Narrow
+// strings are read as Latin-1, which matches the Windows code pages in ASCII.
+func propertyString(data []byte, wide bool) string {
+	if !wide {
+		runes := make([]rune, 0, len(data))
+		for _, b := range data {
+			if b == 0 {
+				break
+			}
+			runes = append(runes, rune(b))
+		}
+		return string(runes)
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		u := binary.LittleEndian.Uint16(data[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// filetimeExample formats a FILETIME, counted in 100-nanosecond intervals
+func filetimeExample(ft uint64, duration bool) string {
+	if duration {
+		if ft > math.MaxInt64/100 {
+			return ""
+		}
+		return time.Duration(ft * 100).String()
+	}
+	seconds := ft / 10000000
+	if seconds < filetimeUnixOffset {
+		return ""
+	}
+	return time.Unix(int64(seconds-filetimeUnixOffset), 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	testSummaryFMTID         = "\xe0\x85\x9f\xf2\xf9\x4f\x68\x10\xab\x91\x08\x00\x2b\x27\xb3\xd9"
+	testDocumentSummaryFMTID = "\x02\xd5\xcd\xd5\x9c\x2e\x1b\x10\x93\x97\x08\x00\x2b\x2c\xf9\xae"
+)
+
+// testProperty is a property of a test property set, with its typed value
+type testProperty struct {
+	id    uint32
+	value []byte
+}
+
+// testPropertyValue encodes a typed property value, padded to 4 bytes
+func testPropertyValue(typ uint16, value interface{}) []byte {
+	le := binary.LittleEndian
+	out := make([]byte, 4)
+	le.PutUint16(out, typ)
+	switch v := value.(type) {
+	case string:
+		if typ == vtLPWSTR {
+			units := append(utf16.Encode([]rune(v)), 0)
+			out = le.AppendUint32(out, uint32(len(units)))
+			for _, u := range units {
+				out = le.AppendUint16(out, u)
+			}
+		} else {
+			out = le.AppendUint32(out, uint32(len(v)+1))
+			out = append(append(out, v...), 0)
+		}
+	case uint64:
+		out = le.AppendUint64(out, v)
+	case uint32:
+		out = le.AppendUint32(out, v)
+	case uint16:
+		out = le.AppendUint16(out, v)
+	}
+	return append(out, make([]byte, (4-len(out)%4)%4)...)
+}
+
+// buildTestPropertySet builds a property set stream with one property set,
+// padded to size
+func buildTestPropertySet(fmtid string, size int, props ...testProperty) []byte {
+	le := binary.LittleEndian
+	stream := make([]byte, 28)
+	le.PutUint16(stream, 0xFFFE)
+	le.PutUint32(stream[4:], 0x00020006)
+	le.PutUint32(stream[24:], 1)
+	stream = append(stream, fmtid...)
+	stream = le.AppendUint32(stream, 48)
+
+	set := make([]byte, 8+8*len(props))
+	le.PutUint32(set[4:], uint32(len(props)))
+	for i, prop := range props {
+		le.PutUint32(set[8+8*i:], prop.id)
+		le.PutUint32(set[12+8*i:], uint32(len(set)))
+		set = append(set, prop.value...)
+	}
+	le.PutUint32(set, uint32(len(set)))
+	stream = append(stream, set...)
+	return append(stream, make([]byte, size-len(stream))...)
+}
+
+// buildTestDOC builds a Word 97 document whose property sets name people,
+// files and dates. The summary information fills whole sectors, as Word writes
+// it, and the document summary information sits in the mini stream.
+func buildTestDOC(t *testing.T) []byte {
+	summary := buildTestPropertySet(testSummaryFMTID, 4096,
+		testProperty{1, testPropertyValue(0x02, uint16(1252))},
+		testProperty{2, testPropertyValue(vtLPSTR, "Q3 Budget")},
+		testProperty{3, testPropertyValue(vtLPSTR, "Finance")},
+		testProperty{4, testPropertyValue(vtLPSTR, "Jane Doe")},
+		testProperty{7, testPropertyValue(vtLPSTR, "Normal.dotm")},
+		testProperty{8, testPropertyValue(vtLPSTR, "John Roe")},
+		testProperty{10, testPropertyValue(vtFILETIME, uint64(36000000000))},
+		testProperty{12, testPropertyValue(vtFILETIME, uint64(133537248000000000))},
+		testProperty{14, testPropertyValue(0x03, uint32(3))},
+	)
+	documentSummary := buildTestPropertySet(testDocumentSummaryFMTID, 256,
+		testProperty{1, testPropertyValue(0x02, uint16(1252))},
+		testProperty{2, testPropertyValue(vtLPSTR, "Reports")},
+		testProperty{14, testPropertyValue(vtLPWSTR, "Mary Major")},
+		testProperty{15, testPropertyValue(vtLPSTR, "Acme Corp")},
+	)
+	return buildTestCFB(t,
+		testCFBStream{"\x05SummaryInformation", summary},
+		testCFBStream{"\x05DocumentSummaryInformation", documentSummary},
+		testCFBStream{"WordDocument", bytes.Repeat([]byte("Salary is 95000. "), 300)},
+	)
+}
+
+func TestStripCompoundFile(t *testing.T) {
+	input := buildTestDOC(t)
+	proc := NewProcessor(nil, false)
+	output, err := proc.stripCompoundFile(input)
+	if err != nil {
+		t.Fatalf("stripCompoundFile failed: %v", err)
+	}
+
+	if len(output) != len(input) || !bytes.Equal(output[:1024], input[:1024]) || !bytes.Equal(output[1536:2048], input[1536:2048]) {
+		t.Error("Header, FAT or mini FAT changed")
+	}
+	for _, leak := range []string{"Q3 Budget", "Jane Doe", "Normal.dotm", "John Roe", "Acme Corp", "M\x00a\x00r\x00y"} {
+		if bytes.Contains(output, []byte(leak)) {
+			t.Errorf("Output still contains %q", leak)
+		}
+	}
+
+	c, err := readCompoundFile(output)
+	if err != nil {
+		t.Fatalf("Cleaned file cannot be read: %v", err)
+	}
+	summary, _ := c.readStream(c.entries[1])
+	documentSummary, _ := c.readStream(c.entries[2])
+	document, _ := c.readStream(c.entries[3])
+	if !bytes.Contains(summary, []byte("Finance")) || !bytes.Contains(documentSummary, []byte("Reports")) || !strings.HasPrefix(string(document), "Salary is 95000.") {
+		t.Error("Content outside the blanked properties was lost")
+	}
+	created := binary.LittleEndian.AppendUint64(nil, 133537248000000000)
+	if bytes.Contains(summary, created) || binary.LittleEndian.Uint64(output[1024+108:]) != 0 {
+		t.Error("Timestamps were not cleared")
+	}
+
+	for field, example := range map[string]string{
+		"Title":             "Q3 Budget",
+		"Author":            "Jane Doe",
+		"Template":          "Normal.dotm",
+		"Last modified by":  "John Roe",
+		"Editing time":      "1h0m0s",
+		"Creation date":     "2024-03-01T00:00:00Z",
+		"Manager":           "Mary Major",
+		"Company":           "Acme Corp",
+		"Storage timestamp": "2024-03-01T00:00:00Z",
+	} {
+		if got := proc.Stats.ByMetadataType[field]; got == nil || got.Examples[0] != example {
+			t.Errorf("%s was not reported as %q", field, example)
+		}
+	}
+	if proc.Stats.ByMetadataType["Subject"] != nil {
+		t.Error("Subject was reported but kept")
+	}
+
+	if _, err := proc.stripCompoundFile(input[:600]); err == nil {
+		t.Error("Expected error for a truncated file")
+	}
+	broken := buildTestCFB(t, testCFBStream{"\x05SummaryInformation", []byte("not a property set")})
+	if _, err := proc.stripCompoundFile(broken); err == nil {
+		t.Error("Expected error for an invalid property set")
+	}
+}
+
+func TestCleanBinaryOffice(t *testing.T) {
+	tempDir, proc, cleanup := setupDocumentTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "budget.doc")
+	if err := os.WriteFile(filePath, buildTestDOC(t), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := proc.ProcessDocument(filePath, ".doc"); err != nil {
+		t.Fatalf("Failed to clean DOC: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("Jane Doe")) {
+		t.Error("DOC was not cleaned")
+	}
+}
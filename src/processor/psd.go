@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"metadata-remover/src/stats"
+)
+
+// Photoshop image resource IDs handled by policy
+const (
+	psdResourceResolution = 0x03ED
+	psdResourceICCProfile = 0x040F
+)
+
+// psdMetadataResources names the image resources that are always removed
+var psdMetadataResources = map[uint16]string{
+	0x03F0: "Caption",
+	0x0404: "IPTC",
+	0x040B: "URL",
+	0x041E: "URL list",
+	0x0422: "EXIF",
+	0x0423: "EXIF",
+	0x0424: "XMP",
+	0x0425: "Caption digest",
+	0x043A: "Print information",
+}
+
+// psdResourceSignatures are the signatures image resource blocks may start with
+var psdResourceSignatures = map[string]bool{
+	"8BIM": true,
+	"MeSa": true,
+	"PHUT": true,
+	"AgHg": true,
+	"DCSR": true,
+}
+
+// psdMaxResources caps the size of the image resources section held in memory
+const psdMaxResources = 256 << 20
+
+// cleanPSD removes metadata from Photoshop PSD and PSB files
+func (p *Processor) cleanPSD(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripPSD(bufio.NewReader(file), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripPSD rewrites the image resources section without metadata blocks. The header,
+// color mode data, layers and composite image data are copied unchanged.
+func (p *Processor) stripPSD(r io.Reader, w io.Writer) error {
+	// Read file header
+	header := make([]byte, 26)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != "8BPS" {
+		return errors.New("not a valid PSD file")
+	}
+	if version := binary.BigEndian.Uint16(header[4:]); version != 1 && version != 2 {
+		return fmt.Errorf("unsupported PSD version %d", version)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	// Color mode data section
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return errors.New("truncated PSD color mode data")
+	}
+	if _, err := w.Write(length); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(length))); err != nil {
+		return errors.New("truncated PSD color mode data")
+	}
+
+	// Image resources section
+	if _, err := io.ReadFull(r, length); err != nil {
+		return errors.New("truncated PSD image resources")
+	}
+	size := int64(binary.BigEndian.Uint32(length))
+	if size > psdMaxResources {
+		return errors.New("PSD image resources section too large")
+	}
+	var resources bytes.Buffer
+	if _, err := io.CopyN(&resources, r, size); err != nil {
+		return errors.New("truncated PSD image resources")
+	}
+
+	cleaned, err := p.filterPSDResources(resources.Bytes())
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(length, uint32(len(cleaned)))
+	if _, err := w.Write(length); err != nil {
+		return err
+	}
+	if _, err := w.Write(cleaned); err != nil {
+		return err
+	}
+
+	// Layer and mask information and image data follow unchanged
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// filterPSDResources returns the resource blocks that are kept
+func (p *Processor) filterPSDResources(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	for pos := 0; pos < len(data); {
+		start := pos
+
+		// Signature, ID and the length byte of the Pascal string name
+		if len(data)-pos < 7 {
+			return nil, errors.New("truncated PSD image resource")
+		}
+		if !psdResourceSignatures[string(data[pos:pos+4])] {
+			return nil, fmt.Errorf("invalid PSD image resource signature %q", data[pos:pos+4])
+		}
+		id := binary.BigEndian.Uint16(data[pos+4:])
+
+		// The name, including its length byte, is padded to an even size
+		nameSize := 1 + int(data[pos+6])
+		nameSize += nameSize % 2
+		pos += 6 + nameSize
+		if len(data)-pos < 4 {
+			return nil, fmt.Errorf("truncated PSD image resource 0x%04X", id)
+		}
+
+		// The data is padded to an even size as well
+		size := int64(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+		if size > int64(len(data)-pos) {
+			return nil, fmt.Errorf("truncated PSD image resource 0x%04X", id)
+		}
+		payload := data[pos : pos+int(size)]
+		pos += int(size + size%2)
+		if pos > len(data) {
+			pos = len(data)
+		}
+
+		if p.keepPSDResource(id, payload) {
+			out = append(out, data[start:pos]...)
+			if (pos-start)%2 != 0 {
+				out = append(out, 0)
+			}
+		}
+	}
+	return out, nil
+}
+
+// keepPSDResource decides whether an image resource is copied, reporting the ones removed
+func (p *Processor) keepPSDResource(id uint16, payload []byte) bool {
+	switch id {
+	case psdResourceICCProfile:
+		if p.Policy.KeepICCProfile {
+			return true
+		}
+		p.Stats.AddMetadata(stats.TypeImage, "ICC Profile", "")
+		return false
+	case psdResourceResolution:
+		if p.Policy.KeepResolution {
+			return true
+		}
+		p.Stats.AddMetadata(stats.TypeImage, "Resolution", "")
+		return false
+	}
+
+	name, ok := psdMetadataResources[id]
+	if !ok {
+		return true
+	}
+
+	example := ""
+	if id == 0x03F0 && len(payload) > 0 {
+		// The caption is a Pascal string
+		if n := int(payload[0]); n < len(payload) {
+			example = string(payload[1 : 1+n])
+		}
+	}
+	p.Stats.AddMetadata(stats.TypeImage, name, example)
+	return false
+}
@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPSDResource builds an image resource block with an empty name
+func testPSDResource(id uint16, data []byte) []byte {
+	block := []byte("8BIM")
+	block = binary.BigEndian.AppendUint16(block, id)
+	block = append(block, 0, 0) // Empty Pascal string padded to even size
+	block = binary.BigEndian.AppendUint32(block, uint32(len(data)))
+	block = append(block, data...)
+	if len(data)%2 != 0 {
+		block = append(block, 0)
+	}
+	return block
+}
+
+// testPSDTail is the layer section and composite image data of the test files
+var testPSDTail = []byte{
+	0, 0, 0, 0, // Empty layer and mask information
+	0, 0, // Raw image data
+	0x10, 0x20, 0x30, 0x40,
+}
+
+// buildTestPSD creates a 2x2 grayscale PSD with the given image resources
+func buildTestPSD(resources ...[]byte) []byte {
+	header := []byte("8BPS")
+	header = binary.BigEndian.AppendUint16(header, 1)
+	header = append(header, 0, 0, 0, 0, 0, 0)
+	header = binary.BigEndian.AppendUint16(header, 1) // Channels
+	header = binary.BigEndian.AppendUint32(header, 2) // Height
+	header = binary.BigEndian.AppendUint32(header, 2) // Width
+	header = binary.BigEndian.AppendUint16(header, 8) // Depth
+	header = binary.BigEndian.AppendUint16(header, 1) // Grayscale
+
+	section := bytes.Join(resources, nil)
+	out := append(header, 0, 0, 0, 0) // Empty color mode data
+	out = binary.BigEndian.AppendUint32(out, uint32(len(section)))
+	out = append(out, section...)
+	return append(out, testPSDTail...)
+}
+
+func TestStripPSD(t *testing.T) {
+	resolution := testPSDResource(0x03ED, make([]byte, 16))
+	icc := testPSDResource(0x040F, []byte("profile"))
+	versionInfo := testPSDResource(0x0421, []byte{0, 0, 0, 1, 1})
+	caption := testPSDResource(0x03F0, []byte("\x08Jane Doe"))
+	iptc := testPSDResource(0x0404, []byte("\x1C\x02\x50\x00\x08Jane Doe"))
+	exif := testPSDResource(0x0422, []byte("MM\x00\x2A serial"))
+	xmp := testPSDResource(0x0424, []byte("<x:xmpmeta/>"))
+	digest := testPSDResource(0x0425, make([]byte, 16))
+
+	t.Run("Metadata resources removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestPSD(resolution, caption, iptc, icc, exif, versionInfo, xmp, digest)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPSD(bytes.NewReader(input), w)
+		})
+
+		expected := buildTestPSD(resolution, icc, versionInfo)
+		if !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+
+		if field := proc.Stats.ByMetadataType["Caption"]; field == nil || field.Examples[0] != "Jane Doe" {
+			t.Error("Caption was not reported with its value")
+		}
+		for _, name := range []string{"IPTC", "EXIF", "XMP", "Caption digest"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("Optional resources follow policy", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepICCProfile = false
+		proc.Policy.KeepResolution = false
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPSD(bytes.NewReader(buildTestPSD(resolution, icc, versionInfo)), w)
+		})
+		if !bytes.Equal(output, buildTestPSD(versionInfo)) {
+			t.Error("ICC profile and resolution should be removed by policy")
+		}
+	})
+
+	t.Run("Named and odd-sized resources", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		named := []byte("8BIM\x0B\xB7\x03abc\x00\x00\x00\x03xyz\x00")
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripPSD(bytes.NewReader(buildTestPSD(named, xmp)), w)
+		})
+		if !bytes.Equal(output, buildTestPSD(named)) {
+			t.Error("Resource padding was not handled")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		clean := buildTestPSD(resolution)
+
+		badVersion := append([]byte{}, clean...)
+		badVersion[5] = 3
+		badSignature := append([]byte{}, clean...)
+		copy(badSignature[34:], "XXXX")
+
+		invalid := [][]byte{
+			[]byte("not a psd"),
+			badVersion,
+			badSignature,
+			clean[:40],
+		}
+		for i, data := range invalid {
+			if err := proc.stripPSD(bytes.NewReader(data), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanPSD(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "layout.psd")
+	input := buildTestPSD(testPSDResource(0x0404, []byte("\x1C\x02\x50\x00\x0BAgency Name")))
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".psd"); err != nil {
+		t.Fatalf("Failed to clean PSD: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("Agency Name")) {
+		t.Error("IPTC resource still present after cleaning")
+	}
+	if !bytes.HasSuffix(data, testPSDTail) {
+		t.Error("Image data changed")
+	}
+}
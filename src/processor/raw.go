@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+
+	"metadata-remover/src/stats"
+)
+
+// Camera raw formats (DNG, NEF, CR2, ARW) are TIFF structured, so they go through
+// stripTIFF with a wider allowlist. Make and Model stay because raw decoders pick
+// their color matrices and decoding quirks from them; serial numbers, owner names,
+// timestamps, GPS, MakerNotes and DNGPrivateData are removed.
+//
+// Two vendor structures are needed to decode the image and survive in part.
+// Compressed NEF files keep their Nikon MakerNote, cut down to the entries that
+// describe the compression and levels. ARW files keep the SR2Private IFD their
+// DNGPrivateData tag points at, whose encrypted block holds the black and white
+// balance levels and is written back at its original offset.
+
+// Raw file tags handled apart from the allowlists
+const (
+	tiffTagMakerNote      = 37500
+	tiffTagDNGPrivateData = 50740
+)
+
+// nikonMakerNoteHeader starts the Nikon MakerNotes with an embedded TIFF header,
+// which follows 10 bytes in; offsets inside the MakerNote are relative to it
+var nikonMakerNoteHeader = []byte("Nikon\x00")
+
+// rawTIFFRules keeps the baseline tags plus everything needed to develop a raw image
+var rawTIFFRules = &tiffRules{
+	image: tiffTagUnion(baselineTIFFRules.image, tiffTagSet(
+		271, 272, // Make and Model
+		33421, 33422, 37399, // TIFF/EP CFA pattern and sensing method
+		50706, 50707, 50708, 50710, 50711, 50712, 50713, 50714, 50715, 50716, 50717, // DNG version, CFA, linearization, levels
+		50718, 50719, 50720, 50721, 50722, 50723, 50724, 50725, 50726, 50727, 50728, 50729, // Scale, crop, color matrices, white balance
+		50730, 50731, 50732, 50733, 50734, 50736, 50737, 50738, 50739, // Exposure, noise, sharpness, lens info
+		50778, 50779, 50780, 50829, 50830, 50831, 50832, 50833, 50834, 50879, // Illuminants, active and masked areas, profiles
+		50931, 50932, 50934, 50935, 50936, 50937, 50938, 50939, 50940, 50941, // Camera profile
+		50964, 50965, 50970, 50972, 50974, 50975, 50981, 50982, // Forward matrices, digests, tiling, look table
+		51008, 51009, 51022, 51041, 51089, 51090, 51091, // Opcode lists, noise profile, original sizes
+		51107, 51108, 51109, 51110, 51111, 51112, 51125, // Encodings, black render, raw digest, user crop
+		52525, 52526, 52528, 52529, 52530, 52531, 52532, 52533, 52534, 52535, 52543, 52544, // DNG 1.6 and 1.7
+		50752, 28672, 28673, 28688, // Canon CR2 slice layout, Sony raw type and tone curve
+		28721, 28722, 28724, 28725, 28726, 28727, 28728, 29456, 29459, 29895, 29896, // Sony lens corrections, levels and crop
+	)),
+	exif: tiffTagUnion(baselineTIFFRules.exif, tiffTagSet(
+		33434, 33437, 34850, 34855, 34864, // Exposure time, f-number, program, ISO
+		37377, 37378, 37380, 37381, 37383, 37384, 37385, 37386, // APEX values, metering, light source, flash, focal length
+		41486, 41487, 41488, 41495, 41728, 41729, 41730, // Focal plane resolution, sensing method, CFA pattern
+		41985, 41986, 41987, 41988, 41989, 41990, // Rendering, exposure mode, white balance, zoom, scene type
+	)),
+	interop: baselineTIFFRules.interop,
+	makerNote: tiffTagSet(
+		1, 12, 61, // MakerNote version, white balance and black levels
+		147, 150, // NEF compression and linearization table
+	),
+	private: tiffTagSet(29184, 29185, 29217), // SR2SubIFD offset, length and key
+}
+
+// nikonMakerNote rebuilds a Nikon MakerNote with only the entries kept by the
+// rules. It returns nil for other MakerNotes and for ones left empty.
+func (r *tiffReader) nikonMakerNote(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, nikonMakerNoteHeader) || len(value) < 10 {
+		return nil, nil
+	}
+	embedded := value[10:]
+	order, err := tiffByteOrder(embedded)
+	if err != nil {
+		return nil, nil
+	}
+
+	// The removed entries are reported once, as the MakerNote
+	nr := &tiffReader{
+		data:    embedded,
+		order:   order,
+		rules:   &tiffRules{},
+		visited: make(map[uint32]bool),
+		proc:    &Processor{Stats: stats.NewMetadataStats()},
+	}
+	ifd, _, err := nr.readIFD(order.Uint32(embedded[4:]), r.rules.makerNote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Nikon MakerNote: %v", err)
+	}
+	if len(ifd.entries) == 0 {
+		return nil, nil
+	}
+
+	w := &tiffWriter{order: order}
+	w.buf = append(w.buf, embedded[:4]...)
+	w.buf = append(w.buf, 0, 0, 0, 0)
+	offset := w.writeIFD(ifd)
+	order.PutUint32(w.buf[4:], offset)
+	return append(append([]byte(nil), value[:10]...), w.buf...), nil
+}
+
+// tiffTagUnion merges tag sets into a new set
+func tiffTagUnion(sets ...map[uint16]bool) map[uint16]bool {
+	union := make(map[uint16]bool)
+	for _, set := range sets {
+		for tag := range set {
+			union[tag] = true
+		}
+	}
+	return union
+}
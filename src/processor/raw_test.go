@@ -0,0 +1,373 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTestDNG creates a DNG with a preview in IFD0 and the raw CFA data in a SubIFD
+func buildTestDNG(raw []byte) []byte {
+	b := newTestTIFFBuilder(binary.LittleEndian)
+	preview := b.data([]byte{0x80, 0x80, 0x80})
+	strip := b.data(raw)
+
+	rawIFD := b.ifd([]testTIFFEntry{
+		{254, 4, 1, b.long(0)},
+		{256, 3, 1, b.short(2)},
+		{257, 3, 1, b.short(2)},
+		{258, 3, 1, b.short(8)},
+		{259, 3, 1, b.short(1)},
+		{262, 3, 1, b.short(32803)},
+		{273, 4, 1, b.long(strip)},
+		{277, 3, 1, b.short(1)},
+		{279, 4, 1, b.long(uint32(len(raw)))},
+		{33421, 3, 2, append(b.short(2), b.short(2)...)},
+		{33422, 1, 4, []byte{0, 1, 1, 2}},
+		{50714, 3, 1, b.short(64)},
+		{50717, 3, 1, b.short(255)},
+	})
+	exif := b.ifd([]testTIFFEntry{
+		{33434, 5, 1, append(b.long(1), b.long(250)...)},
+		{34855, 3, 1, b.short(400)},
+		{36867, 2, 20, []byte("2023:06:01 08:30:00\x00")},
+		{37500, 7, 12, []byte("Nikon\x00SERIAL")},
+		{42033, 2, 9, []byte("BODY1234\x00")},
+		{42037, 2, 9, []byte("LENS5678\x00")},
+	})
+	gps := b.ifd([]testTIFFEntry{
+		{1, 2, 2, []byte("N\x00")},
+	})
+	b.link(0, b.ifd([]testTIFFEntry{
+		{254, 4, 1, b.long(1)},
+		{256, 3, 1, b.short(1)},
+		{257, 3, 1, b.short(1)},
+		{258, 3, 1, b.short(8)},
+		{259, 3, 1, b.short(1)},
+		{262, 3, 1, b.short(2)},
+		{271, 2, 6, []byte("Nikon\x00")},
+		{272, 2, 6, []byte("Z 6II\x00")},
+		{273, 4, 1, b.long(preview)},
+		{277, 3, 1, b.short(3)},
+		{279, 4, 1, b.long(3)},
+		{305, 2, 10, []byte("Lightroom\x00")},
+		{tiffTagSubIFDs, 4, 1, b.long(rawIFD)},
+		{tiffTagExifIFD, 4, 1, b.long(exif)},
+		{tiffTagGPSIFD, 4, 1, b.long(gps)},
+		{50706, 1, 4, []byte{1, 4, 0, 0}},
+		{50708, 2, 12, []byte("Nikon Z 6II\x00")},
+		{50721, 10, 1, append(b.long(1), b.long(1)...)},
+		{50735, 2, 9, []byte("CAM98765\x00")},
+		{50740, 1, 8, []byte("Adobe\x00MN")},
+		{50827, 2, 14, []byte("DSC_0001.NEF\x00\x00")},
+	}))
+	return b.buf
+}
+
+// buildTestCR2 creates a CR2 with a preview page and a raw page whose offset is in the header
+func buildTestCR2(raw []byte) []byte {
+	b := newTestTIFFBuilder(binary.LittleEndian)
+	b.buf = append(b.buf, 'C', 'R', 2, 0, 0, 0, 0, 0)
+	preview := b.data([]byte{0xFF, 0xD8, 0xFF, 0xD9})
+	strip := b.data(raw)
+
+	ifd0 := b.ifd([]testTIFFEntry{
+		{256, 3, 1, b.short(1)},
+		{257, 3, 1, b.short(1)},
+		{259, 3, 1, b.short(6)},
+		{271, 2, 6, []byte("Canon\x00")},
+		{272, 2, 9, []byte("EOS 5D3\x00\x00")},
+		{273, 4, 1, b.long(preview)},
+		{279, 4, 1, b.long(4)},
+		{315, 2, 9, []byte("Jane Doe\x00")},
+	})
+	ifd1 := b.ifd([]testTIFFEntry{
+		{259, 3, 1, b.short(6)},
+		{273, 4, 1, b.long(strip)},
+		{279, 4, 1, b.long(uint32(len(raw)))},
+		{50752, 3, 3, append(append(b.short(1), b.short(2)...), b.short(2)...)},
+	})
+	b.link(0, ifd0)
+	b.link(ifd0, ifd1)
+	binary.LittleEndian.PutUint32(b.buf[12:], ifd1)
+	return b.buf
+}
+
+// buildTestNEF creates a compressed NEF whose Nikon MakerNote holds the
+// linearization table next to the serial number and shutter count
+func buildTestNEF(raw, curve []byte) []byte {
+	mn := newTestTIFFBuilder(binary.BigEndian)
+	mn.link(0, mn.ifd([]testTIFFEntry{
+		{1, 7, 4, []byte("0210")},
+		{29, 2, 10, []byte("SERIAL123\x00")},
+		{147, 3, 1, append(mn.short(3), 0, 0)},
+		{150, 7, uint32(len(curve)), curve},
+		{167, 4, 1, mn.long(4711)},
+	}))
+	makerNote := append([]byte("Nikon\x00\x02\x10\x00\x00"), mn.buf...)
+
+	b := newTestTIFFBuilder(binary.LittleEndian)
+	strip := b.data(raw)
+	rawIFD := b.ifd([]testTIFFEntry{
+		{259, 3, 1, b.short(34713)},
+		{262, 3, 1, b.short(32803)},
+		{273, 4, 1, b.long(strip)},
+		{279, 4, 1, b.long(uint32(len(raw)))},
+	})
+	exif := b.ifd([]testTIFFEntry{
+		{34855, 3, 1, b.short(100)},
+		{tiffTagMakerNote, 7, uint32(len(makerNote)), makerNote},
+	})
+	b.link(0, b.ifd([]testTIFFEntry{
+		{271, 2, 6, []byte("Nikon\x00")},
+		{tiffTagSubIFDs, 4, 1, b.long(rawIFD)},
+		{tiffTagExifIFD, 4, 1, b.long(exif)},
+	}))
+	return b.buf
+}
+
+// buildTestARW creates an ARW whose DNGPrivateData tag points at an SR2Private
+// IFD. The encrypted SR2SubIFD block sits behind an XMP packet that is removed.
+func buildTestARW(raw, sr2 []byte) ([]byte, uint32) {
+	b := newTestTIFFBuilder(binary.LittleEndian)
+	xmp := bytes.Repeat([]byte("<x:xmpmeta/>"), 20)
+	b.data(xmp)
+	block := b.data(sr2)
+	strip := b.data(raw)
+	private := b.ifd([]testTIFFEntry{
+		{29184, 4, 1, b.long(block)},
+		{29185, 4, 1, b.long(uint32(len(sr2)))},
+		{29217, 4, 1, b.long(0x12345678)},
+		{29248, 4, 1, b.long(0)},
+	})
+	b.link(0, b.ifd([]testTIFFEntry{
+		{259, 3, 1, b.short(32767)},
+		{271, 2, 5, []byte("SONY\x00")},
+		{273, 4, 1, b.long(strip)},
+		{279, 4, 1, b.long(uint32(len(raw)))},
+		{700, 1, uint32(len(xmp)), xmp},
+		{tiffTagDNGPrivateData, 4, 1, b.long(private)},
+	}))
+	return b.buf, block
+}
+
+func TestStripRawTIFF(t *testing.T) {
+	t.Run("DNG", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		raw := []byte{10, 20, 30, 40}
+		output, err := proc.stripTIFF(buildTestDNG(raw), rawTIFFRules)
+		if err != nil {
+			t.Fatalf("stripTIFF failed: %v", err)
+		}
+
+		pages, _ := readTestTIFFPages(t, output)
+		if len(pages) != 1 {
+			t.Fatalf("Expected 1 page, got %d", len(pages))
+		}
+		tags := pages[0]
+
+		for _, tag := range []uint16{305, tiffTagGPSIFD, 50735, 50740, 50827} {
+			if tags[tag] != nil {
+				t.Errorf("Tag %d was not removed", tag)
+			}
+		}
+		for _, tag := range []uint16{271, 272, 273, 50706, 50708, 50721} {
+			if tags[tag] == nil {
+				t.Errorf("Tag %d needed by raw decoders was removed", tag)
+			}
+		}
+
+		sub := tags[tiffTagSubIFDs]
+		if sub == nil || len(sub.ifds) != 1 {
+			t.Fatal("Raw SubIFD missing")
+		}
+		rawIFD := sub.ifds[0]
+		for _, tag := range []uint16{262, 33421, 33422, 50714, 50717} {
+			if rawIFD.find(tag) == nil {
+				t.Errorf("Raw IFD tag %d was removed", tag)
+			}
+		}
+		if strip := rawIFD.find(273); strip == nil || !bytes.Equal(bytes.Join(strip.blocks, nil), raw) {
+			t.Error("Raw image data changed")
+		}
+
+		exif := tags[tiffTagExifIFD]
+		if exif == nil || len(exif.ifds) != 1 {
+			t.Fatal("EXIF IFD missing")
+		}
+		for _, tag := range []uint16{36867, 37500, 42033, 42037} {
+			if exif.ifds[0].find(tag) != nil {
+				t.Errorf("EXIF tag %d was not removed", tag)
+			}
+		}
+		if exif.ifds[0].find(34855) == nil || exif.ifds[0].find(33434) == nil {
+			t.Error("Exposure settings were removed")
+		}
+
+		for _, leaked := range []string{"CAM98765", "BODY1234", "LENS5678", "SERIAL", "DSC_0001", "Lightroom"} {
+			if bytes.Contains(output, []byte(leaked)) {
+				t.Errorf("Output still contains %q", leaked)
+			}
+		}
+		for _, name := range []string{"CameraSerialNumber", "DNGPrivateData", "MakerNote", "OriginalRawFileName"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("NEF MakerNote", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		curve := []byte("linearization table and Huffman tree")
+		output, err := proc.stripTIFF(buildTestNEF([]byte{1, 2, 3}, curve), rawTIFFRules)
+		if err != nil {
+			t.Fatalf("stripTIFF failed: %v", err)
+		}
+
+		pages, _ := readTestTIFFPages(t, output)
+		exif := pages[0][tiffTagExifIFD]
+		if exif == nil || len(exif.ifds) != 1 {
+			t.Fatal("EXIF IFD missing")
+		}
+		mn := exif.ifds[0].find(tiffTagMakerNote)
+		if mn == nil || !bytes.HasPrefix(mn.value, []byte("Nikon\x00\x02\x10\x00\x00MM")) {
+			t.Fatal("Nikon MakerNote was removed")
+		}
+		embedded, _ := readTestTIFFPages(t, mn.value[10:])
+		if len(embedded) != 1 {
+			t.Fatalf("Expected 1 MakerNote IFD, got %d", len(embedded))
+		}
+		tags := embedded[0]
+		if tags[150] == nil || !bytes.Equal(tags[150].value, curve) || tags[147] == nil {
+			t.Error("NEF compression entries were not kept")
+		}
+		if tags[29] != nil || tags[167] != nil || bytes.Contains(output, []byte("SERIAL123")) {
+			t.Error("Serial number or shutter count still present")
+		}
+		if proc.Stats.ByMetadataType["MakerNote"] == nil {
+			t.Error("MakerNote was not reported in statistics")
+		}
+
+		broken := buildTestNEF([]byte{1, 2, 3}, curve)
+		pos := bytes.Index(broken, []byte("Nikon\x00\x02"))
+		binary.BigEndian.PutUint32(broken[pos+14:], 0xFFFF)
+		if _, err := proc.stripTIFF(broken, rawTIFFRules); err == nil {
+			t.Error("Expected error for a Nikon MakerNote with a dangling IFD offset")
+		}
+	})
+
+	t.Run("ARW SR2Private", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		raw := []byte{9, 8, 7, 6}
+		sr2 := []byte("encrypted levels pointing at absolute offsets")
+		input, block := buildTestARW(raw, sr2)
+		output, err := proc.stripTIFF(input, rawTIFFRules)
+		if err != nil {
+			t.Fatalf("stripTIFF failed: %v", err)
+		}
+
+		if int(block)+len(sr2) > len(output) || !bytes.Equal(output[block:int(block)+len(sr2)], sr2) {
+			t.Fatal("SR2SubIFD block was not kept at its offset")
+		}
+		pages, strips := readTestTIFFPages(t, output)
+		if pages[0][700] != nil || !bytes.Equal(strips[0], raw) {
+			t.Error("XMP was kept or raw data changed")
+		}
+		pointer := pages[0][tiffTagDNGPrivateData]
+		if pointer == nil {
+			t.Fatal("SR2Private pointer was removed")
+		}
+		r := &tiffReader{data: output, order: binary.LittleEndian, rules: rawTIFFRules, visited: make(map[uint32]bool), proc: proc}
+		private, _, err := r.readIFD(binary.LittleEndian.Uint32(pointer.value), rawTIFFRules.private)
+		if err != nil {
+			t.Fatalf("SR2Private IFD is invalid: %v", err)
+		}
+		for _, tag := range []uint16{29184, 29185, 29217} {
+			if private.find(tag) == nil {
+				t.Errorf("SR2Private tag %d was removed", tag)
+			}
+		}
+		if private.find(29248) != nil {
+			t.Error("SR2Private tag 29248 was not removed")
+		}
+		if offset := private.find(29184); offset != nil && binary.LittleEndian.Uint32(offset.value) != block {
+			t.Error("SR2SubIFD offset changed")
+		}
+
+		// A block overlapping the header cannot stay in place
+		pos := bytes.Index(input, append([]byte{0x00, 0x72, 4, 0, 1, 0, 0, 0}, byte(block), byte(block>>8)))
+		binary.LittleEndian.PutUint32(input[pos+8:], 4)
+		if _, err := proc.stripTIFF(input, rawTIFFRules); err == nil {
+			t.Error("Expected error for an SR2SubIFD block overlapping the header")
+		}
+	})
+
+	t.Run("CR2 raw IFD offset", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		raw := []byte{1, 3, 5, 7, 9, 11}
+		output, err := proc.stripTIFF(buildTestCR2(raw), rawTIFFRules)
+		if err != nil {
+			t.Fatalf("stripTIFF failed: %v", err)
+		}
+
+		if !bytes.Equal(output[8:12], []byte{'C', 'R', 2, 0}) {
+			t.Fatalf("CR2 header not preserved: %v", output[:16])
+		}
+		pages, strips := readTestTIFFPages(t, output)
+		if len(pages) != 2 {
+			t.Fatalf("Expected 2 pages, got %d", len(pages))
+		}
+
+		// The header must point at the raw page, which keeps its slice layout
+		rawOffset := binary.LittleEndian.Uint32(output[12:])
+		r := &tiffReader{data: output, order: binary.LittleEndian, rules: rawTIFFRules, visited: make(map[uint32]bool), proc: proc}
+		rawIFD, _, err := r.readIFD(rawOffset, rawTIFFRules.image)
+		if err != nil {
+			t.Fatalf("Header raw IFD offset is invalid: %v", err)
+		}
+		if rawIFD.find(50752) == nil || !bytes.Equal(strips[1], raw) {
+			t.Error("Raw IFD lost its slice layout or data")
+		}
+		if pages[0][271] == nil || pages[0][315] != nil {
+			t.Error("IFD0 tags were filtered incorrectly")
+		}
+	})
+
+	t.Run("CR2 raw IFD outside chain", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		data := buildTestCR2([]byte{1, 2})
+		binary.LittleEndian.PutUint32(data[12:], 0x1234)
+		if _, err := proc.stripTIFF(data, rawTIFFRules); err == nil {
+			t.Error("Expected error for dangling raw IFD offset")
+		}
+	})
+}
+
+func TestCleanRawTIFF(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	for _, ext := range []string{".dng", ".nef", ".cr2", ".arw"} {
+		filePath := filepath.Join(tempDir, "photo"+ext)
+		if err := os.WriteFile(filePath, buildTestDNG([]byte{1, 2, 3, 4}), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if err := proc.ProcessImage(filePath, ext); err != nil {
+			t.Fatalf("Failed to clean %s: %v", ext, err)
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to read cleaned file: %v", err)
+		}
+		if bytes.Contains(data, []byte("CAM98765")) {
+			t.Errorf("Camera serial number still present in %s", ext)
+		}
+		if !bytes.Contains(data, []byte("Nikon Z 6II")) {
+			t.Errorf("UniqueCameraModel removed from %s", ext)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+const svgNamespace = "http://www.w3.org/2000/svg"
+
+// svgEditorNamespaces are the namespaces of editor state and embedded metadata.
+// Renderers ignore elements and attributes in these namespaces.
+var svgEditorNamespaces = map[string]bool{
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd": true,
+	"http://www.inkscape.org/namespaces/inkscape":        true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":         true,
+	"http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/":  true,
+	"http://ns.adobe.com/Extensibility/1.0/":             true,
+	"http://ns.adobe.com/Flows/1.0/":                     true,
+	"http://ns.adobe.com/Graphs/1.0/":                    true,
+	"http://ns.adobe.com/ImageReplacement/1.0/":          true,
+	"http://ns.adobe.com/SaveForWeb/1.0/":                true,
+	"http://ns.adobe.com/Variables/1.0/":                 true,
+	"http://ns.adobe.com/xap/1.0/":                       true,
+	"http://www.bohemiancoding.com/sketch/ns":            true,
+	"http://www.serif.com/":                              true,
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#":        true,
+	"http://purl.org/dc/elements/1.1/":                   true,
+	"http://creativecommons.org/ns#":                     true,
+	"http://web.resource.org/cc/":                        true,
+	"adobe:ns:meta/":                                     true,
+}
+
+// svgEntityPattern matches general entity declarations in a DOCTYPE internal subset.
+// Illustrator declares its namespace URIs this way.
+var svgEntityPattern = regexp.MustCompile(`<!ENTITY\s+([A-Za-z_][\w.:-]*)\s+(?:"([^"]*)"|'([^']*)')`)
+
+// cleanSVG removes metadata from SVG files
+func (p *Processor) cleanSVG(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripSVG(file, writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripSVG copies an SVG document token by token, dropping metadata elements,
+// comments, XMP packets and anything in an editor namespace. Tokens that are kept
+// are copied byte for byte; a start tag is only rewritten when it loses attributes.
+func (p *Processor) stripSVG(r io.Reader, w io.Writer) error {
+	rec := &xmlRecorder{r: bufio.NewReader(r)}
+	d := xml.NewDecoder(rec)
+	d.Entity = make(map[string]string)
+
+	var scopes []map[string]string // Namespace prefixes declared by each open element
+	skip := 0                      // Depth inside a removed element
+	sawRoot := false
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid SVG file: %v", err)
+		}
+		raw, err := rec.take(d.InputOffset())
+		if err != nil {
+			return err
+		}
+
+		if skip > 0 {
+			switch tok.(type) {
+			case xml.StartElement:
+				skip++
+			case xml.EndElement:
+				skip--
+			}
+			continue
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(scopes) == 0 {
+				if sawRoot || t.Name.Local != "svg" {
+					return errors.New("not a valid SVG file")
+				}
+				sawRoot = true
+			}
+
+			scope := make(map[string]string)
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					scope[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					scope[""] = attr.Value
+				}
+			}
+			scopes = append(scopes, scope)
+
+			space := xmlResolvePrefix(scopes, t.Name.Space)
+			isMetadata := t.Name.Local == "metadata" && (space == svgNamespace || space == "")
+			if isMetadata || svgEditorNamespaces[space] {
+				if isMetadata {
+					p.Stats.AddMetadata(stats.TypeImage, "Metadata", "")
+				} else {
+					p.Stats.AddMetadata(stats.TypeImage, xmlQualifiedName(t.Name), "")
+				}
+				scopes = scopes[:len(scopes)-1]
+				skip = 1
+				continue
+			}
+
+			kept := t.Attr[:0:0]
+			for _, attr := range t.Attr {
+				if p.keepSVGAttribute(scopes, attr) {
+					kept = append(kept, attr)
+				}
+			}
+			if len(kept) == len(t.Attr) {
+				err = writeAll(w, raw)
+			} else {
+				err = writeXMLStartTag(w, t.Name, kept, strings.HasSuffix(string(raw), "/>"))
+			}
+
+		case xml.EndElement:
+			if len(scopes) == 0 {
+				return errors.New("unbalanced SVG end tag")
+			}
+			scopes = scopes[:len(scopes)-1]
+			err = writeAll(w, raw)
+
+		case xml.Comment:
+			p.Stats.AddMetadata(stats.TypeImage, "Comment", metadataExample(string(t)))
+
+		case xml.ProcInst:
+			if t.Target == "xpacket" {
+				p.Stats.AddMetadata(stats.TypeImage, "XMP", "")
+				continue
+			}
+			err = writeAll(w, raw)
+
+		case xml.Directive:
+			// Entities declared in the DOCTYPE are needed to resolve namespaces
+			for _, m := range svgEntityPattern.FindAllStringSubmatch("<!"+string(t)+">", -1) {
+				d.Entity[m[1]] = m[2] + m[3]
+			}
+			err = writeAll(w, raw)
+
+		default:
+			err = writeAll(w, raw)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !sawRoot {
+		return errors.New("not a valid SVG file")
+	}
+	if len(scopes) > 0 || skip > 0 {
+		return errors.New("truncated SVG file")
+	}
+	return nil
+}
+
+// keepSVGAttribute drops editor attributes and the declarations of editor namespaces
+func (p *Processor) keepSVGAttribute(scopes []map[string]string, attr xml.Attr) bool {
+	switch {
+	case attr.Name.Space == "xmlns":
+		return !svgEditorNamespaces[attr.Value]
+	case attr.Name.Space == "":
+		return true
+	case svgEditorNamespaces[xmlResolvePrefix(scopes, attr.Name.Space)]:
+		p.Stats.AddMetadata(stats.TypeImage, xmlQualifiedName(attr.Name), metadataExample(attr.Value))
+		return false
+	default:
+		return true
+	}
+}
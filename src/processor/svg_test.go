@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testInkscapeSVG is a trimmed Inkscape export
+const testInkscapeSVG = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!-- Created with Inkscape (http://www.inkscape.org/) -->
+
+<svg
+   width="100mm"
+   height="100mm"
+   viewBox="0 0 100 100"
+   version="1.1"
+   id="svg5"
+   inkscape:version="1.2.2 (b0a8486541, 2022-12-01)"
+   sodipodi:docname="/home/jane/clients/logo.svg"
+   inkscape:export-filename="/home/jane/clients/logo.png"
+   xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"
+   xmlns:sodipodi="http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd"
+   xmlns="http://www.w3.org/2000/svg"
+   xmlns:svg="http://www.w3.org/2000/svg"
+   xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+   xmlns:cc="http://creativecommons.org/ns#"
+   xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <sodipodi:namedview
+     id="namedview7"
+     pagecolor="#ffffff"
+     inkscape:zoom="0.7"><inkscape:grid type="xygrid" id="grid1"/></sodipodi:namedview>
+  <defs
+     id="defs2" />
+  <metadata id="metadata1"><rdf:RDF><cc:Work rdf:about=""><dc:creator><cc:Agent><dc:title>Jane Doe</dc:title></cc:Agent></dc:creator></cc:Work></rdf:RDF></metadata>
+  <g
+     inkscape:label="Layer 1"
+     inkscape:groupmode="layer"
+     id="layer1">
+    <path style="fill:#ff0000;stroke:none" d="M 10,10 H 90 V 90 H 10 Z" id="rect1" inkscape:label="Box &amp; &quot;frame&quot;"/>
+    <text x="20" y="50" id="text1"><tspan sodipodi:role="line" x="20" y="50">A</tspan> <tspan x="40" y="50">B</tspan></text>
+  </g>
+</svg>
+`
+
+// testIllustratorSVG is a trimmed Illustrator export that declares its namespaces as entities
+const testIllustratorSVG = `<?xml version="1.0" encoding="utf-8"?>
+<!-- Generator: Adobe Illustrator 27.0.0, SVG Export Plug-In . SVG Version: 6.00 Build 0)  -->
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd" [
+	<!ENTITY ns_extend "http://ns.adobe.com/Extensibility/1.0/">
+	<!ENTITY ns_ai "http://ns.adobe.com/AdobeIllustrator/10.0/">
+	<!ENTITY ns_pdf "http://ns.adobe.com/pdf/1.3/">
+]>
+<svg version="1.1" xmlns:x="&ns_extend;" xmlns:i="&ns_ai;" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10">
+<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<switch>
+	<foreignObject requiredExtensions="&ns_ai;" x="0" y="0" width="1" height="1">
+		<i:pgfRef xlink:href="#adobe_illustrator_pgf"></i:pgfRef>
+	</foreignObject>
+	<g i:extraneous="self">
+		<circle cx="5" cy="5" r="4"/>
+	</g>
+</switch>
+<i:pgf id="adobe_illustrator_pgf">PRIVATE-EDITING-DATA</i:pgf>
+</svg>`
+
+func TestStripSVG(t *testing.T) {
+	t.Run("Inkscape metadata removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		output := string(runStrip(t, func(w io.Writer) error {
+			return proc.stripSVG(strings.NewReader(testInkscapeSVG), w)
+		}))
+
+		for _, leaked := range []string{"Inkscape", "inkscape", "sodipodi", "/home/jane", "Jane Doe", "rdf:", "xmlns:dc", "<metadata"} {
+			if strings.Contains(output, leaked) {
+				t.Errorf("Output still contains %q", leaked)
+			}
+		}
+
+		// Drawing content is copied exactly
+		for _, kept := range []string{
+			`<?xml version="1.0" encoding="UTF-8" standalone="no"?>`,
+			`xmlns="http://www.w3.org/2000/svg"`,
+			`<path style="fill:#ff0000;stroke:none" d="M 10,10 H 90 V 90 H 10 Z" id="rect1"/>`,
+			`<tspan x="20" y="50">A</tspan> <tspan x="40" y="50">B</tspan>`,
+			"<defs\n     id=\"defs2\" />",
+		} {
+			if !strings.Contains(output, kept) {
+				t.Errorf("Output is missing %q", kept)
+			}
+		}
+
+		if err := xml.Unmarshal([]byte(output), new(struct{})); err != nil {
+			t.Errorf("Cleaned SVG is not valid XML: %v", err)
+		}
+
+		if field := proc.Stats.ByMetadataType["sodipodi:docname"]; field == nil || field.Examples[0] != "/home/jane/clients/logo.svg" {
+			t.Error("sodipodi:docname was not reported with its value")
+		}
+		for _, name := range []string{"Metadata", "Comment", "sodipodi:namedview", "inkscape:export-filename"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+	})
+
+	t.Run("Illustrator metadata removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		output := string(runStrip(t, func(w io.Writer) error {
+			return proc.stripSVG(strings.NewReader(testIllustratorSVG), w)
+		}))
+
+		for _, leaked := range []string{"Generator", "pgf", "PRIVATE-EDITING-DATA", "xpacket", "i:extraneous", `xmlns:i=`, `xmlns:x=`} {
+			if strings.Contains(output, leaked) {
+				t.Errorf("Output still contains %q", leaked)
+			}
+		}
+		for _, kept := range []string{`<circle cx="5" cy="5" r="4"/>`, `requiredExtensions="&ns_ai;"`, "<!DOCTYPE svg"} {
+			if !strings.Contains(output, kept) {
+				t.Errorf("Output is missing %q", kept)
+			}
+		}
+	})
+
+	t.Run("Clean file unchanged", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1"><rect width="1" height="1" fill="#000"/></svg>`
+
+		output := string(runStrip(t, func(w io.Writer) error {
+			return proc.stripSVG(strings.NewReader(input), w)
+		}))
+		if output != input {
+			t.Errorf("Clean SVG was modified: %q", output)
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := []string{
+			"",
+			"not xml at all",
+			`<html><body/></html>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><g>`,
+			`<svg><rect fill="&undefined;"/></svg>`,
+		}
+		for _, input := range invalid {
+			if err := proc.stripSVG(strings.NewReader(input), io.Discard); err == nil {
+				t.Errorf("Expected error for %q", input)
+			}
+		}
+	})
+}
+
+func TestCleanSVG(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "logo.svg")
+	if err := os.WriteFile(filePath, []byte(testInkscapeSVG), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".svg"); err != nil {
+		t.Fatalf("Failed to clean SVG: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("sodipodi:docname")) {
+		t.Error("Editor attributes still present after cleaning")
+	}
+}
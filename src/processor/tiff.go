@@ -0,0 +1,600 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// TIFF field types used when rewriting entries
+const (
+	tiffTypeASCII     = 2
+	tiffTypeShort     = 3
+	tiffTypeLong      = 4
+	tiffTypeUndefined = 7
+	tiffTypeIFD       = 13
+)
+
+// TIFF tags that point at other IFDs
+const (
+	tiffTagSubIFDs    = 330
+	tiffTagExifIFD    = 34665
+	tiffTagGPSIFD     = 34853
+	tiffTagInteropIFD = 40965
+	tiffTagICC        = 34675
+)
+
+// tiffTypeSizes maps TIFF field types to the size of one value in bytes
+var tiffTypeSizes = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	6:  1, // SBYTE
+	7:  1, // UNDEFINED
+	8:  2, // SSHORT
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+	11: 4, // FLOAT
+	12: 8, // DOUBLE
+	13: 4, // IFD
+}
+
+// tiffDataTags maps offset tags to the tag holding the byte counts of the blocks they point at
+var tiffDataTags = map[uint16]uint16{
+	273: 279, // StripOffsets / StripByteCounts
+	324: 325, // TileOffsets / TileByteCounts
+	513: 514, // JPEGInterchangeFormat / JPEGInterchangeFormatLength
+}
+
+// tiffPinnedTags maps offset tags to the tag holding the byte counts of blocks
+// that must stay at their offset, because data inside them points at absolute
+// file positions
+var tiffPinnedTags = map[uint16]uint16{
+	29184: 29185, // Sony SR2SubIFDOffset / SR2SubIFDLength
+}
+
+// tiffTagNames names the tags reported in statistics when they are removed
+var tiffTagNames = map[uint16]string{
+	269:           "DocumentName",
+	270:           "ImageDescription",
+	271:           "Make",
+	272:           "Model",
+	285:           "PageName",
+	305:           "Software",
+	306:           "DateTime",
+	315:           "Artist",
+	316:           "HostComputer",
+	700:           "XMP",
+	33432:         "Copyright",
+	33723:         "IPTC",
+	34377:         "Photoshop",
+	tiffTagGPSIFD: "GPS",
+	tiffTagICC:    "ICC Profile",
+	37724:         "ImageSourceData",
+	36867:         "DateTimeOriginal",
+	36868:         "DateTimeDigitized",
+	36880:         "OffsetTime",
+	36881:         "OffsetTimeOriginal",
+	36882:         "OffsetTimeDigitized",
+	37500:         "MakerNote",
+	37510:         "UserComment",
+	37520:         "SubSecTime",
+	37521:         "SubSecTimeOriginal",
+	37522:         "SubSecTimeDigitized",
+	42016:         "ImageUniqueID",
+	42032:         "CameraOwnerName",
+	42033:         "BodySerialNumber",
+	42034:         "LensSpecification",
+	42035:         "LensMake",
+	42036:         "LensModel",
+	42037:         "LensSerialNumber",
+	50709:         "LocalizedCameraModel",
+	50735:         "CameraSerialNumber",
+	50740:         "DNGPrivateData",
+	50741:         "MakerNoteSafety",
+	50781:         "RawDataUniqueID",
+	50827:         "OriginalRawFileName",
+	50828:         "OriginalRawFileData",
+	50942:         "ProfileCopyright",
+	50966:         "PreviewApplicationName",
+	50967:         "PreviewApplicationVersion",
+	50968:         "PreviewSettingsName",
+	50969:         "PreviewSettingsDigest",
+	50971:         "PreviewDateTime",
+	50973:         "OriginalRawFileDigest",
+}
+
+// tiffRules lists the tags kept in each kind of IFD; every other tag is removed
+type tiffRules struct {
+	image     map[uint16]bool // Main IFD chain and SubIFDs
+	exif      map[uint16]bool // EXIF sub-IFD
+	interop   map[uint16]bool // Interoperability sub-IFD
+	makerNote map[uint16]bool // Nikon MakerNote entries; other MakerNotes are removed whole
+	private   map[uint16]bool // Sony SR2Private IFD, which ARW files point at with DNGPrivateData
+}
+
+// baselineTIFFRules keeps the tags needed to decode baseline and extended TIFF images
+var baselineTIFFRules = &tiffRules{
+	image: tiffTagSet(
+		254, 255, 256, 257, 258, 259, 262, 263, 264, 265, 266, // Subfile type, dimensions, compression
+		273, 274, 277, 278, 279, 280, 281, 282, 283, 284, // Strips, orientation, samples, resolution
+		290, 291, 292, 293, 296, 297, 301, // Gray response, fax options, resolution unit, page number
+		317, 318, 319, 320, 321, 322, 323, 324, 325, // Predictor, chromaticities, color map, tiles
+		tiffTagSubIFDs, 332, 333, 334, 336, 338, 339, 340, 341, 342, // Inks, extra samples, sample format
+		347, 512, 513, 514, 515, 529, 530, 531, 532, // JPEG and YCbCr
+		tiffTagExifIFD, tiffTagICC, // EXIF pointer and ICC profile
+	),
+	exif: tiffTagSet(
+		36864, 37121, 40960, 40961, 40962, 40963, 42240, // Versions, color space, pixel dimensions, gamma
+		tiffTagInteropIFD,
+	),
+	interop: tiffTagSet(1, 2, 4097, 4098),
+}
+
+// tiffTagSet builds a lookup set from a list of tags
+func tiffTagSet(tags ...uint16) map[uint16]bool {
+	set := make(map[uint16]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return set
+}
+
+// tiffEntry is a single IFD entry with its value resolved
+type tiffEntry struct {
+	tag    uint16
+	typ    uint16
+	count  uint32
+	value  []byte     // Raw value bytes in the file's byte order
+	ifds   []*tiffIFD // Child IFDs for pointer tags
+	blocks [][]byte   // Image data referenced by offset tags
+}
+
+// tiffIFD is an image file directory
+type tiffIFD struct {
+	entries []*tiffEntry
+}
+
+// find returns the entry for a tag, or nil if the IFD doesn't have it
+func (ifd *tiffIFD) find(tag uint16) *tiffEntry {
+	for _, e := range ifd.entries {
+		if e.tag == tag {
+			return e
+		}
+	}
+	return nil
+}
+
+// uints decodes SHORT, LONG and IFD values
+func (e *tiffEntry) uints(order binary.ByteOrder) ([]uint32, error) {
+	values := make([]uint32, 0, e.count)
+	switch e.typ {
+	case tiffTypeShort:
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			values = append(values, uint32(order.Uint16(e.value[i:])))
+		}
+	case tiffTypeLong, tiffTypeIFD:
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			values = append(values, order.Uint32(e.value[i:]))
+		}
+	default:
+		return nil, fmt.Errorf("unexpected type %d for TIFF tag %d", e.typ, e.tag)
+	}
+	return values, nil
+}
+
+// cleanTIFF removes metadata from TIFF-structured files, keeping the tags allowed by rules
+func (p *Processor) cleanTIFF(filePath string, rules *tiffRules) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	cleaned, err := p.stripTIFF(data, rules)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(filePath, cleaned)
+}
+
+// tiffByteOrder validates the TIFF header and returns its byte order
+func tiffByteOrder(data []byte) (binary.ByteOrder, error) {
+	if len(data) < 8 {
+		return nil, errors.New("not a valid TIFF file")
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case data[0] == 'I' && data[1] == 'I':
+		order = binary.LittleEndian
+	case data[0] == 'M' && data[1] == 'M':
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a valid TIFF file")
+	}
+
+	switch order.Uint16(data[2:]) {
+	case 42:
+		return order, nil
+	case 43:
+		return nil, errors.New("BigTIFF files are not supported")
+	default:
+		return nil, errors.New("not a valid TIFF file")
+	}
+}
+
+// isCR2 reports whether a TIFF header carries the Canon CR2 extension, which
+// stores the offset of the raw image IFD at byte 12
+func isCR2(data []byte) bool {
+	return len(data) >= 16 && data[0] == 'I' && data[8] == 'C' && data[9] == 'R' &&
+		binary.LittleEndian.Uint32(data[4:]) >= 16
+}
+
+// stripTIFF rewrites a TIFF file keeping only the tags allowed by rules.
+// Every IFD in the main chain is kept, so multi-page files keep all their pages.
+func (p *Processor) stripTIFF(data []byte, rules *tiffRules) ([]byte, error) {
+	order, err := tiffByteOrder(data)
+	if err != nil {
+		return nil, err
+	}
+	cr2 := isCR2(data)
+
+	r := &tiffReader{
+		data:    data,
+		order:   order,
+		rules:   rules,
+		visited: make(map[uint32]bool),
+		proc:    p,
+	}
+
+	// Walk the main IFD chain
+	var pages []*tiffIFD
+	var pageOffsets []uint32
+	for offset := order.Uint32(data[4:]); offset != 0; {
+		ifd, next, err := r.readIFD(offset, rules.image)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, ifd)
+		pageOffsets = append(pageOffsets, offset)
+		offset = next
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("TIFF file contains no images")
+	}
+
+	// Write the header followed by each page, linking them in the original order
+	w := &tiffWriter{order: order, pinned: r.pinned}
+	w.buf = append(w.buf, data[:4]...)
+	w.buf = append(w.buf, 0, 0, 0, 0)
+	if cr2 {
+		w.buf = append(w.buf, data[8:12]...)
+		w.buf = append(w.buf, 0, 0, 0, 0)
+	}
+	sort.Slice(w.pinned, func(i, j int) bool {
+		return w.pinned[i].offset < w.pinned[j].offset
+	})
+	end := uint32(len(w.buf))
+	for _, pin := range w.pinned {
+		if pin.offset < end {
+			return nil, errors.New("TIFF data that cannot move overlaps other data")
+		}
+		end = pin.offset + uint32(len(pin.data))
+	}
+	link := 4
+	rawIFD := -1
+	for i, page := range pages {
+		offset := w.writeIFD(page)
+		order.PutUint32(w.buf[link:], offset)
+		link = int(offset) + 2 + 12*len(page.entries)
+
+		if cr2 && pageOffsets[i] == order.Uint32(data[12:]) {
+			order.PutUint32(w.buf[12:], offset)
+			rawIFD = i
+		}
+	}
+	if cr2 && rawIFD < 0 {
+		return nil, errors.New("CR2 raw IFD is not in the IFD chain")
+	}
+	w.flush()
+
+	if int64(len(w.buf)) > math.MaxUint32 {
+		return nil, errors.New("cleaned TIFF file exceeds 4 GB")
+	}
+
+	return w.buf, nil
+}
+
+// tiffReader parses IFDs from a TIFF file held in memory
+type tiffReader struct {
+	data    []byte
+	order   binary.ByteOrder
+	rules   *tiffRules
+	visited map[uint32]bool
+	proc    *Processor
+	pinned  []tiffPinned // Blocks found through tiffPinnedTags
+}
+
+// tiffPinned is a block of data written back at its original offset
+type tiffPinned struct {
+	offset uint32
+	data   []byte
+}
+
+// readIFD parses the IFD at offset, dropping tags not in keep, and returns the next IFD offset
+func (r *tiffReader) readIFD(offset uint32, keep map[uint16]bool) (*tiffIFD, uint32, error) {
+	if r.visited[offset] {
+		return nil, 0, errors.New("TIFF IFD loop detected")
+	}
+	r.visited[offset] = true
+
+	if int64(offset)+2 > int64(len(r.data)) {
+		return nil, 0, errors.New("TIFF IFD offset out of range")
+	}
+	count := int64(r.order.Uint16(r.data[offset:]))
+	end := int64(offset) + 2 + 12*count + 4
+	if end > int64(len(r.data)) {
+		return nil, 0, errors.New("truncated TIFF IFD")
+	}
+
+	ifd := &tiffIFD{}
+	for i := int64(0); i < count; i++ {
+		pos := int(int64(offset) + 2 + 12*i)
+		entry := &tiffEntry{
+			tag:   r.order.Uint16(r.data[pos:]),
+			typ:   r.order.Uint16(r.data[pos+2:]),
+			count: r.order.Uint32(r.data[pos+4:]),
+		}
+		value, err := r.value(pos, entry.typ, entry.count)
+
+		allowed := keep[entry.tag]
+		switch entry.tag {
+		case tiffTagICC:
+			allowed = allowed && r.proc.Policy.KeepICCProfile
+		case tiffTagDNGPrivateData:
+			if r.rules.private != nil && (entry.typ == tiffTypeLong || entry.typ == tiffTypeIFD) {
+				allowed = true
+			}
+		case tiffTagMakerNote:
+			if r.rules.makerNote != nil && entry.typ == tiffTypeUndefined && err == nil {
+				r.report(entry.tag, entry.typ, value)
+				if value, err = r.nikonMakerNote(value); err != nil {
+					return nil, 0, err
+				}
+				if value != nil {
+					entry.count = uint32(len(value))
+					entry.value = value
+					ifd.entries = append(ifd.entries, entry)
+				}
+				continue
+			}
+		}
+		if !allowed {
+			r.report(entry.tag, entry.typ, value)
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		entry.value = value
+		ifd.entries = append(ifd.entries, entry)
+	}
+
+	// Pointer and data tags are resolved once the whole entry list is known
+	kept := ifd.entries[:0]
+	for _, e := range ifd.entries {
+		var childRules map[uint16]bool
+		switch e.tag {
+		case tiffTagSubIFDs:
+			childRules = r.rules.image
+		case tiffTagExifIFD:
+			childRules = r.rules.exif
+		case tiffTagInteropIFD:
+			childRules = r.rules.interop
+		case tiffTagDNGPrivateData:
+			childRules = r.rules.private
+		}
+
+		if childRules != nil {
+			offsets, err := e.uints(r.order)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, childOffset := range offsets {
+				child, _, err := r.readIFD(childOffset, childRules)
+				if err != nil {
+					return nil, 0, err
+				}
+				e.ifds = append(e.ifds, child)
+			}
+			// Drop sub-IFDs left without any tags
+			if e.tag != tiffTagSubIFDs && len(e.ifds) == 1 && len(e.ifds[0].entries) == 0 {
+				continue
+			}
+		}
+
+		if countTag, ok := tiffDataTags[e.tag]; ok {
+			blocks, err := r.blocks(ifd, e, countTag)
+			if err != nil {
+				return nil, 0, err
+			}
+			e.blocks = blocks
+		}
+		if countTag, ok := tiffPinnedTags[e.tag]; ok {
+			blocks, err := r.blocks(ifd, e, countTag)
+			if err != nil {
+				return nil, 0, err
+			}
+			offsets, _ := e.uints(r.order)
+			for i, block := range blocks {
+				r.pinned = append(r.pinned, tiffPinned{offsets[i], block})
+			}
+		}
+
+		kept = append(kept, e)
+	}
+	ifd.entries = kept
+
+	return ifd, r.order.Uint32(r.data[end-4:]), nil
+}
+
+// value returns the raw value bytes of the entry at pos
+func (r *tiffReader) value(pos int, typ uint16, count uint32) ([]byte, error) {
+	size, ok := tiffTypeSizes[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown TIFF field type %d", typ)
+	}
+
+	length := int64(size) * int64(count)
+	if length <= 4 {
+		return r.data[pos+8 : pos+8+int(length)], nil
+	}
+
+	offset := int64(r.order.Uint32(r.data[pos+8:]))
+	if offset+length > int64(len(r.data)) {
+		return nil, errors.New("TIFF value out of range")
+	}
+	return r.data[offset : offset+length], nil
+}
+
+// blocks collects the image data blocks referenced by an offsets entry
+func (r *tiffReader) blocks(ifd *tiffIFD, e *tiffEntry, countTag uint16) ([][]byte, error) {
+	countEntry := ifd.find(countTag)
+	if countEntry == nil {
+		return nil, fmt.Errorf("TIFF tag %d has no byte counts", e.tag)
+	}
+
+	offsets, err := e.uints(r.order)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := countEntry.uints(r.order)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) != len(counts) {
+		return nil, fmt.Errorf("TIFF tag %d has %d offsets but %d byte counts", e.tag, len(offsets), len(counts))
+	}
+
+	blocks := make([][]byte, len(offsets))
+	for i, offset := range offsets {
+		end := int64(offset) + int64(counts[i])
+		if end > int64(len(r.data)) {
+			return nil, errors.New("TIFF image data out of range")
+		}
+		blocks[i] = r.data[offset:end]
+	}
+	return blocks, nil
+}
+
+// report records a removed tag in the processor statistics
+func (r *tiffReader) report(tag, typ uint16, value []byte) {
+	name, ok := tiffTagNames[tag]
+	if !ok {
+		name = fmt.Sprintf("TIFF tag %d", tag)
+	}
+
+	example := ""
+	if typ == tiffTypeASCII {
+		example = strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+	}
+
+	r.proc.Stats.AddMetadata(stats.TypeImage, name, example)
+}
+
+// tiffWriter serializes IFDs and their data into a new TIFF file
+type tiffWriter struct {
+	buf    []byte
+	order  binary.ByteOrder
+	pinned []tiffPinned // Sorted by offset, all past the header
+}
+
+// align pads the output to the word boundary TIFF requires for offsets
+func (w *tiffWriter) align() {
+	if len(w.buf)%2 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// alloc aligns the output for n more bytes and returns their offset. Pinned
+// blocks the bytes would run into are written first, at their own offsets.
+func (w *tiffWriter) alloc(n int) uint32 {
+	for len(w.pinned) > 0 && len(w.buf)+1+n > int(w.pinned[0].offset) {
+		w.place()
+	}
+	w.align()
+	return uint32(len(w.buf))
+}
+
+// place pads the output up to the next pinned block and writes it
+func (w *tiffWriter) place() {
+	pin := w.pinned[0]
+	w.pinned = w.pinned[1:]
+	w.buf = append(w.buf, make([]byte, int(pin.offset)-len(w.buf))...)
+	w.buf = append(w.buf, pin.data...)
+}
+
+// flush writes the pinned blocks the output has not reached yet
+func (w *tiffWriter) flush() {
+	for len(w.pinned) > 0 {
+		w.place()
+	}
+}
+
+// writeIFD appends an IFD with its values, data blocks and child IFDs and returns its offset.
+// The next IFD offset is left as zero for the caller to link.
+func (w *tiffWriter) writeIFD(ifd *tiffIFD) uint32 {
+	sort.Slice(ifd.entries, func(i, j int) bool {
+		return ifd.entries[i].tag < ifd.entries[j].tag
+	})
+
+	size := 2 + 12*len(ifd.entries) + 4
+	start := int(w.alloc(size))
+	w.buf = append(w.buf, make([]byte, size)...)
+	w.order.PutUint16(w.buf[start:], uint16(len(ifd.entries)))
+
+	for i, e := range ifd.entries {
+		typ, value := e.typ, e.value
+		switch {
+		case e.ifds != nil:
+			if typ != tiffTypeIFD {
+				typ = tiffTypeLong
+			}
+			value = make([]byte, 4*len(e.ifds))
+			for j, child := range e.ifds {
+				w.order.PutUint32(value[4*j:], w.writeIFD(child))
+			}
+		case e.blocks != nil:
+			typ = tiffTypeLong
+			value = make([]byte, 4*len(e.blocks))
+			for j, block := range e.blocks {
+				w.order.PutUint32(value[4*j:], w.alloc(len(block)))
+				w.buf = append(w.buf, block...)
+			}
+		}
+
+		pos := start + 2 + 12*i
+		w.order.PutUint16(w.buf[pos:], e.tag)
+		w.order.PutUint16(w.buf[pos+2:], typ)
+		w.order.PutUint32(w.buf[pos+4:], e.count)
+		if len(value) <= 4 {
+			copy(w.buf[pos+8:pos+12], value)
+		} else {
+			valueOffset := w.alloc(len(value))
+			w.order.PutUint32(w.buf[pos+8:], valueOffset)
+			w.buf = append(w.buf, value...)
+		}
+	}
+
+	return uint32(start)
+}
@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTIFFEntry describes an IFD entry for building test TIFF files
+type testTIFFEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// testTIFFBuilder assembles TIFF files entry by entry
+type testTIFFBuilder struct {
+	order binary.ByteOrder
+	buf   []byte
+}
+
+func newTestTIFFBuilder(order binary.ByteOrder) *testTIFFBuilder {
+	b := &testTIFFBuilder{order: order}
+	if order == binary.LittleEndian {
+		b.buf = []byte{'I', 'I', 0x2A, 0x00, 0, 0, 0, 0}
+	} else {
+		b.buf = []byte{'M', 'M', 0x00, 0x2A, 0, 0, 0, 0}
+	}
+	return b
+}
+
+// data appends a raw block and returns its offset
+func (b *testTIFFBuilder) data(block []byte) uint32 {
+	if len(b.buf)%2 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	offset := uint32(len(b.buf))
+	b.buf = append(b.buf, block...)
+	return offset
+}
+
+// ifd appends an IFD with external values after it and returns its offset
+func (b *testTIFFBuilder) ifd(entries []testTIFFEntry) uint32 {
+	offset := b.data(make([]byte, 2+12*len(entries)+4))
+	b.order.PutUint16(b.buf[offset:], uint16(len(entries)))
+	for i, e := range entries {
+		pos := int(offset) + 2 + 12*i
+		b.order.PutUint16(b.buf[pos:], e.tag)
+		b.order.PutUint16(b.buf[pos+2:], e.typ)
+		b.order.PutUint32(b.buf[pos+4:], e.count)
+		if len(e.value) <= 4 {
+			copy(b.buf[pos+8:], e.value)
+		} else {
+			valueOffset := b.data(e.value)
+			b.order.PutUint32(b.buf[pos+8:], valueOffset)
+		}
+	}
+	return offset
+}
+
+// link sets the next IFD pointer of the IFD at from, or the header when from is zero
+func (b *testTIFFBuilder) link(from, to uint32) {
+	pos := 4
+	if from != 0 {
+		pos = int(from) + 2 + 12*int(b.order.Uint16(b.buf[from:]))
+	}
+	b.order.PutUint32(b.buf[pos:], to)
+}
+
+func (b *testTIFFBuilder) short(v uint16) []byte {
+	out := make([]byte, 2)
+	b.order.PutUint16(out, v)
+	return out
+}
+
+func (b *testTIFFBuilder) long(v uint32) []byte {
+	out := make([]byte, 4)
+	b.order.PutUint32(out, v)
+	return out
+}
+
+// buildTestTIFF creates a 2x2 grayscale TIFF with one page per pixel block and privacy tags on each page
+func buildTestTIFF(order binary.ByteOrder, pixels ...[]byte) []byte {
+	b := newTestTIFFBuilder(order)
+	var previous uint32
+	for _, block := range pixels {
+		strip := b.data(block)
+		gps := b.ifd([]testTIFFEntry{
+			{1, 2, 2, []byte("N\x00")},
+		})
+		exif := b.ifd([]testTIFFEntry{
+			{36864, 7, 4, []byte("0230")},
+			{40961, 3, 1, b.short(1)},
+			{42033, 2, 8, []byte("SN12345\x00")},
+		})
+		page := b.ifd([]testTIFFEntry{
+			{256, 3, 1, b.short(2)},
+			{257, 3, 1, b.short(2)},
+			{258, 3, 1, b.short(8)},
+			{259, 3, 1, b.short(1)},
+			{262, 3, 1, b.short(1)},
+			{271, 2, 5, []byte("Acme\x00")},
+			{273, 4, 1, b.long(strip)},
+			{277, 3, 1, b.short(1)},
+			{278, 3, 1, b.short(2)},
+			{279, 4, 1, b.long(uint32(len(block)))},
+			{306, 2, 20, []byte("2023:01:01 12:00:00\x00")},
+			{315, 2, 9, []byte("Jane Doe\x00")},
+			{tiffTagExifIFD, 4, 1, b.long(exif)},
+			{tiffTagGPSIFD, 4, 1, b.long(gps)},
+		})
+		b.link(previous, page)
+		previous = page
+	}
+	return b.buf
+}
+
+// readTestTIFFPages returns the tags and strip data of every page in the main IFD chain
+func readTestTIFFPages(t *testing.T, data []byte) ([]map[uint16]*tiffEntry, [][]byte) {
+	t.Helper()
+
+	order, err := tiffByteOrder(data)
+	if err != nil {
+		t.Fatalf("Output is not a valid TIFF: %v", err)
+	}
+
+	keepAll := make(map[uint16]bool)
+	for tag := 0; tag <= 0xFFFF; tag++ {
+		keepAll[uint16(tag)] = true
+	}
+	proc := NewProcessor(nil, false)
+	r := &tiffReader{
+		data:    data,
+		order:   order,
+		rules:   &tiffRules{image: keepAll, exif: keepAll, interop: keepAll},
+		visited: make(map[uint32]bool),
+		proc:    proc,
+	}
+
+	var pages []map[uint16]*tiffEntry
+	var strips [][]byte
+	for offset := order.Uint32(data[4:]); offset != 0; {
+		ifd, next, err := r.readIFD(offset, keepAll)
+		if err != nil {
+			t.Fatalf("Failed to read output IFD: %v", err)
+		}
+		tags := make(map[uint16]*tiffEntry)
+		for _, e := range ifd.entries {
+			tags[e.tag] = e
+		}
+		if strip := tags[273]; strip != nil {
+			strips = append(strips, bytes.Join(strip.blocks, nil))
+		}
+		pages = append(pages, tags)
+		offset = next
+	}
+	return pages, strips
+}
+
+func TestStripTIFF(t *testing.T) {
+	orders := []struct {
+		name  string
+		order binary.ByteOrder
+	}{
+		{"Little-endian", binary.LittleEndian},
+		{"Big-endian", binary.BigEndian},
+	}
+
+	for _, tc := range orders {
+		t.Run(tc.name, func(t *testing.T) {
+			proc := NewProcessor(nil, false)
+			pixels := [][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}}
+			input := buildTestTIFF(tc.order, pixels...)
+
+			output, err := proc.stripTIFF(input, baselineTIFFRules)
+			if err != nil {
+				t.Fatalf("stripTIFF failed: %v", err)
+			}
+
+			if !bytes.Equal(output[:4], input[:4]) {
+				t.Errorf("Byte order header changed: %v", output[:4])
+			}
+
+			pages, strips := readTestTIFFPages(t, output)
+			if len(pages) != len(pixels) {
+				t.Fatalf("Expected %d pages, got %d", len(pixels), len(pages))
+			}
+
+			for i, tags := range pages {
+				for _, tag := range []uint16{271, 306, 315, tiffTagGPSIFD} {
+					if tags[tag] != nil {
+						t.Errorf("Page %d: tag %d was not removed", i, tag)
+					}
+				}
+				for _, tag := range []uint16{256, 257, 258, 259, 262, 273, 279} {
+					if tags[tag] == nil {
+						t.Errorf("Page %d: required tag %d was removed", i, tag)
+					}
+				}
+
+				exif := tags[tiffTagExifIFD]
+				if exif == nil || len(exif.ifds) != 1 {
+					t.Fatalf("Page %d: EXIF IFD missing", i)
+				}
+				if exif.ifds[0].find(42033) != nil {
+					t.Errorf("Page %d: BodySerialNumber was not removed", i)
+				}
+				if exif.ifds[0].find(40961) == nil {
+					t.Errorf("Page %d: ColorSpace was removed", i)
+				}
+
+				if !bytes.Equal(strips[i], pixels[i]) {
+					t.Errorf("Page %d: strip data changed: %v", i, strips[i])
+				}
+			}
+
+			if bytes.Contains(output, []byte("Jane Doe")) || bytes.Contains(output, []byte("SN12345")) {
+				t.Error("Privacy tag values still present in output")
+			}
+
+			if proc.Stats.ByMetadataType["Artist"] == nil || proc.Stats.ByMetadataType["GPS"] == nil {
+				t.Error("Removed tags were not reported in statistics")
+			}
+		})
+	}
+
+	t.Run("Rewrite is stable", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		first, err := proc.stripTIFF(buildTestTIFF(binary.LittleEndian, []byte{1, 2, 3, 4}), baselineTIFFRules)
+		if err != nil {
+			t.Fatalf("stripTIFF failed: %v", err)
+		}
+		second, err := proc.stripTIFF(first, baselineTIFFRules)
+		if err != nil {
+			t.Fatalf("stripTIFF failed on cleaned file: %v", err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Error("Cleaning an already clean file changed it")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := [][]byte{
+			[]byte("II*"),
+			[]byte("XX*\x00\x08\x00\x00\x00"),
+			{'I', 'I', 0x2B, 0x00, 0x08, 0x00, 0x00, 0x00},
+			{'I', 'I', 0x2A, 0x00, 0xFF, 0x00, 0x00, 0x00},
+		}
+		for _, data := range invalid {
+			if _, err := proc.stripTIFF(data, baselineTIFFRules); err == nil {
+				t.Errorf("Expected error for %q", data)
+			}
+		}
+	})
+
+	t.Run("IFD loop", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		data := buildTestTIFF(binary.LittleEndian, []byte{1, 2, 3, 4})
+		first := binary.LittleEndian.Uint32(data[4:])
+		b := &testTIFFBuilder{order: binary.LittleEndian, buf: data}
+		b.link(first, first)
+		if _, err := proc.stripTIFF(b.buf, baselineTIFFRules); err == nil {
+			t.Error("Expected error for looping IFD chain")
+		}
+	})
+}
+
+func TestCleanTIFF(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "scan.tif")
+	if err := os.WriteFile(filePath, buildTestTIFF(binary.BigEndian, []byte{1, 2, 3, 4}), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".tif"); err != nil {
+		t.Fatalf("Failed to clean TIFF: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("Acme")) {
+		t.Error("Make tag still present after cleaning")
+	}
+}
@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// ProcessVideo removes metadata from video files
+func (p *Processor) ProcessVideo(filePath, ext string) error {
+	// If preview mode, just log and return
+	if p.previewMode {
+		return nil
+	}
+
+	ext = strings.ToLower(ext)
+	switch ext {
+	case ".mp4", ".mov", ".m4v":
+		return p.cleanMP4(filePath, stats.TypeVideo)
+	case ".mkv", ".webm":
+		return p.cleanMKV(filePath)
+	default:
+		return fmt.Errorf("unsupported video format: %s", ext)
+	}
+}
@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"metadata-remover/src/logger"
+)
+
+func setupVideoTest(t *testing.T) (string, *Processor, func()) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "video_processor_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+
+	// Create logger
+	logPath := filepath.Join(tempDir, "video_test.log")
+	log, err := logger.NewLogger(logPath)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	// Create processor
+	proc := NewProcessor(log, false)
+
+	// Return cleanup function
+	cleanup := func() {
+		log.Close()
+		os.RemoveAll(tempDir)
+	}
+
+	return tempDir, proc, cleanup
+}
+
+func TestProcessVideo(t *testing.T) {
+	tempDir, proc, cleanup := setupVideoTest(t)
+	defer cleanup()
+
+	t.Run("Preview mode", func(t *testing.T) {
+		previewProc := NewProcessor(proc.logger, true)
+		if err := previewProc.ProcessVideo("dummy_path.mp4", ".mp4"); err != nil {
+			t.Errorf("Expected no error in preview mode, got: %v", err)
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		if err := proc.ProcessVideo(filepath.Join(tempDir, "test.xyz"), ".xyz"); err == nil {
+			t.Error("Expected error for unsupported video format")
+		}
+	})
+
+	t.Run("Invalid MP4", func(t *testing.T) {
+		invalidPath := filepath.Join(tempDir, "invalid.mp4")
+		if err := os.WriteFile(invalidPath, []byte("Not an MP4 file"), 0644); err != nil {
+			t.Fatalf("Failed to create invalid test file: %v", err)
+		}
+		if err := proc.ProcessVideo(invalidPath, ".MP4"); err == nil {
+			t.Error("Expected error for invalid MP4 file")
+		}
+	})
+
+	t.Run("Nonexistent file", func(t *testing.T) {
+		if err := proc.ProcessVideo(filepath.Join(tempDir, "nonexistent.mp4"), ".mp4"); err == nil {
+			t.Error("Expected error for nonexistent file")
+		}
+	})
+}
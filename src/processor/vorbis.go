@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// vorbisComment is a Vorbis comment block as used by FLAC, Ogg Vorbis and Opus
+type vorbisComment struct {
+	vendor   string
+	comments []string // "KEY=value" entries
+}
+
+// parseVorbisComment decodes a Vorbis comment block; trailing bytes such as
+// the Vorbis framing bit are ignored
+func parseVorbisComment(data []byte) (*vorbisComment, error) {
+	invalid := errors.New("invalid Vorbis comment block")
+	next := func() (string, bool) {
+		if len(data) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return "", false
+		}
+		s := string(data[4 : 4+n])
+		data = data[4+n:]
+		return s, true
+	}
+
+	vendor, ok := next()
+	if !ok || len(data) < 4 {
+		return nil, invalid
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	vc := &vorbisComment{vendor: vendor}
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return nil, invalid
+		}
+		vc.comments = append(vc.comments, comment)
+	}
+	return vc, nil
+}
+
+// bytes encodes the comment block
+func (vc *vorbisComment) bytes() []byte {
+	out := binary.LittleEndian.AppendUint32(nil, uint32(len(vc.vendor)))
+	out = append(out, vc.vendor...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(vc.comments)))
+	for _, comment := range vc.comments {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(comment)))
+		out = append(out, comment...)
+	}
+	return out
+}
+
+// cleanVorbisComment replaces the vendor string and drops the comments unless the policy keeps tags.
+// Cover art stored as METADATA_BLOCK_PICTURE comments follows the cover art policy.
+func (p *Processor) cleanVorbisComment(vc *vorbisComment) {
+	if vc.vendor != "" {
+		p.Stats.AddMetadata(stats.TypeAudio, "Encoder", metadataExample(vc.vendor))
+	}
+	vc.vendor = ""
+
+	kept := vc.comments[:0]
+	for _, comment := range vc.comments {
+		key, value, _ := strings.Cut(comment, "=")
+		key = strings.ToUpper(key)
+
+		keep := p.Policy.KeepAudioTags
+		if key == "METADATA_BLOCK_PICTURE" || key == "COVERART" {
+			keep = p.Policy.KeepCoverArt
+			value = ""
+		}
+		if keep {
+			kept = append(kept, comment)
+			continue
+		}
+		p.Stats.AddMetadata(stats.TypeAudio, key, metadataExample(value))
+	}
+	vc.comments = kept
+}
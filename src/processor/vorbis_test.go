@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestVorbisComment(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		vc := &vorbisComment{vendor: "reference libFLAC 1.4.2 20221022", comments: []string{"ARTIST=Jane", "TITLE=Take 3"}}
+		parsed, err := parseVorbisComment(append(vc.bytes(), 1)) // Trailing framing bit
+		if err != nil {
+			t.Fatalf("parseVorbisComment failed: %v", err)
+		}
+		if !reflect.DeepEqual(parsed, vc) {
+			t.Errorf("Round trip changed the block: %+v", parsed)
+		}
+	})
+
+	t.Run("Invalid blocks", func(t *testing.T) {
+		valid := (&vorbisComment{vendor: "x", comments: []string{"A=B"}}).bytes()
+		invalid := [][]byte{
+			nil,
+			{0xFF, 0, 0, 0},
+			valid[:len(valid)-1],
+			valid[:9],
+		}
+		for _, data := range invalid {
+			if _, err := parseVorbisComment(data); err == nil {
+				t.Errorf("Expected error for %X", data)
+			}
+		}
+	})
+
+	t.Run("Cleaning follows policy", func(t *testing.T) {
+		comments := []string{"ARTIST=Jane", "comment=Mixed at Studio B", "METADATA_BLOCK_PICTURE=AAAA"}
+
+		proc := NewProcessor(nil, false)
+		vc := &vorbisComment{vendor: "Lavf58.76.100", comments: append([]string{}, comments...)}
+		proc.cleanVorbisComment(vc)
+		if vc.vendor != "" || len(vc.comments) != 0 {
+			t.Errorf("Default policy left %+v", vc)
+		}
+		if field := proc.Stats.ByMetadataType["COMMENT"]; field == nil || field.Examples[0] != "Mixed at Studio B" {
+			t.Error("Comment was not reported with its value")
+		}
+		if field := proc.Stats.ByMetadataType["Encoder"]; field == nil || field.Examples[0] != "Lavf58.76.100" {
+			t.Error("Vendor string was not reported")
+		}
+
+		proc = NewProcessor(nil, false)
+		proc.Policy.KeepAudioTags = true
+		vc = &vorbisComment{vendor: "Lavf58.76.100", comments: append([]string{}, comments...)}
+		proc.cleanVorbisComment(vc)
+		if vc.vendor != "" || !reflect.DeepEqual(vc.comments, comments[:2]) {
+			t.Errorf("Keeping tags left %+v", vc)
+		}
+		if bytes.Contains(vc.bytes(), []byte("Lavf")) {
+			t.Error("Vendor string was not replaced")
+		}
+	})
+}
@@ -0,0 +1,379 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+// wavReportLimit caps the size of removed chunks that are read to report their contents
+const wavReportLimit = 1 << 20
+
+// wavAudioChunks are the chunks needed to play back and edit the audio
+var wavAudioChunks = map[string]bool{
+	"fmt ": true,
+	"fact": true,
+	"data": true,
+	"cue ": true,
+	"plst": true,
+	"smpl": true,
+	"inst": true,
+	"acid": true,
+}
+
+// wavInfoNames names the LIST/INFO entries reported in statistics
+var wavInfoNames = map[string]string{
+	"INAM": "Title",
+	"IART": "Artist",
+	"IPRD": "Album",
+	"ICMT": "Comment",
+	"ICRD": "Creation date",
+	"ISFT": "Software",
+	"IENG": "Engineer",
+	"ITCH": "Technician",
+	"ICOP": "Copyright",
+	"IGNR": "Genre",
+	"IKEY": "Keywords",
+	"ISBJ": "Subject",
+	"ISRC": "Source",
+	"ITRK": "Track number",
+}
+
+// wavChunk locates a RIFF chunk without holding its contents
+type wavChunk struct {
+	id    string
+	start int64 // Offset of the chunk header
+	size  int64 // Payload size, taken from ds64 for large RF64 chunks
+}
+
+// wavSizes is the ds64 chunk of an RF64 file
+type wavSizes struct {
+	riffSize    uint64
+	dataSize    uint64
+	sampleCount uint64
+	table       map[string]uint64 // Sizes of other chunks over 4 GB
+	order       []string
+}
+
+// cleanWAV removes metadata from WAV, Broadcast Wave and RF64 files
+func (p *Processor) cleanWAV(filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Create temp file
+	tempPath := filePath + ".temp"
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath) // Clean up temp file in case of error
+	}()
+
+	writer := bufio.NewWriter(tempFile)
+	if err := p.stripWAV(file, info.Size(), writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// Close files
+	file.Close()
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	// Replace original file with cleaned file
+	return os.Rename(tempPath, filePath)
+}
+
+// stripWAV copies the audio chunks and drops INFO lists, Broadcast Wave extensions,
+// iXML, XMP and unknown chunks. RF64 files keep their form with the ds64 sizes
+// updated; the chunks themselves are copied straight from r.
+func (p *Processor) stripWAV(r io.ReaderAt, size int64, w io.Writer) error {
+	header := make([]byte, 12)
+	if size < 12 {
+		return errors.New("not a valid WAV file")
+	}
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return errors.New("not a valid WAV file")
+	}
+	form := string(header[:4])
+	if (form != "RIFF" && form != "RF64" && form != "BW64") || string(header[8:12]) != "WAVE" {
+		return errors.New("not a valid WAV file")
+	}
+
+	// RF64 files keep their real sizes in the ds64 chunk that must come first
+	pos := int64(12)
+	riffEnd := 8 + int64(binary.LittleEndian.Uint32(header[4:8]))
+	var sizes *wavSizes
+	if form != "RIFF" {
+		chunk, err := readWAVChunk(r, pos, size, nil)
+		if err != nil {
+			return err
+		}
+		if chunk.id != "ds64" {
+			return errors.New("RF64 file is missing its ds64 chunk")
+		}
+		payload := make([]byte, chunk.size)
+		if _, err := r.ReadAt(payload, chunk.start+8); err != nil {
+			return errors.New("truncated ds64 chunk")
+		}
+		if sizes, err = parseWAVSizes(payload); err != nil {
+			return err
+		}
+		riffEnd = 8 + int64(sizes.riffSize)
+		pos = chunk.start + 8 + chunk.size + chunk.size&1
+	}
+
+	if riffEnd > size || riffEnd < pos {
+		return errors.New("truncated WAV file")
+	}
+	if riffEnd < size {
+		p.Stats.AddMetadata(stats.TypeAudio, "Trailing data", "")
+	}
+
+	// Pick the chunks to keep
+	var kept []wavChunk
+	body := int64(0)
+	for pos < riffEnd {
+		chunk, err := readWAVChunk(r, pos, riffEnd, sizes)
+		if err != nil {
+			return err
+		}
+		pos = chunk.start + 8 + chunk.size + chunk.size&1
+
+		if !wavAudioChunks[chunk.id] {
+			if err := p.reportWAVChunk(r, chunk); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, chunk)
+		body += 8 + chunk.size + chunk.size&1
+	}
+
+	// Write the header, with the sizes in ds64 for RF64 files
+	if sizes == nil {
+		binary.LittleEndian.PutUint32(header[4:8], uint32(4+body))
+	} else {
+		sizes.filterTable(kept)
+		ds64 := sizes.bytes() // The RIFF size doesn't change the chunk length
+		sizes.riffSize = uint64(4 + 8 + int64(len(ds64)) + body)
+		header = append(header, wavChunkHeader("ds64", len(ds64))...)
+		header = append(header, sizes.bytes()...)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, chunk := range kept {
+		if _, err := io.Copy(w, io.NewSectionReader(r, chunk.start, 8+chunk.size)); err != nil {
+			return err
+		}
+		if chunk.size&1 != 0 {
+			// The padding byte may be missing from a last chunk
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readWAVChunk reads the chunk header at pos; sizes resolves the placeholder sizes of RF64 chunks
+func readWAVChunk(r io.ReaderAt, pos, end int64, sizes *wavSizes) (wavChunk, error) {
+	header := make([]byte, 8)
+	if end-pos < 8 {
+		return wavChunk{}, errors.New("truncated WAV chunk header")
+	}
+	if _, err := r.ReadAt(header, pos); err != nil {
+		return wavChunk{}, errors.New("truncated WAV chunk header")
+	}
+
+	chunk := wavChunk{id: string(header[:4]), start: pos, size: int64(binary.LittleEndian.Uint32(header[4:]))}
+	if sizes != nil && chunk.size == 0xFFFFFFFF {
+		large, ok := sizes.table[chunk.id]
+		if chunk.id == "data" {
+			large, ok = sizes.dataSize, true
+		}
+		if !ok || large > uint64(end) {
+			return wavChunk{}, fmt.Errorf("missing ds64 size for WAV chunk %q", chunk.id)
+		}
+		chunk.size = int64(large)
+	}
+	if chunk.size > end-pos-8 {
+		return wavChunk{}, fmt.Errorf("WAV chunk %q exceeds file size", chunk.id)
+	}
+	return chunk, nil
+}
+
+// wavChunkHeader builds a chunk header
+func wavChunkHeader(id string, size int) []byte {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(size))
+	return header
+}
+
+// parseWAVSizes reads a ds64 chunk payload
+func parseWAVSizes(payload []byte) (*wavSizes, error) {
+	if len(payload) < 28 {
+		return nil, errors.New("invalid ds64 chunk")
+	}
+	sizes := &wavSizes{
+		riffSize:    binary.LittleEndian.Uint64(payload),
+		dataSize:    binary.LittleEndian.Uint64(payload[8:]),
+		sampleCount: binary.LittleEndian.Uint64(payload[16:]),
+		table:       make(map[string]uint64),
+	}
+
+	count := binary.LittleEndian.Uint32(payload[24:])
+	if uint64(count)*12 > uint64(len(payload)-28) {
+		return nil, errors.New("invalid ds64 chunk")
+	}
+	for i := 0; i < int(count); i++ {
+		entry := payload[28+12*i:]
+		id := string(entry[:4])
+		sizes.table[id] = binary.LittleEndian.Uint64(entry[4:])
+		sizes.order = append(sizes.order, id)
+	}
+	return sizes, nil
+}
+
+// filterTable drops the table entries of removed chunks
+func (sizes *wavSizes) filterTable(kept []wavChunk) {
+	keep := make(map[string]bool)
+	for _, chunk := range kept {
+		keep[chunk.id] = true
+	}
+	order := sizes.order[:0]
+	for _, id := range sizes.order {
+		if keep[id] {
+			order = append(order, id)
+		}
+	}
+	sizes.order = order
+}
+
+// bytes encodes the ds64 chunk payload
+func (sizes *wavSizes) bytes() []byte {
+	out := binary.LittleEndian.AppendUint64(nil, sizes.riffSize)
+	out = binary.LittleEndian.AppendUint64(out, sizes.dataSize)
+	out = binary.LittleEndian.AppendUint64(out, sizes.sampleCount)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(sizes.order)))
+	for _, id := range sizes.order {
+		out = append(out, id...)
+		out = binary.LittleEndian.AppendUint64(out, sizes.table[id])
+	}
+	return out
+}
+
+// reportWAVChunk records a removed chunk in statistics, reading the contents of small INFO lists and bext chunks
+func (p *Processor) reportWAVChunk(r io.ReaderAt, chunk wavChunk) error {
+	switch chunk.id {
+	case "JUNK", "PAD ", "FLLR":
+		// Padding
+		return nil
+	case "iXML":
+		p.Stats.AddMetadata(stats.TypeAudio, "iXML", "")
+		return nil
+	case "_PMX":
+		p.Stats.AddMetadata(stats.TypeAudio, "XMP", "")
+		return nil
+	case "id3 ", "ID3 ":
+		p.Stats.AddMetadata(stats.TypeAudio, "ID3v2", "")
+		return nil
+	case "LIST", "bext":
+		if chunk.size > wavReportLimit {
+			p.Stats.AddMetadata(stats.TypeAudio, fmt.Sprintf("WAV chunk %q", chunk.id), "")
+			return nil
+		}
+	default:
+		p.Stats.AddMetadata(stats.TypeAudio, fmt.Sprintf("WAV chunk %q", chunk.id), "")
+		return nil
+	}
+
+	payload := make([]byte, chunk.size)
+	if _, err := r.ReadAt(payload, chunk.start+8); err != nil {
+		return fmt.Errorf("truncated WAV chunk %q", chunk.id)
+	}
+	if chunk.id == "bext" {
+		p.reportBroadcastExtension(payload)
+	} else {
+		p.reportWAVList(payload)
+	}
+	return nil
+}
+
+// reportWAVList records the entries of a LIST chunk
+func (p *Processor) reportWAVList(payload []byte) {
+	if len(payload) < 4 || string(payload[:4]) != "INFO" {
+		p.Stats.AddMetadata(stats.TypeAudio, "WAV list", "")
+		return
+	}
+
+	for pos := 4; pos+8 <= len(payload); {
+		id := string(payload[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(payload[pos+4:]))
+		if size > len(payload)-pos-8 {
+			break
+		}
+		name, ok := wavInfoNames[id]
+		if !ok {
+			name = "INFO " + id
+		}
+		p.Stats.AddMetadata(stats.TypeAudio, name, metadataExample(wavString(payload[pos+8:pos+8+size])))
+		pos += 8 + size + size&1
+	}
+}
+
+// reportBroadcastExtension records the fields of a Broadcast Wave bext chunk
+func (p *Processor) reportBroadcastExtension(payload []byte) {
+	p.Stats.AddMetadata(stats.TypeAudio, "Broadcast extension", "")
+	if len(payload) < 602 {
+		return
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"Description", wavString(payload[0:256])},
+		{"Originator", wavString(payload[256:288])},
+		{"Originator reference", wavString(payload[288:320])},
+		{"Origination date", strings.TrimSpace(wavString(payload[320:330]) + " " + wavString(payload[330:338]))},
+		{"Coding history", wavString(payload[602:])},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			p.Stats.AddMetadata(stats.TypeAudio, field.name, metadataExample(field.value))
+		}
+	}
+}
+
+// wavString decodes a fixed-size or null-terminated text field
+func wavString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
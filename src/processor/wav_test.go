@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTestWAV builds a RIFF WAVE file around the chunks
+func buildTestWAV(chunks ...[]byte) []byte {
+	body := bytes.Join(chunks, nil)
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(4+len(body)))
+	out = append(out, "WAVE"...)
+	return append(out, body...)
+}
+
+// buildTestRF64 builds an RF64 file whose data chunk size is kept in ds64
+func buildTestRF64(table map[string]uint64, chunks ...[]byte) []byte {
+	body := bytes.Join(chunks, nil)
+	sizes := &wavSizes{dataSize: 6, sampleCount: 3, table: table}
+	for id := range table {
+		sizes.order = append(sizes.order, id)
+	}
+	ds64 := testRIFFChunk("ds64", sizes.bytes())
+	sizes.riffSize = uint64(4 + len(ds64) + len(body))
+	ds64 = testRIFFChunk("ds64", sizes.bytes())
+
+	out := append([]byte("RF64"), 0xFF, 0xFF, 0xFF, 0xFF)
+	out = append(out, "WAVE"...)
+	out = append(out, ds64...)
+	return append(out, body...)
+}
+
+// testRF64Chunk builds a chunk whose size is kept in ds64
+func testRF64Chunk(fourCC string, payload []byte) []byte {
+	chunk := testRIFFChunk(fourCC, payload)
+	binary.LittleEndian.PutUint32(chunk[4:], 0xFFFFFFFF)
+	return chunk
+}
+
+// testBEXT builds a Broadcast Wave extension chunk payload
+func testBEXT(originator, date, time, history string) []byte {
+	payload := make([]byte, 602)
+	copy(payload, "Scene 12 take 3")
+	copy(payload[256:], originator)
+	copy(payload[320:], date)
+	copy(payload[330:], time)
+	return append(payload, history...)
+}
+
+func TestStripWAV(t *testing.T) {
+	format := testRIFFChunk("fmt ", []byte{1, 0, 1, 0, 0x80, 0xBB, 0, 0, 0, 0x77, 1, 0, 2, 0, 16, 0})
+	data := testRIFFChunk("data", []byte{1, 2, 3, 4, 5}) // Odd size with padding
+	info := testRIFFChunk("LIST", append([]byte("INFO"), append(
+		testRIFFChunk("INAM", []byte("Interview\x00")),
+		testRIFFChunk("ISFT", []byte("Zoom F8n\x00"))...)...))
+	bext := testRIFFChunk("bext", testBEXT("ZOOM F8n", "2024-05-01", "14:03:22", "A=PCM,F=48000,W=24,M=stereo"))
+	ixml := testRIFFChunk("iXML", []byte("<BWFXML><PROJECT>Secret</PROJECT></BWFXML>"))
+	xmp := testRIFFChunk("_PMX", []byte("<x:xmpmeta/>"))
+	junk := testRIFFChunk("JUNK", make([]byte, 28))
+
+	t.Run("Metadata chunks removed", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestWAV(junk, format, bext, ixml, info, xmp, data)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripWAV(bytes.NewReader(input), int64(len(input)), w)
+		})
+		if expected := buildTestWAV(format, data); !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+
+		for _, name := range []string{"Title", "Software", "Broadcast extension", "Originator", "Origination date", "Coding history", "iXML", "XMP"} {
+			if proc.Stats.ByMetadataType[name] == nil {
+				t.Errorf("%s was not reported in statistics", name)
+			}
+		}
+		if field := proc.Stats.ByMetadataType["Origination date"]; field != nil && field.Examples[0] != "2024-05-01 14:03:22" {
+			t.Errorf("Unexpected origination date %q", field.Examples[0])
+		}
+	})
+
+	t.Run("RF64 sizes", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		samples := testRF64Chunk("data", []byte{1, 2, 3, 4, 5, 6})
+		input := buildTestRF64(map[string]uint64{"iXML": 4}, format, testRF64Chunk("iXML", []byte("<xml")), bext, samples)
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripWAV(bytes.NewReader(input), int64(len(input)), w)
+		})
+		if expected := buildTestRF64(nil, format, samples); !bytes.Equal(output, expected) {
+			t.Errorf("Unexpected output:\n got %X\nwant %X", output, expected)
+		}
+	})
+
+	t.Run("Missing padding on the last chunk", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		input := buildTestWAV(format, data[:len(data)-1])
+
+		output := runStrip(t, func(w io.Writer) error {
+			return proc.stripWAV(bytes.NewReader(input), int64(len(input)), w)
+		})
+		if expected := buildTestWAV(format, data); !bytes.Equal(output, expected) {
+			t.Errorf("Padding was not restored:\n got %X\nwant %X", output, expected)
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		truncated := buildTestWAV(format, data)
+		binary.LittleEndian.PutUint32(truncated[4:], 1000)
+		invalid := [][]byte{
+			[]byte("not a wav file"),
+			buildTestWAV(format, testRIFFChunk("data", make([]byte, 10))[:12]),
+			truncated,
+			append(append([]byte("RF64"), 0xFF, 0xFF, 0xFF, 0xFF), append([]byte("WAVE"), format...)...),
+			buildTestRF64(nil, format, testRF64Chunk("bext", []byte("xx"))),
+		}
+		for i, data := range invalid {
+			if err := proc.stripWAV(bytes.NewReader(data), int64(len(data)), io.Discard); err == nil {
+				t.Errorf("Expected error for invalid file %d", i)
+			}
+		}
+	})
+}
+
+func TestCleanWAV(t *testing.T) {
+	tempDir, proc, cleanup := setupAudioTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "take.wav")
+	input := buildTestWAV(
+		testRIFFChunk("fmt ", make([]byte, 16)),
+		testRIFFChunk("bext", testBEXT("Sound Devices 833", "2024-05-01", "09:00:00", "")),
+		testRIFFChunk("data", []byte{0, 0, 1, 1}),
+	)
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessAudio(filePath, ".wav"); err != nil {
+		t.Fatalf("Failed to clean WAV: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("Sound Devices")) || !bytes.HasSuffix(data, []byte{0, 0, 1, 1}) {
+		t.Error("WAV was not cleaned correctly")
+	}
+}
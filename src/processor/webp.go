@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"metadata-remover/src/stats"
+)
+
+// VP8X feature flags that announce optional chunks
+const (
+	webpFlagICC  = 0x20
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// webpImageChunks are the chunks needed to decode still, lossless and animated WebP images
+var webpImageChunks = map[string]bool{
+	"VP8X": true,
+	"VP8 ": true,
+	"VP8L": true,
+	"ALPH": true,
+	"ANIM": true,
+	"ANMF": true,
+}
+
+// cleanWEBP removes metadata from WebP files
+func (p *Processor) cleanWEBP(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	cleaned, err := p.stripWEBP(data)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(filePath, cleaned)
+}
+
+// stripWEBP rewrites the RIFF chunk list without EXIF, XMP and unknown chunks.
+// The ICCP chunk is kept when the policy asks for color profiles.
+func (p *Processor) stripWEBP(data []byte) ([]byte, error) {
+	// Check RIFF header and WEBP type
+	if len(data) < 12 || !bytes.Equal(data[0:4], []byte("RIFF")) || !bytes.Equal(data[8:12], []byte("WEBP")) {
+		return nil, errors.New("not a valid WebP file")
+	}
+
+	riffEnd := 8 + int64(binary.LittleEndian.Uint32(data[4:8]))
+	if riffEnd > int64(len(data)) {
+		return nil, errors.New("truncated WebP file")
+	}
+	if riffEnd < int64(len(data)) {
+		p.Stats.AddMetadata(stats.TypeImage, "Trailing data", "")
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	vp8x := -1
+	hasICC := false
+
+	for pos := int64(12); pos < riffEnd; {
+		if pos+8 > riffEnd {
+			return nil, errors.New("truncated WebP chunk header")
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size&1 // Chunks are padded to an even size
+		if pos+8+size > riffEnd {
+			return nil, fmt.Errorf("WebP chunk %q exceeds file size", fourCC)
+		}
+		if end > riffEnd {
+			end = riffEnd
+		}
+		chunk := data[pos:end]
+		pos = end
+
+		switch {
+		case fourCC == "ICCP" && p.Policy.KeepICCProfile:
+			hasICC = true
+		case webpImageChunks[fourCC]:
+			if fourCC == "VP8X" {
+				if size < 10 {
+					return nil, errors.New("invalid WebP VP8X chunk")
+				}
+				vp8x = len(out)
+			}
+		default:
+			p.Stats.AddMetadata(stats.TypeImage, webpChunkName(fourCC), "")
+			continue
+		}
+
+		out = append(out, chunk...)
+		if len(chunk)%2 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	// Only announce the optional chunks that are still present
+	if vp8x >= 0 {
+		flags := out[vp8x+8] &^ (webpFlagICC | webpFlagEXIF | webpFlagXMP)
+		if hasICC {
+			flags |= webpFlagICC
+		}
+		out[vp8x+8] = flags
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
+
+// webpChunkName returns the statistics name for a removed chunk
+func webpChunkName(fourCC string) string {
+	switch fourCC {
+	case "EXIF":
+		return "EXIF"
+	case "XMP ":
+		return "XMP"
+	case "ICCP":
+		return "ICC Profile"
+	default:
+		return fmt.Sprintf("WebP chunk %q", fourCC)
+	}
+}
@@ -0,0 +1,170 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testRIFFChunk builds a RIFF chunk with padding
+func testRIFFChunk(fourCC string, payload []byte) []byte {
+	chunk := make([]byte, 8, 8+len(payload)+1)
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 != 0 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// buildTestWEBP wraps chunks in a RIFF WEBP container
+func buildTestWEBP(chunks ...[]byte) []byte {
+	body := bytes.Join(chunks, nil)
+	data := make([]byte, 12, 12+len(body))
+	copy(data, "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(4+len(body)))
+	copy(data[8:], "WEBP")
+	return append(data, body...)
+}
+
+// testWEBPChunks lists the fourCCs of the top-level chunks in a WebP file
+func testWEBPChunks(t *testing.T, data []byte) []string {
+	t.Helper()
+	if int(binary.LittleEndian.Uint32(data[4:]))+8 != len(data) {
+		t.Fatalf("RIFF size %d does not match file size %d", binary.LittleEndian.Uint32(data[4:]), len(data))
+	}
+	var chunks []string
+	for pos := 12; pos < len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		chunks = append(chunks, string(data[pos:pos+4]))
+		pos += 8 + size + size&1
+	}
+	return chunks
+}
+
+func TestStripWEBP(t *testing.T) {
+	vp8x := []byte{webpFlagICC | webpFlagEXIF | webpFlagXMP | 0x10, 0, 0, 0, 1, 0, 0, 1, 0, 0}
+	input := buildTestWEBP(
+		testRIFFChunk("VP8X", vp8x),
+		testRIFFChunk("ICCP", []byte("fake icc profile")),
+		testRIFFChunk("ALPH", []byte{0, 1, 2}),
+		testRIFFChunk("VP8L", []byte{0x2F, 0, 0, 0, 0}),
+		testRIFFChunk("EXIF", []byte("Exif\x00\x00camera serial")),
+		testRIFFChunk("XMP ", []byte("<x:xmpmeta>author</x:xmpmeta>")),
+	)
+
+	t.Run("Keep ICC profile", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		output, err := proc.stripWEBP(input)
+		if err != nil {
+			t.Fatalf("stripWEBP failed: %v", err)
+		}
+
+		chunks := testWEBPChunks(t, output)
+		expected := []string{"VP8X", "ICCP", "ALPH", "VP8L"}
+		if len(chunks) != len(expected) {
+			t.Fatalf("Expected chunks %v, got %v", expected, chunks)
+		}
+		for i := range expected {
+			if chunks[i] != expected[i] {
+				t.Errorf("Expected chunks %v, got %v", expected, chunks)
+				break
+			}
+		}
+
+		if flags := output[20]; flags != webpFlagICC|0x10 {
+			t.Errorf("Expected VP8X flags %#x, got %#x", webpFlagICC|0x10, flags)
+		}
+		if proc.Stats.ByMetadataType["EXIF"] == nil || proc.Stats.ByMetadataType["XMP"] == nil {
+			t.Error("Removed chunks were not reported in statistics")
+		}
+	})
+
+	t.Run("Strip ICC profile", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.KeepICCProfile = false
+		output, err := proc.stripWEBP(input)
+		if err != nil {
+			t.Fatalf("stripWEBP failed: %v", err)
+		}
+
+		for _, chunk := range testWEBPChunks(t, output) {
+			if chunk == "ICCP" {
+				t.Error("ICCP chunk was not removed")
+			}
+		}
+		if flags := output[20]; flags != 0x10 {
+			t.Errorf("Expected VP8X flags %#x, got %#x", 0x10, flags)
+		}
+	})
+
+	t.Run("Animation frames kept", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		frame := testRIFFChunk("ANMF", append(make([]byte, 16), testRIFFChunk("VP8L", []byte{0x2F, 1, 2})...))
+		anim := testRIFFChunk("ANIM", make([]byte, 6))
+		animated := buildTestWEBP(
+			testRIFFChunk("VP8X", []byte{0x02 | webpFlagEXIF, 0, 0, 0, 1, 0, 0, 1, 0, 0}),
+			anim,
+			frame,
+			frame,
+			testRIFFChunk("EXIF", []byte("Exif")),
+		)
+		expected := buildTestWEBP(
+			testRIFFChunk("VP8X", []byte{0x02, 0, 0, 0, 1, 0, 0, 1, 0, 0}),
+			anim,
+			frame,
+			frame,
+		)
+
+		output, err := proc.stripWEBP(animated)
+		if err != nil {
+			t.Fatalf("stripWEBP failed: %v", err)
+		}
+		if !bytes.Equal(output, expected) {
+			t.Error("Animation chunks were not preserved")
+		}
+	})
+
+	t.Run("Invalid files", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		invalid := [][]byte{
+			[]byte("RIFF\x00\x00\x00\x00WAVE"),
+			[]byte("RIFF\xFF\x00\x00\x00WEBP"),
+			buildTestWEBP([]byte("VP8L\xFF\x00\x00\x00")),
+		}
+		for _, data := range invalid {
+			if _, err := proc.stripWEBP(data); err == nil {
+				t.Errorf("Expected error for %q", data)
+			}
+		}
+	})
+}
+
+func TestCleanWEBP(t *testing.T) {
+	tempDir, proc, cleanup := setupImageTest(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tempDir, "upload.webp")
+	input := buildTestWEBP(
+		testRIFFChunk("VP8L", []byte{0x2F, 0, 0, 0, 0}),
+		testRIFFChunk("XMP ", []byte("<dc:creator>CMS</dc:creator>")),
+	)
+	if err := os.WriteFile(filePath, input, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := proc.ProcessImage(filePath, ".webp"); err != nil {
+		t.Fatalf("Failed to clean WebP: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read cleaned file: %v", err)
+	}
+	if bytes.Contains(data, []byte("CMS")) {
+		t.Error("XMP chunk still present after cleaning")
+	}
+}
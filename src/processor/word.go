@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"metadata-remover/src/stats"
+)
+
+const (
+	wordNamespace    = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	wordW15Namespace = "http://schemas.microsoft.com/office/word/2012/wordml"
+	wordCexNamespace = "http://schemas.microsoft.com/office/word/2018/wordml/cex"
+
+	wordAnonymousAuthor   = "Author"
+	wordAnonymousInitials = "A"
+)
+
+// wordCommentParts are the relationship types of the parts that hold comments
+var wordCommentParts = map[string]bool{
+	"comments":           true,
+	"commentsExtended":   true,
+	"commentsIds":        true,
+	"commentsExtensible": true,
+}
+
+// cleanWordDocument removes reviewer information from a WordprocessingML
+// document. The people part, which maps authors to accounts, is removed.
+// Comment and revision authors become "Author" and their dates are removed,
+// unless the policy removes comments or accepts tracked changes. Revision
+// session IDs are removed from every part.
+func (p *Processor) cleanWordDocument(pkg *ooxmlPackage, main string) error {
+	rels, err := pkg.relationships(main)
+	if err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		part := pkg.part(rel.target)
+		if rel.external || part == nil {
+			continue
+		}
+		typ := path.Base(rel.typ)
+		switch {
+		case typ == "people":
+			err = p.reportWordPeople(part.data)
+			pkg.remove(part.name)
+		case wordCommentParts[typ] && p.Policy.RemoveComments:
+			if typ == "comments" {
+				err = p.reportWordComments(part.data)
+			}
+			pkg.remove(part.name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+	}
+
+	// Headers, footers, notes and comments carry the same markup as the body
+	dir := path.Dir(main) + "/"
+	for _, part := range pkg.parts {
+		if pkg.removed[part.name] || !strings.HasPrefix(part.name, dir) || !strings.HasSuffix(part.name, ".xml") {
+			continue
+		}
+		if part.data, err = p.cleanWordPart(part.data); err != nil {
+			return fmt.Errorf("invalid Office Open XML part %s: %v", part.name, err)
+		}
+	}
+	return nil
+}
+
+// cleanWordPart anonymizes or resolves revisions and comments in one part
+func (p *Processor) cleanWordPart(data []byte) ([]byte, error) {
+	rsids := false
+	data, err := rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.space == wordNamespace {
+				switch e.name.Local {
+				case "rsids":
+					rsids = true
+					return xmlDrop
+				case "commentRangeStart", "commentRangeEnd", "commentReference":
+					if p.Policy.RemoveComments {
+						return xmlDrop
+					}
+				}
+				if p.Policy.AcceptRevisions {
+					if action, ok := wordRevisionAction(e); ok {
+						if author, ok := e.attr(wordNamespace, "author"); ok {
+							p.Stats.AddMetadata(stats.TypeDocument, "Tracked change", metadataExample(author))
+						}
+						return action
+					}
+				}
+			}
+
+			kept := e.attrs[:0:0]
+			for _, attr := range e.attrs {
+				space := ""
+				if attr.Name.Space != "" {
+					space = e.resolve(attr.Name.Space)
+				}
+				switch {
+				case space == wordNamespace && strings.HasPrefix(attr.Name.Local, "rsid"):
+					rsids = true
+					continue
+				case space == wordNamespace && attr.Name.Local == "date",
+					space == wordCexNamespace && attr.Name.Local == "dateUtc":
+					continue
+				case space == wordNamespace && attr.Name.Local == "author" && attr.Value != wordAnonymousAuthor:
+					name := "Revision author"
+					if e.name.Local == "comment" {
+						name = "Comment author"
+					}
+					p.Stats.AddMetadata(stats.TypeDocument, name, metadataExample(attr.Value))
+					attr.Value = wordAnonymousAuthor
+				case space == wordNamespace && attr.Name.Local == "initials":
+					attr.Value = wordAnonymousInitials
+				}
+				kept = append(kept, attr)
+			}
+			e.attrs = kept
+			return xmlKeep
+		},
+	})
+	if rsids {
+		p.Stats.AddMetadata(stats.TypeDocument, "Revision session IDs", "")
+	}
+	return data, err
+}
+
+// wordRevisionAction returns how a tracked change is accepted. Insertions keep
+// their content and deletions are dropped; formatting changes and the markers
+// on paragraph marks, rows and cells are dropped, which keeps those as they are.
+func wordRevisionAction(e *xmlElement) (xmlAction, bool) {
+	local := e.name.Local
+	marker := e.parent != nil && e.parent.space == wordNamespace && strings.HasSuffix(e.parent.name.Local, "Pr")
+	switch {
+	case strings.HasSuffix(local, "Change"),
+		strings.HasPrefix(local, "moveFromRange"), strings.HasPrefix(local, "moveToRange"),
+		strings.HasPrefix(local, "customXml") && strings.Contains(local, "Range"),
+		local == "cellIns", local == "cellDel", local == "cellMerge":
+		return xmlDrop, true
+	case local == "ins", local == "moveTo":
+		if marker {
+			return xmlDrop, true
+		}
+		return xmlUnwrap, true
+	case local == "del", local == "moveFrom":
+		return xmlDrop, true
+	}
+	return xmlKeep, false
+}
+
+// reportWordPeople records the authors listed in the people part
+func (p *Processor) reportWordPeople(data []byte) error {
+	_, err := rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.is(wordW15Namespace, "person") {
+				author, _ := e.attr(wordW15Namespace, "author")
+				p.Stats.AddMetadata(stats.TypeDocument, "Person", metadataExample(author))
+			}
+			return xmlKeep
+		},
+	})
+	return err
+}
+
+// reportWordComments records the authors of comments that are removed
+func (p *Processor) reportWordComments(data []byte) error {
+	_, err := rewriteXML(data, xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			if e.is(wordNamespace, "comment") {
+				author, _ := e.attr(wordNamespace, "author")
+				p.Stats.AddMetadata(stats.TypeDocument, "Comment", metadataExample(author))
+			}
+			return xmlKeep
+		},
+	})
+	return err
+}
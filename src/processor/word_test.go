@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+)
+
+const testWordContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/><Override PartName="/word/comments.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.comments+xml"/><Override PartName="/word/commentsExtended.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.commentsExtended+xml"/><Override PartName="/word/people.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.people+xml"/><Override PartName="/word/settings.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.settings+xml"/></Types>`
+
+const testWordPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`
+
+const testWordDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/settings" Target="settings.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments" Target="comments.xml"/><Relationship Id="rId3" Type="http://schemas.microsoft.com/office/2011/relationships/commentsExtended" Target="commentsExtended.xml"/><Relationship Id="rId4" Type="http://schemas.microsoft.com/office/2011/relationships/people" Target="people.xml"/></Relationships>`
+
+const testWordDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+	`<w:p w:rsidR="00A1B2C3" w:rsidRDefault="00D4E5F6"><w:r><w:t xml:space="preserve">Salary is </w:t></w:r>` +
+	`<w:del w:id="1" w:author="Jane Doe" w:date="2024-03-01T10:00:00Z"><w:r><w:delText>90000</w:delText></w:r></w:del>` +
+	`<w:ins w:id="2" w:author="Jane Doe" w:date="2024-03-01T10:00:05Z"><w:r><w:t>95000</w:t></w:r></w:ins>` +
+	`<w:commentRangeStart w:id="0"/><w:r w:rsidRPr="00112233"><w:rPr><w:b/><w:rPrChange w:id="3" w:author="John Roe" w:date="2024-03-02T09:00:00Z"><w:rPr/></w:rPrChange></w:rPr><w:t>.</w:t></w:r><w:commentRangeEnd w:id="0"/>` +
+	`<w:r><w:commentReference w:id="0"/></w:r></w:p>` +
+	`<w:p><w:pPr><w:rPr><w:ins w:id="4" w:author="Jane Doe" w:date="2024-03-01T10:01:00Z"/></w:rPr></w:pPr><w:r><w:t>End</w:t></w:r></w:p>` +
+	`</w:body></w:document>`
+
+const testWordComments = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:comments xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:comment w:id="0" w:author="John Roe" w:date="2024-03-02T09:05:00Z" w:initials="JR"><w:p w:rsidR="00445566"><w:r><w:t>Too high?</w:t></w:r></w:p></w:comment></w:comments>`
+
+const testWordPeople = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w15:people xmlns:w15="http://schemas.microsoft.com/office/word/2012/wordml"><w15:person w15:author="Jane Doe"><w15:presenceInfo w15:providerId="AD" w15:userId="S::jane.doe@acme.com::6f1c"/></w15:person></w15:people>`
+
+const testWordSettings = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:settings xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:zoom w:percent="100"/><w:rsids><w:rsidRoot w:val="00A1B2C3"/><w:rsid w:val="00D4E5F6"/></w:rsids></w:settings>`
+
+// buildTestWordDOCX builds a Word document with tracked changes, a comment and people
+func buildTestWordDOCX(t *testing.T) []byte {
+	return buildTestZip(t,
+		testZipEntry{ooxmlContentTypesPath, zip.Deflate, testWordContentTypes},
+		testZipEntry{"_rels/.rels", zip.Deflate, testWordPackageRels},
+		testZipEntry{"word/document.xml", zip.Deflate, testWordDocument},
+		testZipEntry{"word/_rels/document.xml.rels", zip.Deflate, testWordDocumentRels},
+		testZipEntry{"word/comments.xml", zip.Deflate, testWordComments},
+		testZipEntry{"word/commentsExtended.xml", zip.Deflate, `<w15:commentsEx xmlns:w15="http://schemas.microsoft.com/office/word/2012/wordml"/>`},
+		testZipEntry{"word/people.xml", zip.Deflate, testWordPeople},
+		testZipEntry{"word/settings.xml", zip.Deflate, testWordSettings},
+	)
+}
+
+func TestCleanWordDocument(t *testing.T) {
+	t.Run("Anonymize", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		names, entries := runStripOpenXML(t, proc, buildTestWordDOCX(t))
+
+		if strings.Contains(strings.Join(names, ","), "people.xml") {
+			t.Error("people.xml was not removed")
+		}
+		if strings.Contains(entries[ooxmlContentTypesPath].data, "people") || strings.Contains(entries["word/_rels/document.xml.rels"].data, "people") {
+			t.Error("References to people.xml were not removed")
+		}
+
+		document := entries["word/document.xml"].data
+		for _, leak := range []string{"Jane", "John", "2024", "rsid"} {
+			if strings.Contains(document, leak) {
+				t.Errorf("document.xml still contains %q", leak)
+			}
+		}
+		for _, kept := range []string{`<w:del w:id="1" w:author="Author">`, "<w:delText>90000</w:delText>", `<w:ins w:id="2" w:author="Author">`, `<w:commentReference w:id="0"/>`, `<w:p>`} {
+			if !strings.Contains(document, kept) {
+				t.Errorf("document.xml lost %q", kept)
+			}
+		}
+
+		comments := entries["word/comments.xml"].data
+		if !strings.Contains(comments, `<w:comment w:id="0" w:author="Author" w:initials="A">`) || !strings.Contains(comments, "Too high?") || strings.Contains(comments, "rsid") {
+			t.Errorf("Comment was not anonymized:\n%s", comments)
+		}
+		if strings.Contains(entries["word/settings.xml"].data, "rsid") || !strings.Contains(entries["word/settings.xml"].data, "w:zoom") {
+			t.Errorf("Unexpected settings:\n%s", entries["word/settings.xml"].data)
+		}
+
+		for _, field := range []string{"Revision author", "Comment author", "Person", "Revision session IDs"} {
+			if proc.Stats.ByMetadataType[field] == nil {
+				t.Errorf("%s was not reported in statistics", field)
+			}
+		}
+		if field := proc.Stats.ByMetadataType["Person"]; field != nil && field.Examples[0] != "Jane Doe" {
+			t.Errorf("Unexpected person example %q", field.Examples[0])
+		}
+	})
+
+	t.Run("Remove comments", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.RemoveComments = true
+		names, entries := runStripOpenXML(t, proc, buildTestWordDOCX(t))
+
+		if got := strings.Join(names, ","); got != "[Content_Types].xml,_rels/.rels,word/document.xml,word/_rels/document.xml.rels,word/settings.xml" {
+			t.Errorf("Unexpected entries %s", got)
+		}
+		if rels := entries["word/_rels/document.xml.rels"].data; strings.Contains(rels, "comments") || !strings.Contains(rels, "settings.xml") {
+			t.Errorf("Unexpected document relationships:\n%s", rels)
+		}
+		if types := entries[ooxmlContentTypesPath].data; strings.Contains(types, "comments") || !strings.Contains(types, "/word/document.xml") {
+			t.Errorf("Unexpected content types:\n%s", types)
+		}
+		if strings.Contains(entries["word/document.xml"].data, "comment") {
+			t.Error("Comment anchors were not removed")
+		}
+		if field := proc.Stats.ByMetadataType["Comment"]; field == nil || field.Examples[0] != "John Roe" {
+			t.Error("Removed comment was not reported")
+		}
+	})
+
+	t.Run("Accept revisions", func(t *testing.T) {
+		proc := NewProcessor(nil, false)
+		proc.Policy.AcceptRevisions = true
+		_, entries := runStripOpenXML(t, proc, buildTestWordDOCX(t))
+
+		expected := `<w:p><w:r><w:t xml:space="preserve">Salary is </w:t></w:r><w:r><w:t>95000</w:t></w:r>` +
+			`<w:commentRangeStart w:id="0"/><w:r><w:rPr><w:b/></w:rPr><w:t>.</w:t></w:r><w:commentRangeEnd w:id="0"/>` +
+			`<w:r><w:commentReference w:id="0"/></w:r></w:p>` +
+			`<w:p><w:pPr><w:rPr></w:rPr></w:pPr><w:r><w:t>End</w:t></w:r></w:p>`
+		if document := entries["word/document.xml"].data; !strings.Contains(document, expected) {
+			t.Errorf("Tracked changes were not accepted:\n%s", document)
+		}
+		if field := proc.Stats.ByMetadataType["Tracked change"]; field == nil || field.Count != 4 {
+			t.Error("Tracked changes were not reported")
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// xmlRecorder keeps the bytes the XML decoder has consumed so tokens can be
+// copied to the output exactly as they were written
+type xmlRecorder struct {
+	r    *bufio.Reader
+	buf  []byte
+	base int64 // Input offset of buf[0]
+}
+
+func (s *xmlRecorder) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	s.buf = append(s.buf, b[:n]...)
+	return n, err
+}
+
+func (s *xmlRecorder) ReadByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == nil {
+		s.buf = append(s.buf, c)
+	}
+	return c, err
+}
+
+// take returns the raw bytes up to offset and forgets them
+func (s *xmlRecorder) take(offset int64) ([]byte, error) {
+	n := offset - s.base
+	if n < 0 || n > int64(len(s.buf)) {
+		return nil, errors.New("XML decoder offset out of range")
+	}
+	raw := s.buf[:n]
+	s.buf = s.buf[n:]
+	s.base = offset
+	return raw, nil
+}
+
+// xmlAction tells rewriteXML what to do with an element
+type xmlAction int
+
+const (
+	xmlKeep   xmlAction = iota // Copy the element
+	xmlDrop                    // Remove the element and everything in it
+	xmlEmpty                   // Keep the tags but remove the content
+	xmlUnwrap                  // Remove the tags but keep the content
+)
+
+// xmlElement is an open element seen by rewriteXML. Rules may change attrs;
+// the start tag is then written again from them.
+type xmlElement struct {
+	name   xml.Name // Raw prefix and local name
+	space  string   // Resolved namespace URI
+	attrs  []xml.Attr
+	parent *xmlElement
+	scope  map[string]string // Prefixes declared on this element
+	action xmlAction
+}
+
+// is reports whether the element has the namespace and local name
+func (e *xmlElement) is(space, local string) bool {
+	return e.space == space && e.name.Local == local
+}
+
+// resolve finds the namespace URI bound to a prefix at this element
+func (e *xmlElement) resolve(prefix string) string {
+	if prefix == "xml" {
+		return xmlNamespace
+	}
+	for ; e != nil; e = e.parent {
+		if uri, ok := e.scope[prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// attr returns the value of an attribute. Unprefixed attributes have no namespace.
+func (e *xmlElement) attr(space, local string) (string, bool) {
+	for _, a := range e.attrs {
+		if a.Name.Local != local || a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		if (a.Name.Space == "" && space == "") || (a.Name.Space != "" && e.resolve(a.Name.Space) == space) {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// xmlRules decide what rewriteXML keeps. removed is called with the text of
+// every dropped or emptied element. text may replace the character data of an
+// element that is kept.
+type xmlRules struct {
+	element func(e *xmlElement) xmlAction
+	removed func(e *xmlElement, text string)
+	text    func(e *xmlElement, data string) (string, bool)
+}
+
+// rewriteXML copies an XML document token by token, applying rules to each
+// element. Tokens that are kept are copied byte for byte; a start tag is only
+// rewritten when a rule changed its attributes.
+func rewriteXML(data []byte, rules xmlRules) ([]byte, error) {
+	rec := &xmlRecorder{r: bufio.NewReader(bytes.NewReader(data))}
+	d := xml.NewDecoder(rec)
+	var out bytes.Buffer
+
+	var open *xmlElement     // Innermost open element
+	var removing *xmlElement // Element whose content is being removed
+	depth := 0               // Depth below removing
+	var text strings.Builder
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		raw, err := rec.take(d.InputOffset())
+		if err != nil {
+			return nil, err
+		}
+
+		if removing != nil {
+			switch t := tok.(type) {
+			case xml.StartElement:
+				depth++
+			case xml.CharData:
+				text.Write(t)
+			case xml.EndElement:
+				if depth > 0 {
+					depth--
+					continue
+				}
+				if rules.removed != nil {
+					rules.removed(removing, text.String())
+				}
+				text.Reset()
+				if removing.action == xmlEmpty {
+					out.Write(raw)
+				}
+				open = open.parent
+				removing = nil
+			}
+			continue
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			scope := make(map[string]string)
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					scope[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					scope[""] = attr.Value
+				}
+			}
+			e := &xmlElement{name: t.Name, attrs: append([]xml.Attr(nil), t.Attr...), parent: open, scope: scope}
+			e.space = e.resolve(t.Name.Space)
+			if rules.element != nil {
+				e.action = rules.element(e)
+			}
+			open = e
+
+			switch e.action {
+			case xmlDrop:
+				removing = e
+				continue
+			case xmlUnwrap:
+				continue
+			case xmlEmpty:
+				removing = e
+			}
+			if xmlAttrsEqual(e.attrs, t.Attr) {
+				out.Write(raw)
+			} else if err := writeXMLStartTag(&out, t.Name, e.attrs, bytes.HasSuffix(raw, []byte("/>"))); err != nil {
+				return nil, err
+			}
+
+		case xml.EndElement:
+			if open == nil || t.Name != open.name {
+				return nil, errors.New("unbalanced XML end tag")
+			}
+			if open.action != xmlUnwrap {
+				out.Write(raw)
+			}
+			open = open.parent
+
+		case xml.CharData:
+			if rules.text != nil && open != nil {
+				if replacement, ok := rules.text(open, string(t)); ok {
+					xml.EscapeText(&out, []byte(replacement))
+					continue
+				}
+			}
+			out.Write(raw)
+
+		default:
+			out.Write(raw)
+		}
+	}
+
+	if open != nil {
+		return nil, errors.New("truncated XML document")
+	}
+	return out.Bytes(), nil
+}
+
+// xmlRootName returns the resolved name of the root element, or an empty name
+// if there is none
+func xmlRootName(data []byte) xml.Name {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.Name{}
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name
+		}
+	}
+}
+
+// xmlAttrsEqual reports whether two attribute lists are identical
+func xmlAttrsEqual(a, b []xml.Attr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// xmlResolvePrefix finds the namespace URI bound to a prefix in the open elements
+func xmlResolvePrefix(scopes []map[string]string, prefix string) string {
+	if prefix == "xml" {
+		return xmlNamespace
+	}
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if uri, ok := scopes[i][prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// writeXMLStartTag writes a start tag with the given attributes
+func writeXMLStartTag(w io.Writer, name xml.Name, attrs []xml.Attr, selfClosing bool) error {
+	var b strings.Builder
+	b.WriteString("<" + xmlQualifiedName(name))
+	for _, attr := range attrs {
+		b.WriteString(" " + xmlQualifiedName(attr.Name) + `="`)
+		xml.EscapeText(&b, []byte(attr.Value))
+		b.WriteString(`"`)
+	}
+	if selfClosing {
+		b.WriteString("/>")
+	} else {
+		b.WriteString(">")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// xmlQualifiedName joins a raw prefix and local name
+func xmlQualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// writeAll writes b to w
+func writeAll(w io.Writer, b []byte) error {
+	_, err := w.Write(b)
+	return err
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"testing"
+)
+
+func TestRewriteXML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<root xmlns="urn:a" xmlns:b="urn:b" b:id='1'>
+  <!-- kept comment -->
+  <keep  attr = "x">text &amp; more</keep>
+  <b:drop>secret <inner>value</inner></b:drop>
+  <b:empty b:name="n">content</b:empty>
+  <b:empty/>
+  <unwrap><keep>inside</keep></unwrap>
+  <b:strip b:id="2" other="y"/>
+</root>`
+
+	var removed []string
+	output, err := rewriteXML([]byte(input), xmlRules{
+		element: func(e *xmlElement) xmlAction {
+			switch {
+			case e.is("urn:b", "drop"):
+				return xmlDrop
+			case e.is("urn:b", "empty"):
+				return xmlEmpty
+			case e.is("urn:a", "unwrap"):
+				return xmlUnwrap
+			case e.is("urn:b", "strip"):
+				if id, ok := e.attr("urn:b", "id"); ok && id == "2" {
+					e.attrs = e.attrs[1:]
+				}
+			}
+			return xmlKeep
+		},
+		removed: func(e *xmlElement, text string) {
+			removed = append(removed, e.name.Local+":"+text)
+		},
+	})
+	if err != nil {
+		t.Fatalf("rewriteXML failed: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<root xmlns="urn:a" xmlns:b="urn:b" b:id='1'>
+  <!-- kept comment -->
+  <keep  attr = "x">text &amp; more</keep>
+  
+  <b:empty b:name="n"></b:empty>
+  <b:empty/>
+  <keep>inside</keep>
+  <b:strip other="y"/>
+</root>`
+	if string(output) != expected {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+
+	want := []string{"drop:secret value", "empty:content", "empty:"}
+	if len(removed) != len(want) {
+		t.Fatalf("Unexpected removed elements %q", removed)
+	}
+	for i := range want {
+		if removed[i] != want[i] {
+			t.Errorf("Removed element %d is %q, want %q", i, removed[i], want[i])
+		}
+	}
+
+	output, err = rewriteXML([]byte(`<a><name>Jane &amp; John</name><keep>Jane</keep></a>`), xmlRules{
+		text: func(e *xmlElement, data string) (string, bool) {
+			if e.name.Local == "name" && data == "Jane & John" {
+				return "A & B", true
+			}
+			return "", false
+		},
+	})
+	if err != nil || string(output) != `<a><name>A &amp; B</name><keep>Jane</keep></a>` {
+		t.Errorf("Unexpected rewritten text %q: %v", output, err)
+	}
+
+	for _, invalid := range []string{"<a><b></a>", "<a>", "</a>", "<a>&unknown;</a>"} {
+		if _, err := rewriteXML([]byte(invalid), xmlRules{}); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
@@ -31,6 +31,11 @@ func NewScanner(logger *logger.Logger, previewMode, verbose bool) *Scanner {
 	}
 }
 
+// SetPolicy sets which optional metadata the processor keeps
+func (s *Scanner) SetPolicy(policy processor.Policy) {
+	s.processor.Policy = policy
+}
+
 // ScanDirectory recursively scans a directory and processes files
 func (s *Scanner) ScanDirectory(dirPath string, recursive bool) (int, int, error) {
 	fileCount := 0
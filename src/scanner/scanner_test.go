@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"metadata-remover/src/logger"
+	"metadata-remover/src/processor"
 )
 
 func setupTestEnvironment(t *testing.T) (string, *logger.Logger, func()) {
@@ -128,6 +129,20 @@ func TestNewScanner(t *testing.T) {
 	}
 }
 
+func TestSetPolicy(t *testing.T) {
+	_, log, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	scanner := NewScanner(log, false, false)
+	policy := processor.DefaultPolicy()
+	policy.KeepICCProfile = false
+	scanner.SetPolicy(policy)
+
+	if scanner.processor.Policy != policy {
+		t.Errorf("Expected policy %+v, got %+v", policy, scanner.processor.Policy)
+	}
+}
+
 func TestScanDirectory(t *testing.T) {
 	tempDir, log, cleanup := setupTestEnvironment(t)
 	defer cleanup()
@@ -5,6 +5,8 @@ const (
 	TypeImage    = "image"
 	TypePDF      = "pdf"
 	TypeDocument = "document"
+	TypeAudio    = "audio"
+	TypeVideo    = "video"
 	TypeUnknown  = "unknown"
 )
 
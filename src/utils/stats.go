@@ -180,6 +180,10 @@ func formatFileType(fileType string) string {
 		return "PDFs"
 	case stats.TypeDocument:
 		return "Documents"
+	case stats.TypeAudio:
+		return "Audio files"
+	case stats.TypeVideo:
+		return "Videos"
 	default:
 		return fmt.Sprintf("%s files", strings.ToUpper(fileType[:1])+fileType[1:])
 	}